@@ -0,0 +1,356 @@
+package mocktrans
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The admin API under /_mocktrans is not part of Midtrans. It lets test suites
+// inspect and drive the state of Mocktrans, authenticated with the admin key.
+
+type adminTransaction struct {
+	NotificationRequest
+	StatusHistory []adminStatusChange `json:"status_history,omitempty"`
+}
+
+type adminStatusChange struct {
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	Time              string `json:"time"`
+}
+
+type adminNotification struct {
+	TransactionId string          `json:"transaction_id"`
+	EventType     string          `json:"event_type"`
+	Status        string          `json:"status"`
+	Delivered     bool            `json:"delivered"`
+	Time          string          `json:"time"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type adminStatusRequest struct {
+	TransactionStatus TransactionStatus `json:"transaction_status"`
+	// FraudStatus is left as it is when empty.
+	FraudStatus FraudStatus `json:"fraud_status"`
+}
+
+// AdminAuthorization accepts the admin key as the username of the Basic authorization header.
+func (d *Dependencies) AdminAuthorization(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(d.AdminKey+":")) {
+			writeAdminError(w, http.StatusUnauthorized, "invalid admin key")
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// AdminListTransactions lists the latest transactions, newest first, filtered by the
+// merchant_id, status, payment_type and order_id query parameters.
+func (d *Dependencies) AdminListTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := TransactionFilter{
+		MerchantId:        query.Get("merchant_id"),
+		TransactionStatus: TransactionStatus(query.Get("status")),
+		PaymentType:       query.Get("payment_type"),
+		OrderId:           query.Get("order_id"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			writeAdminError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	transactions, err := d.Storage.listTransactions(r.Context(), filter)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := []adminTransaction{}
+	for _, transaction := range transactions {
+		notification, err := d.transactionNotification(r.Context(), transaction)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		response = append(response, adminTransaction{NotificationRequest: notification})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminGetTransaction returns the transaction in the shape of its notification, with its status history.
+func (d *Dependencies) AdminGetTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction, err := d.Storage.getTransaction(r.Context(), chi.URLParam(r, "transactionId"))
+	if err != nil {
+		writeAdminTransactionError(w, err)
+		return
+	}
+
+	response, err := d.adminTransaction(r.Context(), transaction)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminSetTransactionStatus moves the transaction into any status, regardless of the
+// status that it is in, and notifies the merchant like a real status change would.
+func (d *Dependencies) AdminSetTransactionStatus(w http.ResponseWriter, r *http.Request) {
+	var req adminStatusRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch req.TransactionStatus {
+	case TransactionStatusPending, TransactionStatusCapture, TransactionStatusSettlement, TransactionStatusDeny, TransactionStatusCancel, TransactionStatusExpire, TransactionStatusRefund:
+	default:
+		writeAdminError(w, http.StatusBadRequest, "unknown transaction_status: "+string(req.TransactionStatus))
+		return
+	}
+
+	switch req.FraudStatus {
+	case "", FraudStatusAccept, FraudStatusChallenge, FraudStatusDeny:
+	default:
+		writeAdminError(w, http.StatusBadRequest, "unknown fraud_status: "+string(req.FraudStatus))
+		return
+	}
+
+	transaction, err := d.Storage.getTransaction(r.Context(), chi.URLParam(r, "transactionId"))
+	if err != nil {
+		writeAdminTransactionError(w, err)
+		return
+	}
+
+	transaction.TransactionStatus = req.TransactionStatus
+	if req.FraudStatus != "" {
+		transaction.FraudStatus = req.FraudStatus
+	}
+
+	err = d.Storage.updateTransactionStatus(r.Context(), transaction.Id, transaction.TransactionStatus, transaction.FraudStatus, d.Clock.Now())
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	transaction.UpdatedAt = d.Clock.Now()
+	d.Notify(transaction)
+
+	response, err := d.adminTransaction(r.Context(), transaction)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminReset deletes every transaction and everything else that was created through the API.
+// Merchants are configuration and are kept.
+func (d *Dependencies) AdminReset(w http.ResponseWriter, r *http.Request) {
+	err := d.ResetData(r.Context())
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminListNotifications lists every notification that was sent, oldest first, including
+// the ones that failed to be delivered. The transaction_id query parameter narrows it down
+// to the notifications of one transaction.
+func (d *Dependencies) AdminListNotifications(w http.ResponseWriter, r *http.Request) {
+	attempts, err := d.Storage.listWebhookAttempts(r.Context(), r.URL.Query().Get("transaction_id"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := []adminNotification{}
+	for _, attempt := range attempts {
+		response = append(response, adminNotification{
+			TransactionId: attempt.TransactionId,
+			EventType:     attempt.EventType,
+			Status:        attempt.Status,
+			Delivered:     attempt.Success,
+			Time:          attempt.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+			Payload:       json.RawMessage(attempt.Data),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (d *Dependencies) adminTransaction(ctx context.Context, transaction Transaction) (adminTransaction, error) {
+	notification, err := d.transactionNotification(ctx, transaction)
+	if err != nil {
+		return adminTransaction{}, err
+	}
+
+	history, err := d.Storage.listTransactionStatusHistory(ctx, transaction.Id)
+	if err != nil {
+		return adminTransaction{}, err
+	}
+
+	response := adminTransaction{NotificationRequest: notification}
+	for _, change := range history {
+		response.StatusHistory = append(response.StatusHistory, adminStatusChange{
+			TransactionStatus: string(change.TransactionStatus),
+			FraudStatus:       string(change.FraudStatus),
+			Time:              change.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+		})
+	}
+
+	return response, nil
+}
+
+func writeAdminTransactionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrTransactionNotFound) {
+		writeAdminError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+
+	writeAdminError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeAdminError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(message) + `}`))
+}
+
+// AdminTakeSnapshot saves the current data under the name, to be restored by AdminRestoreSnapshot.
+func (d *Dependencies) AdminTakeSnapshot(w http.ResponseWriter, r *http.Request) {
+	err := d.TakeSnapshot(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// AdminRestoreSnapshot replaces all data with the data of the named snapshot. The snapshot
+// is kept, so that every test can start from it.
+func (d *Dependencies) AdminRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	err := d.RestoreSnapshot(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		if errors.Is(err, ErrSnapshotNotFound) {
+			writeAdminError(w, http.StatusNotFound, "snapshot not found")
+			return
+		}
+
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *Dependencies) AdminListSnapshots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d.Snapshots.names())
+}
+
+func (d *Dependencies) AdminDeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !d.Snapshots.delete(chi.URLParam(r, "name")) {
+		writeAdminError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminGetChaos lists the chaos rules that are in effect.
+func (d *Dependencies) AdminGetChaos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d.ChaosRules())
+}
+
+// AdminSetChaos replaces the chaos rules with the array of ChaosRule in the request body.
+func (d *Dependencies) AdminSetChaos(w http.ResponseWriter, r *http.Request) {
+	rules := []ChaosRule{}
+	err := json.NewDecoder(r.Body).Decode(&rules)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = d.SetChaosRules(rules)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d.ChaosRules())
+}
+
+// AdminDeleteChaos removes every chaos rule, so that Mocktrans behaves again.
+func (d *Dependencies) AdminDeleteChaos(w http.ResponseWriter, r *http.Request) {
+	d.SetChaosRules(nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminGetWebhookFaults lists the webhook fault rules that are in effect.
+func (d *Dependencies) AdminGetWebhookFaults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d.WebhookFaultRules())
+}
+
+// AdminSetWebhookFaults replaces the webhook fault rules with the array of WebhookFaultRule in the request body.
+func (d *Dependencies) AdminSetWebhookFaults(w http.ResponseWriter, r *http.Request) {
+	rules := []WebhookFaultRule{}
+	err := json.NewDecoder(r.Body).Decode(&rules)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = d.SetWebhookFaultRules(rules)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(d.WebhookFaultRules())
+}
+
+// AdminDeleteWebhookFaults removes every webhook fault rule, and sends the notifications
+// that were held back.
+func (d *Dependencies) AdminDeleteWebhookFaults(w http.ResponseWriter, r *http.Request) {
+	d.SetWebhookFaultRules(nil)
+	w.WriteHeader(http.StatusNoContent)
+}
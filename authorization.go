@@ -1,18 +1,67 @@
-package main
+package mocktrans
 
 import (
+	"context"
 	"encoding/base64"
 	"net/http"
+	"strings"
 )
 
+// Server and client keys tell which environment they belong to. A key of the other
+// environment is unknown to Midtrans, even if it belongs to a real merchant.
+const (
+	sandboxServerKeyPrefix    = "SB-Mid-server-"
+	productionServerKeyPrefix = "Mid-server-"
+	sandboxClientKeyPrefix    = "SB-Mid-client-"
+	productionClientKeyPrefix = "Mid-client-"
+)
+
+const unknownMerchantMessage = "Unknown Merchant server_key/id"
+
+// Authorization resolves the merchant out of the server key in the Basic
+// authorization header, and puts it in the request context.
 func (d *Dependencies) Authorization(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check for Authorization
-		if r.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(d.ServerKey+":")) {
-			w.WriteHeader(http.StatusUnauthorized)
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Basic ") {
+			writeErrorResponse(w, ErrorAccessDenied)
+			return
+		}
+
+		credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+		if err != nil {
+			writeErrorResponse(w, ErrorAccessDenied)
+			return
+		}
+
+		serverKey, _, _ := strings.Cut(string(credentials), ":")
+		if serverKey == "" {
+			writeErrorResponse(w, ErrorAccessDenied)
 			return
 		}
 
-		h.ServeHTTP(w, r)
+		if !d.serverKeyMatchesEnvironment(serverKey) {
+			writeErrorMessageResponse(w, ErrorAccessDenied, unknownMerchantMessage)
+			return
+		}
+
+		merchant, ok := d.merchantByServerKey(serverKey)
+		if !ok {
+			writeErrorMessageResponse(w, ErrorAccessDenied, unknownMerchantMessage)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), merchantKey{}, merchant)))
 	})
 }
+
+// serverKeyMatchesEnvironment rejects the keys that are made for the other environment.
+// Keys without either prefix are left to the merchant lookup.
+func (d *Dependencies) serverKeyMatchesEnvironment(serverKey string) bool {
+	if d.Production {
+		return !strings.HasPrefix(serverKey, sandboxServerKeyPrefix)
+	}
+
+	return !strings.HasPrefix(serverKey, productionServerKeyPrefix)
+}
@@ -0,0 +1,9 @@
+package mocktrans
+
+// cardlessCreditProviders lists the cardless credit payment types. The customer
+// applies for the credit on the provider's page, which is replaced by a
+// simulator page on Mocktrans where the tester approves or rejects it.
+var cardlessCreditProviders = map[string]simulatorBrand{
+	"akulaku": {Name: "Akulaku", Color: "#e60012"},
+	"kredivo": {Name: "Kredivo", Color: "#f9a01b"},
+}
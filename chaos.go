@@ -0,0 +1,302 @@
+package mocktrans
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ChaosRule makes the requests of a route misbehave, to test how a client copes with
+// an unreliable Midtrans. Percentages are out of 100, and a request gets at most one of
+// the errors, the connection reset or the truncated body. The latency comes on top.
+type ChaosRule struct {
+	// Method matches the HTTP method of the request, any method when empty.
+	Method string `json:"method"`
+	// Route matches the route pattern, such as "/v2/{orderId}/status", every route when empty.
+	Route string `json:"route"`
+	// Latency delays every request.
+	Latency Duration `json:"latency"`
+	// RandomLatency delays every request by up to this much more, at random.
+	RandomLatency Duration `json:"random_latency"`
+	// Errors respond with their status code to a percentage of the requests, without handling them.
+	Errors []ChaosError `json:"errors"`
+	// ResetPercentage is the percentage of the requests whose connection is reset without a response.
+	ResetPercentage float64 `json:"reset_percentage"`
+	// TruncatePercentage is the percentage of the requests that are handled, but whose
+	// response body is cut off halfway.
+	TruncatePercentage float64 `json:"truncate_percentage"`
+}
+
+type ChaosError struct {
+	StatusCode int     `json:"status_code"`
+	Percentage float64 `json:"percentage"`
+}
+
+type chaosFault int
+
+const (
+	chaosFaultNone chaosFault = iota
+	chaosFaultError
+	chaosFaultReset
+	chaosFaultTruncate
+)
+
+// chaos holds the chaos rules, which the admin API changes while Mocktrans runs.
+type chaos struct {
+	mu     sync.Mutex
+	rules  []ChaosRule
+	random *rand.Rand
+}
+
+// LoadChaosRules reads the chaos rules from a JSON file containing an array of ChaosRule.
+func LoadChaosRules(path string) ([]ChaosRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chaos rules file: %w", err)
+	}
+
+	var rules []ChaosRule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chaos rules file: %w", err)
+	}
+
+	err = ValidateChaosRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// MaxChaosLatency is the most that the latency and the random latency of a chaos rule may
+// add up to. The write timeout of the mocktrans command leaves room for it.
+const MaxChaosLatency = time.Second * 30
+
+// ValidateChaosRules checks that the status codes are errors, that the percentages
+// of every rule add up to 100 at most, and that the latencies are within MaxChaosLatency.
+func ValidateChaosRules(rules []ChaosRule) error {
+	for i, rule := range rules {
+		total := rule.ResetPercentage + rule.TruncatePercentage
+		if rule.ResetPercentage < 0 || rule.TruncatePercentage < 0 {
+			return fmt.Errorf("rule %d: percentages can not be negative", i)
+		}
+
+		for _, chaosError := range rule.Errors {
+			if chaosError.StatusCode < 400 || chaosError.StatusCode > 599 {
+				return fmt.Errorf("rule %d: status_code must be between 400 and 599, got %d", i, chaosError.StatusCode)
+			}
+
+			if chaosError.Percentage < 0 {
+				return fmt.Errorf("rule %d: percentages can not be negative", i)
+			}
+			total += chaosError.Percentage
+		}
+
+		if total > 100 {
+			return fmt.Errorf("rule %d: percentages add up to more than 100", i)
+		}
+
+		if rule.Latency < 0 || rule.RandomLatency < 0 {
+			return fmt.Errorf("rule %d: latencies can not be negative", i)
+		}
+
+		if time.Duration(rule.Latency+rule.RandomLatency) > MaxChaosLatency {
+			return fmt.Errorf("rule %d: latency and random_latency add up to more than %s", i, MaxChaosLatency)
+		}
+	}
+
+	return nil
+}
+
+// ChaosRules returns the chaos rules that are in effect.
+func (d *Dependencies) ChaosRules() []ChaosRule {
+	d.chaos.mu.Lock()
+	defer d.chaos.mu.Unlock()
+
+	return append([]ChaosRule{}, d.chaos.rules...)
+}
+
+// SetChaosRules replaces the chaos rules, an empty list turns chaos off.
+func (d *Dependencies) SetChaosRules(rules []ChaosRule) error {
+	err := ValidateChaosRules(rules)
+	if err != nil {
+		return err
+	}
+
+	d.chaos.mu.Lock()
+	defer d.chaos.mu.Unlock()
+
+	d.chaos.rules = append([]ChaosRule{}, rules...)
+	return nil
+}
+
+// chaosFor rolls the dice for a request of the route, with the first rule that matches it.
+func (d *Dependencies) chaosFor(method string, route string) (time.Duration, chaosFault, int) {
+	d.chaos.mu.Lock()
+	defer d.chaos.mu.Unlock()
+
+	for _, rule := range d.chaos.rules {
+		if (rule.Method != "" && !strings.EqualFold(rule.Method, method)) || (rule.Route != "" && rule.Route != route) {
+			continue
+		}
+
+		// The random source is not safe for concurrent use, it is guarded by the mutex as well
+		if d.chaos.random == nil {
+			d.chaos.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+
+		latency := time.Duration(rule.Latency)
+		if rule.RandomLatency > 0 {
+			latency += time.Duration(d.chaos.random.Int63n(int64(rule.RandomLatency)))
+		}
+
+		roll := d.chaos.random.Float64() * 100
+		for _, chaosError := range rule.Errors {
+			if roll < chaosError.Percentage {
+				return latency, chaosFaultError, chaosError.StatusCode
+			}
+			roll -= chaosError.Percentage
+		}
+
+		if roll < rule.ResetPercentage {
+			return latency, chaosFaultReset, 0
+		}
+		roll -= rule.ResetPercentage
+
+		if roll < rule.TruncatePercentage {
+			return latency, chaosFaultTruncate, 0
+		}
+
+		return latency, chaosFaultNone, 0
+	}
+
+	return 0, chaosFaultNone, 0
+}
+
+// Chaos makes the requests of the routes misbehave the way the chaos rules say. The admin API
+// is left alone, so that chaos can always be turned off.
+func (d *Dependencies) Chaos(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/_mocktrans/") {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			// The route pattern is only known after routing, which is after the middlewares
+			routeContext := chi.NewRouteContext()
+			if !routes.Match(routeContext, r.Method, r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			latency, fault, statusCode := d.chaosFor(r.Method, routeContext.RoutePattern())
+			waitLatency(r.Context(), latency)
+
+			switch fault {
+			case chaosFaultError:
+				writeStatusErrorResponse(w, statusCode)
+			case chaosFaultReset:
+				resetConnection(w)
+			case chaosFaultTruncate:
+				response := &bufferedResponse{header: make(http.Header), statusCode: http.StatusOK}
+				h.ServeHTTP(response, r)
+				writeTruncatedResponse(w, response)
+			default:
+				h.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// resetConnection closes the connection of the request without a response. The connection
+// lingers for no time at all, so the client gets a reset instead of an orderly close. A writer
+// that has no connection to reset, such as an httptest.ResponseRecorder, gets a 502 instead.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeStatusErrorResponse(w, http.StatusBadGateway)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		writeStatusErrorResponse(w, http.StatusBadGateway)
+		return
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// writeTruncatedResponse writes the buffered response with its full Content-Length,
+// but only half of its body, and closes the connection. A writer that has no connection
+// to close gets a 502 instead, as it could not tell that the body was cut off.
+func writeTruncatedResponse(w http.ResponseWriter, response *bufferedResponse) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeStatusErrorResponse(w, http.StatusBadGateway)
+		return
+	}
+
+	for key, values := range response.header {
+		w.Header()[key] = values
+	}
+
+	body := response.body.Bytes()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(response.statusCode)
+	w.Write(body[:len(body)/2])
+
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	// The server closes the connection on its own when the body is shorter than its
+	// Content-Length, hijacking it only makes that happen right away
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+// bufferedResponse keeps the response of a handler, to be written later on, where
+// responseRecorder writes it through.
+type bufferedResponse struct {
+	header      http.Header
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+
+	r.statusCode = statusCode
+	r.wroteHeader = true
+}
+
+func (r *bufferedResponse) Write(content []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(content)
+}
@@ -1,43 +1,68 @@
-package main
+package mocktrans
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 )
 
 type chargeRequest struct {
-	PaymentType       string                 `json:"payment_type"`
-	TransactionDetail TransactionDetail      `json:"transaction_detail"`
-	ItemDetails       []ItemDetail           `json:"item_details"`
-	CustomerDetails   CustomerDetail         `json:"customer_details"`
-	BankTransfer      BankTransfer           `json:"bank_transfer"`
-	CustomExpiry      CustomExpiry           `json:"custom_expiry"`
-	Metadata          map[string]interface{} `json:"metadata"`
-	CustomField1      string                 `json:"custom_field_1"`
-	CustomField2      string                 `json:"custom_field_2"`
-	CustomField3      string                 `json:"custom_field_3"`
+	PaymentType        string                 `json:"payment_type"`
+	TransactionDetails TransactionDetail      `json:"transaction_details"`
+	ItemDetails        []ItemDetail           `json:"item_details"`
+	CustomerDetails    CustomerDetail         `json:"customer_details"`
+	BankTransfer       BankTransfer           `json:"bank_transfer"`
+	CustomExpiry       CustomExpiry           `json:"custom_expiry"`
+	CreditCard         CreditCard             `json:"credit_card"`
+	BcaKlikpay         BcaKlikpay             `json:"bca_klikpay"`
+	BcaKlikbca         BcaKlikbca             `json:"bca_klikbca"`
+	CimbClicks         CimbClicks             `json:"cimb_clicks"`
+	UobEzpay           UobEzpay               `json:"uob_ezpay"`
+	BriEpay            BriEpay                `json:"bri_epay"`
+	DanamonOnline      DanamonOnline          `json:"danamon_online"`
+	Cstore             Cstore                 `json:"cstore"`
+	Echannel           Echannel               `json:"echannel"`
+	Qris               Qris                   `json:"qris"`
+	Shopeepay          Shopeepay              `json:"shopeepay"`
+	Gopay              Gopay                  `json:"gopay"`
+	Metadata           map[string]interface{} `json:"metadata"`
+	CustomField1       string                 `json:"custom_field1"`
+	CustomField2       string                 `json:"custom_field2"`
+	CustomField3       string                 `json:"custom_field3"`
+
+	// merchantId is the merchant that the transaction is created for.
+	merchantId string
+	// subscriptionId is set on the charges that are made by the subscription scheduler.
+	subscriptionId string
 }
 
 type chargeResponse struct {
-	StatusCode        string   `json:"status_code"`
-	StatusMessage     string   `json:"status_message"`
-	TransactionId     string   `json:"transaction_id"`
-	OrderId           string   `json:"order_id"`
-	MerchantId        string   `json:"merchant_id,omitempty"`
-	GrossAmount       string   `json:"gross_amount"`
-	Currency          string   `json:"currency,omitempty"`
-	PaymentType       string   `json:"payment_type"`
-	TransactionTime   string   `json:"transaction_time"`
-	TransactionStatus string   `json:"transaction_status"`
-	FraudStatus       string   `json:"fraud_status"`
-	ApprovalCode      string   `json:"approval_code,omitempty"`
-	MaskedCard        string   `json:"masked_card,omitempty"`
-	Bank              string   `json:"bank,omitempty"`
-	Acquirer          string   `json:"acquirer,omitempty"`
-	Actions           []Action `json:"actions,omitempty"`
+	StatusCode        string                  `json:"status_code"`
+	StatusMessage     string                  `json:"status_message"`
+	TransactionId     string                  `json:"transaction_id"`
+	OrderId           string                  `json:"order_id"`
+	MerchantId        string                  `json:"merchant_id,omitempty"`
+	GrossAmount       string                  `json:"gross_amount"`
+	Currency          string                  `json:"currency,omitempty"`
+	PaymentType       string                  `json:"payment_type"`
+	TransactionTime   string                  `json:"transaction_time"`
+	TransactionStatus string                  `json:"transaction_status"`
+	FraudStatus       string                  `json:"fraud_status"`
+	ApprovalCode      string                  `json:"approval_code,omitempty"`
+	MaskedCard        string                  `json:"masked_card,omitempty"`
+	Bank              string                  `json:"bank,omitempty"`
+	Acquirer          string                  `json:"acquirer,omitempty"`
+	Actions           []Action                `json:"actions,omitempty"`
+	RedirectUrl       string                  `json:"redirect_url,omitempty"`
+	VaNumbers         []VirtualAccountNumbers `json:"va_numbers,omitempty"`
+	PermataVaNumber   string                  `json:"permata_va_number,omitempty"`
+	BillKey           string                  `json:"bill_key,omitempty"`
+	BillerCode        string                  `json:"biller_code,omitempty"`
 }
 
 func (d *Dependencies) Charge(w http.ResponseWriter, r *http.Request) {
@@ -49,141 +74,284 @@ func (d *Dependencies) Charge(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req chargeRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := d.decodeRequestBody(r, &req)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(int(ErrorSyntaxInBody))
-		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		errorStatus, message := decodeErrorStatus(err)
+		writeErrorResponse(w, errorStatus, message)
 		return
 	}
 
+	req.merchantId = merchantFromContext(r.Context()).MerchantId
+
 	// Validate request body
-	errorStatus, reason := req.Validate()
+	errorStatus, validationMessages := req.Validate()
 	if errorStatus != 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(int(errorStatus))
-		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(reason) + `}`))
+		writeErrorResponse(w, errorStatus, validationMessages...)
 		return
 	}
+
+	// Scenario rules can slow the charge down, or fail it before a transaction is created
+	if scenario, ok := d.EvaluateScenario(req); ok {
+		waitLatency(r.Context(), time.Duration(scenario.Latency))
+
+		if scenario.StatusCode != 0 {
+			writeStatusErrorResponse(w, scenario.StatusCode)
+			return
+		}
+	}
+
+	response, err := d.charge(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateOrderId) {
+			writeErrorResponse(w, ErrorDuplicateOrderId)
+			return
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 }
 
-func (c chargeRequest) Validate() (ErrorStatusCode, string) {
-	// Payment type must be one of:
-	// - credit_card
-	// - bank_transfer
-	// - bca_klikpay
-	// - bca_klikbca
-	// - bri_epay
-	// - cimb_clicks
-	// - danamon_online
-	// - uob_ezpay
-	// - qris
-	// - gopay
-	// - shopeepay
-	// - cstore
-	// - akulaku
-	// - kredivo
-	var paymentTypeOk = true
-	for _, validPaymentTypes := range []string{"credit_card", "bank_transfer", "bca_klikpay", "bca_klikbca", "bri_epay", "cimb_clicks", "danamon_online", "uob_ezpay", "qris", "gopay", "shopeepay", "cstore", "akulaku", "kredivo"} {
-		if c.PaymentType == validPaymentTypes {
-			paymentTypeOk = true
-			break
+// charge creates the transaction out of a validated charge request and
+// notifies the merchant about it. It is shared by the Core API and Snap.
+func (d *Dependencies) charge(ctx context.Context, req chargeRequest) (chargeResponse, error) {
+	// An order_id can only be used again once the bank has denied it. The check and the
+	// insert of the transaction must not interleave with another charge of the order_id.
+	unlock := d.orders.lock(req.merchantId + "\x00" + req.TransactionDetails.OrderId)
+	defer unlock()
+
+	previousTransactions, err := d.listOrderTransactions(ctx, req.merchantId, req.TransactionDetails.OrderId)
+	if err != nil {
+		return chargeResponse{}, err
+	}
+
+	for _, previous := range previousTransactions {
+		if previous.TransactionStatus != TransactionStatusDeny {
+			return chargeResponse{}, ErrDuplicateOrderId
 		}
 	}
 
-	if !paymentTypeOk {
-		return ErrorValidation, fmt.Sprintf("unknown payment type of %s", c.PaymentType)
+	transactionId, err := newId()
+	if err != nil {
+		return chargeResponse{}, err
 	}
 
-	// Order ID must exists and must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)
-	if c.TransactionDetail.OrderId == "" {
-		return ErrorValidation, "order_id is required"
+	now := d.Clock.Now()
+	transaction := Transaction{
+		Id:                transactionId,
+		OrderId:           req.TransactionDetails.OrderId,
+		PaymentType:       req.PaymentType,
+		GrossAmount:       req.TransactionDetails.GrossAmount,
+		MerchantId:        req.merchantId,
+		TransactionStatus: TransactionStatusPending,
+		FraudStatus:       d.EvaluateFraud(req),
+		PaymentLinkId:     req.TransactionDetails.PaymentLinkId,
+		SubscriptionId:    req.subscriptionId,
+		Metadata:          req.Metadata,
+		CustomField1:      req.CustomField1,
+		CustomField2:      req.CustomField2,
+		CustomField3:      req.CustomField3,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
-	if strings.ContainsAny(c.TransactionDetail.OrderId, "!@#$%^&*()+=[]{}|;':,/<>?\\") {
-		return ErrorValidation, "order_id must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)"
+	if req.PaymentType == "credit_card" {
+		transaction.TransactionStatus = TransactionStatusCapture
+		transaction.MaskedCard = maskCardToken(req.CreditCard.TokenId)
+		transaction.Bank = req.CreditCard.Bank
+
+		// A saved card is charged as the card that was saved, with its bank unless the merchant chose one
+		savedCard, err := d.Storage.getSavedCard(ctx, req.merchantId, req.CreditCard.TokenId)
+		if err == nil {
+			transaction.MaskedCard = savedCard.MaskedCard
+			if transaction.Bank == "" {
+				transaction.Bank = savedCard.Bank
+			}
+		} else if !errors.Is(err, ErrSavedCardNotFound) {
+			return chargeResponse{}, err
+		}
 	}
 
-	// Gross Amount must be equal to Item Details total amount
-	var totalAmount int64 = 0
-	for _, item := range c.ItemDetails {
-		totalAmount += item.Quantity * item.Price
+	// Charges of a linked GoPay account depend on the account and its balance
+	if req.PaymentType == "gopay" && req.Gopay.PaymentOptionToken != "" {
+		transaction.TransactionStatus, err = d.chargeGopayToken(ctx, req)
+		if err != nil {
+			return chargeResponse{}, err
+		}
+	}
+
+	if transaction.FraudStatus == FraudStatusDeny {
+		transaction.TransactionStatus = TransactionStatusDeny
+	}
+
+	scenario, _ := d.EvaluateScenario(req)
+	if scenario.TransactionStatus != "" {
+		transaction.TransactionStatus = scenario.TransactionStatus
+	}
+
+	// The virtual account goes in with the transaction, so that no transaction is left without one
+	var virtualAccount VirtualAccount
+	var virtualAccounts []VirtualAccount
+	if req.PaymentType == "bank_transfer" {
+		virtualAccount = VirtualAccount{
+			TransactionId: transaction.Id,
+			VaNumber:      virtualAccountNumber(req, transaction.Id),
+			Bank:          req.BankTransfer.Bank,
+			CreatedAt:     now,
+		}
+
+		virtualAccount.Id, err = newId()
+		if err != nil {
+			return chargeResponse{}, err
+		}
+		virtualAccounts = append(virtualAccounts, virtualAccount)
 	}
 
-	if totalAmount != c.TransactionDetail.GrossAmount {
-		return ErrorValidation, "gross_amount must be equal to Item Details total amount"
+	err = d.Storage.insertTransaction(ctx, transaction, virtualAccounts...)
+	if err != nil {
+		return chargeResponse{}, err
 	}
 
-	// Validate customer
-	if len(c.CustomerDetails.Email) > 255 {
-		return ErrorValidation, "customer_details.email must not exceed 255 characters"
+	response := chargeResponse{
+		StatusCode:        transaction.StatusCode(),
+		StatusMessage:     chargeStatusMessage(transaction),
+		TransactionId:     transaction.Id,
+		OrderId:           transaction.OrderId,
+		MerchantId:        transaction.MerchantId,
+		GrossAmount:       transaction.FormattedGrossAmount(),
+		Currency:          "IDR",
+		PaymentType:       transaction.PaymentType,
+		TransactionTime:   transaction.TransactionTime(),
+		TransactionStatus: string(transaction.TransactionStatus),
+		FraudStatus:       string(transaction.FraudStatus),
+		MaskedCard:        transaction.MaskedCard,
+		Bank:              transaction.Bank,
 	}
 
-	if len(c.CustomerDetails.FirstName) > 255 {
-		return ErrorValidation, "customer_details.first_name must not exceed 255 characters"
+	if _, ok := redirectSimulatorBrand(transaction.PaymentType); ok && transaction.TransactionStatus == TransactionStatusPending {
+		response.RedirectUrl = d.simulatorUrl(transaction.Id)
 	}
 
-	if len(c.CustomerDetails.LastName) > 255 {
-		return ErrorValidation, "customer_details.last_name must not exceed 255 characters"
+	// Permata has its own field for the account number, the other banks use va_numbers
+	if virtualAccount.Bank == "permata" {
+		response.PermataVaNumber = virtualAccount.VaNumber
+	} else if virtualAccount.VaNumber != "" {
+		response.VaNumbers = []VirtualAccountNumbers{{VaNumber: virtualAccount.VaNumber, Bank: virtualAccount.Bank}}
 	}
 
-	if len(c.CustomerDetails.Phone) > 255 {
-		return ErrorValidation, "customer_details.phone must not exceed 255 characters"
+	// Mandiri Bill is paid with the bill key, under the biller code of Midtrans
+	if transaction.PaymentType == "echannel" {
+		response.BillKey = echannelBillKey(transaction.Id)
+		response.BillerCode = echannelBillerCode
 	}
 
-	// Validate customer's address
-	if len(c.CustomerDetails.BillingAddress.Address) > 255 {
-		return ErrorValidation, "customer_details.address.address must not exceed 255 characters"
+	// The customer enters the GoPay PIN on the simulator page
+	if req.PaymentType == "gopay" && req.Gopay.PaymentOptionToken != "" && transaction.TransactionStatus == TransactionStatusPending {
+		response.Actions = []Action{{Name: "verification-link-url", Method: "GET", Url: d.simulatorUrl(transaction.Id)}}
 	}
 
-	if len(c.CustomerDetails.BillingAddress.City) > 255 {
-		return ErrorValidation, "customer_details.address.city must not exceed 255 characters"
+	d.notifyScenario(transaction, scenario)
+	d.scheduleScenarioTransitions(transaction, scenario)
+
+	return response, nil
+}
+
+// echannelBillerCode is the biller code of Midtrans on Mandiri Bill.
+const echannelBillerCode = "70012"
+
+// echannelBillKey derives the 12 digit bill key from the transaction id,
+// so that the same transaction always has the same bill key.
+func echannelBillKey(transactionId string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(transactionId))
+	return fmt.Sprintf("%012d", hash.Sum64()%1000000000000)
+}
+
+func chargeStatusMessage(t Transaction) string {
+	switch {
+	case t.FraudStatus == FraudStatusChallenge:
+		return "Challenge by FDS"
+	case t.FraudStatus == FraudStatusDeny:
+		return "Denied by FDS"
+	case t.TransactionStatus == TransactionStatusCapture:
+		return "Success, Credit Card transaction is successful"
+	case t.TransactionStatus == TransactionStatusDeny && t.PaymentType == "credit_card":
+		return "Deny by Bank [" + strings.ToUpper(t.Bank) + "] with code [05] and message [Do not honour]"
+	case t.TransactionStatus == TransactionStatusDeny && t.PaymentType == "gopay":
+		return "GoPay transaction is denied"
+	case t.TransactionStatus == TransactionStatusSettlement && t.PaymentType == "gopay":
+		return "Success, GoPay transaction is successful"
 	}
 
-	if len(c.CustomerDetails.BillingAddress.CountryCode) > 3 {
-		return ErrorValidation, "customer_details.address.country_code must not exceed 3 characters"
+	// Until the customer pays on the bank's page, the transaction is only created
+	if bank, ok := directDebitBanks[t.PaymentType]; ok {
+		if t.TransactionStatus == TransactionStatusSettlement {
+			return "Success, " + bank.Name + " transaction is successful"
+		}
+
+		return "Success, " + bank.Name + " transaction is created"
 	}
 
-	// Validate customer's shipping address
-	if len(c.CustomerDetails.ShippingAddress.Address) > 255 {
-		return ErrorValidation, "customer_details.shipping_address.address must not exceed 255 characters"
+	if provider, ok := cardlessCreditProviders[t.PaymentType]; ok {
+		return "Success, " + provider.Name + " transaction is created"
 	}
 
-	if len(c.CustomerDetails.ShippingAddress.City) > 255 {
-		return ErrorValidation, "customer_details.shipping_address.city must not exceed 255 characters"
+	return "Success, transaction is created"
+}
+
+// maskCardToken builds the masked_card out of a sandbox token_id,
+// which looks like "481111-1114-a901971f-2f1b-4781-802a-df326fbf0e9c",
+// or a saved token_id, which looks like "481111sHfSakAvKIaQXJKzqsmIYi1114".
+func maskCardToken(tokenId string) string {
+	parts := strings.SplitN(tokenId, "-", 3)
+	if len(parts) >= 2 {
+		return parts[0] + "-" + parts[1]
 	}
 
-	if len(c.CustomerDetails.ShippingAddress.CountryCode) > 3 {
-		return ErrorValidation, "customer_details.shipping_address.country_code must not exceed 3 characters"
+	if len(tokenId) >= 10 {
+		return tokenId[:6] + "-" + tokenId[len(tokenId)-4:]
 	}
 
-	switch c.PaymentType {
-	case "bank_transfer":
-		break
-	case "bca_klikpay":
-		for _, itemDetail := range c.ItemDetails {
-			if itemDetail.Tenor == "" {
-				return ErrorValidation, "tenor is required"
-			}
+	return ""
+}
 
-			if len(itemDetail.Tenor) != 2 {
-				return ErrorValidation, "tenor must be 2 digits"
-			}
+// validateItemDetails checks that the item details add up to the gross amount.
+// It returns the reason of the failure, or an empty string if they are valid.
+func validateItemDetails(grossAmount int64, itemDetails []ItemDetail) string {
+	if len(itemDetails) == 0 {
+		return ""
+	}
 
-			_, err := strconv.Atoi(itemDetail.Tenor)
-			if err != nil {
-				return ErrorValidation, "tenor must be numeric"
-			}
+	var totalAmount int64 = 0
+	for _, item := range itemDetails {
+		totalAmount += item.Quantity * item.Price
+	}
 
-			if itemDetail.CodePlan == "" {
-				return ErrorValidation, "code_plan is required"
-			}
+	if totalAmount != grossAmount {
+		return "gross_amount must be equal to Item Details total amount"
+	}
 
-			if itemDetail.MID == "" {
-				return ErrorValidation, "mid is required"
-			}
+	return ""
+}
+
+var paymentTypes = []string{"credit_card", "bank_transfer", "echannel", "bca_klikpay", "bca_klikbca", "bri_epay", "cimb_clicks", "danamon_online", "uob_ezpay", "qris", "gopay", "shopeepay", "cstore", "akulaku", "kredivo"}
+
+// Validate checks the whole request against chargeRules, and returns every problem that it finds.
+func (c chargeRequest) Validate() (ErrorStatusCode, []string) {
+	var validationMessages []string
+	for _, rule := range chargeRules {
+		if rule.appliesTo(c.PaymentType) {
+			validationMessages = append(validationMessages, rule.Check(c)...)
 		}
 	}
 
-	return 0, ""
+	if len(validationMessages) > 0 {
+		return ErrorValidation, validationMessages
+	}
+
+	return 0, nil
 }
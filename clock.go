@@ -0,0 +1,17 @@
+package mocktrans
+
+import "time"
+
+// Clock tells the current time. Everything that depends on time, such as
+// expiries and the subscription schedule, asks the Clock instead of calling
+// time.Now, so the time can be controlled when testing.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the wall time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldy505/mocktrans"
+
+	// Database drivers
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	port, ok := os.LookupEnv("PORT")
+	if !ok {
+		port = "5000"
+	}
+
+	environment, environmentSet := os.LookupEnv("MIDTRANS_ENVIRONMENT")
+	if !environmentSet {
+		environment = "sandbox"
+	}
+	if environment != "sandbox" && environment != "production" {
+		log.Fatalf("invalid MIDTRANS_ENVIRONMENT: %s, must be sandbox or production", environment)
+	}
+	production := environment == "production"
+
+	// The default keys are made for the environment
+	serverKey, ok := os.LookupEnv("SERVER_KEY")
+	if !ok {
+		serverKey = "SB-Mid-server-abc123cde456"
+		if production {
+			serverKey = "Mid-server-abc123cde456"
+		}
+	}
+
+	clientKey, ok := os.LookupEnv("CLIENT_KEY")
+	if !ok {
+		clientKey = "SB-Mid-client-abc123cde456"
+		if production {
+			clientKey = "Mid-client-abc123cde456"
+		}
+	}
+
+	merchantId, ok := os.LookupEnv("MERCHANT_ID")
+	if !ok {
+		merchantId = "G000000000"
+	}
+
+	callbackUrl, ok := os.LookupEnv("CALLBACK_URL")
+	if !ok {
+		callbackUrl = "localhost"
+	}
+
+	publicUrl, ok := os.LookupEnv("PUBLIC_URL")
+	if !ok {
+		publicUrl = "http://localhost:" + port
+	}
+
+	// Snap redirect URLs, as configured on the Midtrans dashboard
+	snapFinishUrl := os.Getenv("SNAP_FINISH_URL")
+	snapUnfinishUrl := os.Getenv("SNAP_UNFINISH_URL")
+	snapErrorUrl := os.Getenv("SNAP_ERROR_URL")
+
+	databaseProvider, ok := os.LookupEnv("DATABASE_PROVIDER")
+	if !ok {
+		databaseProvider = "sqlite3"
+	}
+
+	databaseUrl, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		databaseUrl = "./database.db"
+	}
+
+	// Iris has its own API keys, one for creating payouts and one for approving them
+	irisCreatorKey, ok := os.LookupEnv("IRIS_CREATOR_KEY")
+	if !ok {
+		irisCreatorKey = "IRIS-creator-abc123"
+	}
+
+	irisApproverKey, ok := os.LookupEnv("IRIS_APPROVER_KEY")
+	if !ok {
+		irisApproverKey = "IRIS-approver-abc123"
+	}
+
+	irisMerchantKey, ok := os.LookupEnv("IRIS_MERCHANT_KEY")
+	if !ok {
+		irisMerchantKey = "IRIS-merchant-abc123"
+	}
+
+	irisCallbackUrl := os.Getenv("IRIS_CALLBACK_URL")
+
+	adminKey, ok := os.LookupEnv("ADMIN_KEY")
+	if !ok {
+		adminKey = "MOCKTRANS-admin-abc123"
+	}
+
+	var irisInitialBalance int64 = 100000000
+	if value, ok := os.LookupEnv("IRIS_BALANCE"); ok {
+		balance, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid IRIS_BALANCE: %v", err)
+		}
+		irisInitialBalance = balance
+	}
+
+	subscriptionSchedulerInterval := time.Second * 10
+	if value, ok := os.LookupEnv("SUBSCRIPTION_SCHEDULER_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("invalid SUBSCRIPTION_SCHEDULER_INTERVAL: %v", err)
+		}
+		subscriptionSchedulerInterval = interval
+	}
+
+	strictMode := os.Getenv("STRICT_MODE") == "true" || production
+
+	// A single merchant out of the environment, unless MERCHANTS_FILE lists several
+	merchants := []mocktrans.Merchant{{MerchantId: merchantId, ServerKey: serverKey, ClientKey: clientKey, CallbackUrl: callbackUrl}}
+	if merchantsFile, ok := os.LookupEnv("MERCHANTS_FILE"); ok {
+		loaded, err := mocktrans.LoadMerchants(merchantsFile)
+		if err != nil {
+			log.Fatalf("failed to load merchants: %v", err)
+		}
+		merchants = loaded
+	}
+
+	var fraudRules []mocktrans.FraudRule
+	if fraudRulesFile, ok := os.LookupEnv("FRAUD_RULES_FILE"); ok {
+		rules, err := mocktrans.LoadFraudRules(fraudRulesFile)
+		if err != nil {
+			log.Fatalf("failed to load fraud rules: %v", err)
+		}
+		fraudRules = rules
+	}
+
+	var scenarioRules []mocktrans.ScenarioRule
+	if scenarioRulesFile, ok := os.LookupEnv("SCENARIO_RULES_FILE"); ok {
+		rules, err := mocktrans.LoadScenarioRules(scenarioRulesFile)
+		if err != nil {
+			log.Fatalf("failed to load scenario rules: %v", err)
+		}
+		scenarioRules = rules
+	}
+
+	var chaosRules []mocktrans.ChaosRule
+	if chaosRulesFile, ok := os.LookupEnv("CHAOS_RULES_FILE"); ok {
+		rules, err := mocktrans.LoadChaosRules(chaosRulesFile)
+		if err != nil {
+			log.Fatalf("failed to load chaos rules: %v", err)
+		}
+		chaosRules = rules
+	}
+
+	var webhookFaultRules []mocktrans.WebhookFaultRule
+	if webhookFaultsFile, ok := os.LookupEnv("WEBHOOK_FAULTS_FILE"); ok {
+		rules, err := mocktrans.LoadWebhookFaultRules(webhookFaultsFile)
+		if err != nil {
+			log.Fatalf("failed to load webhook fault rules: %v", err)
+		}
+		webhookFaultRules = rules
+	}
+
+	// A response that a scenario or chaos delays must still be written in time. Chaos rules
+	// change while Mocktrans runs, so the most that they may delay is what counts for them.
+	var scenarioLatency time.Duration
+	for _, rule := range scenarioRules {
+		if latency := time.Duration(rule.Latency); latency > scenarioLatency {
+			scenarioLatency = latency
+		}
+	}
+	writeTimeout := time.Second*5 + scenarioLatency + mocktrans.MaxChaosLatency
+
+	// "mocktrans seed [file]" seeds the database and exits, where SEED_FILE seeds an empty
+	// database at boot. The merchants of a seed file are configuration, needed on every boot.
+	seedCommand := len(os.Args) > 1 && os.Args[1] == "seed"
+	seedFile := os.Getenv("SEED_FILE")
+	if seedCommand && len(os.Args) > 2 {
+		seedFile = os.Args[2]
+	}
+	if seedCommand && seedFile == "" {
+		log.Fatalf("seed needs a seed file, either as an argument or as SEED_FILE")
+	}
+
+	var seed mocktrans.Seed
+	if seedFile != "" {
+		loaded, err := mocktrans.LoadSeed(seedFile)
+		if err != nil {
+			log.Fatalf("failed to load seed: %v", err)
+		}
+		seed = loaded
+
+		merchants = append(merchants, seed.Merchants...)
+		err = mocktrans.ValidateMerchants(merchants)
+		if err != nil {
+			log.Fatalf("invalid seed merchants: %v", err)
+		}
+	}
+
+	// Keys of the other environment would be refused on every request, so an explicit
+	// MIDTRANS_ENVIRONMENT refuses to start with them instead
+	if environmentSet {
+		err := mocktrans.ValidateMerchantEnvironment(merchants, production)
+		if err != nil {
+			log.Fatalf("merchants do not match MIDTRANS_ENVIRONMENT: %v", err)
+		}
+	}
+
+	// The memory storage needs no database, everything is lost when Mocktrans stops
+	storage := mocktrans.NewMemoryStorage()
+	if databaseProvider != "memory" {
+		db, err := sql.Open(databaseProvider, databaseUrl)
+		if err != nil {
+			log.Fatalf("failed to open database: %v", err)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				log.Printf("failed to close database: %v", err)
+			}
+		}()
+
+		var maximumOpenConns int = 20
+		var maximumIdleConns int = 5
+
+		if databaseProvider == "sqlite3" || databaseProvider == "sqlite" {
+			maximumOpenConns = 1
+			maximumIdleConns = 1
+		}
+
+		db.SetConnMaxLifetime(time.Second * 60)
+		db.SetMaxOpenConns(maximumOpenConns)
+		db.SetMaxIdleConns(maximumIdleConns)
+
+		storage = mocktrans.NewSQLStorage(db, databaseProvider)
+	}
+
+	dependencies := &mocktrans.Dependencies{
+		Storage:         storage,
+		Clock:           mocktrans.SystemClock{},
+		Merchants:       merchants,
+		PublicUrl:       strings.TrimSuffix(publicUrl, "/"),
+		SnapFinishUrl:   snapFinishUrl,
+		SnapUnfinishUrl: snapUnfinishUrl,
+		SnapErrorUrl:    snapErrorUrl,
+		FraudRules:      fraudRules,
+		ScenarioRules:   scenarioRules,
+		StrictMode:      strictMode,
+		Production:      production,
+		AdminKey:        adminKey,
+		Snapshots:       mocktrans.NewSnapshotStore(),
+
+		IrisCreatorKey:     irisCreatorKey,
+		IrisApproverKey:    irisApproverKey,
+		IrisMerchantKey:    irisMerchantKey,
+		IrisCallbackUrl:    irisCallbackUrl,
+		IrisInitialBalance: irisInitialBalance,
+	}
+
+	err := dependencies.SetChaosRules(chaosRules)
+	if err != nil {
+		log.Fatalf("failed to set chaos rules: %v", err)
+	}
+
+	err = dependencies.SetWebhookFaultRules(webhookFaultRules)
+	if err != nil {
+		log.Fatalf("failed to set webhook fault rules: %v", err)
+	}
+
+	migrationCtx, migrationCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer migrationCancel()
+
+	err = dependencies.MigrateSchema(migrationCtx)
+	if err != nil {
+		log.Fatalf("failed to migrate schema: %v", err)
+	}
+
+	if seedFile != "" {
+		seedCtx, seedCancel := context.WithTimeout(context.Background(), time.Minute)
+		defer seedCancel()
+
+		// Seeding at every boot would duplicate the data of a database that is kept around
+		empty := true
+		if !seedCommand {
+			empty, err = dependencies.StorageIsEmpty(seedCtx)
+			if err != nil {
+				log.Fatalf("failed to check for existing data: %v", err)
+			}
+		}
+
+		if empty {
+			err = dependencies.SeedData(seedCtx, seed)
+			if err != nil {
+				log.Fatalf("failed to seed database: %v", err)
+			}
+			log.Printf("seeded the database from %s", seedFile)
+		}
+
+		if seedCommand {
+			return
+		}
+	}
+
+	server := &http.Server{
+		Handler:      dependencies.Router(),
+		Addr:         ":" + port,
+		ReadTimeout:  time.Second * 5,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  time.Second * 15,
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, os.Kill)
+
+	go func() {
+		log.Printf("Server started on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listening server: %s\n", err)
+		}
+	}()
+
+	schedulerCtx, schedulerCancel := context.WithCancel(context.Background())
+	defer schedulerCancel()
+
+	go dependencies.RunSubscriptionScheduler(schedulerCtx, subscriptionSchedulerInterval)
+	go dependencies.RunScenarioTransitions(schedulerCtx, time.Second)
+
+	<-sig
+
+	schedulerCancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Fatalf("server shutdown: %s\n", err)
+	}
+}
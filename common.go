@@ -1,4 +1,4 @@
-package main
+package mocktrans
 
 import "time"
 
@@ -21,11 +21,15 @@ const (
 	ErrorCannotModify        ErrorStatusCode = 412
 	ErrorSyntaxInBody        ErrorStatusCode = 413
 	ErrorRefundRejected      ErrorStatusCode = 414
+	ErrorInternal            ErrorStatusCode = 500
 )
 
 type TransactionDetail struct {
 	OrderId     string `json:"order_id"`
 	GrossAmount int64  `json:"gross_amount"`
+	// PaymentLinkId is set by Mocktrans on the purchases of a payment link, it can
+	// not come from a request, or any charge could use up the link's usage_limit.
+	PaymentLinkId string `json:"-"`
 }
 
 type BankTransfer struct {
@@ -53,6 +57,7 @@ type CustomerDetail struct {
 type CustomerAddress struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
 	Phone       string `json:"phone"`
 	Address     string `json:"address"`
 	City        string `json:"city"`
@@ -100,11 +105,29 @@ type Action struct {
 }
 
 type Gopay struct {
-	EnableCallback     bool   `json:"enable_callback"`
-	CallbackUrl        string `json:"callback_url"`
-	AccountId          string `json:"account_id"`
-	PaymentOptionToken string `json:"payment_option_token"`
-	Recurring          bool   `json:"recurring"`
+	EnableCallback     bool     `json:"enable_callback"`
+	CallbackUrl        string   `json:"callback_url"`
+	AccountId          string   `json:"account_id"`
+	PaymentOptionToken string   `json:"payment_option_token"`
+	PreAuth            bool     `json:"pre_auth"`
+	Recurring          bool     `json:"recurring"`
+	PromotionIds       []string `json:"promotion_ids"`
+	// Tokenization, PhoneNumber and CountryCode link the account on the Snap page.
+	Tokenization bool   `json:"tokenization"`
+	PhoneNumber  string `json:"phone_number"`
+	CountryCode  string `json:"country_code"`
+}
+
+// Echannel is the Mandiri Bill payment, paid with the bill key and the biller code.
+type Echannel struct {
+	BillInfo1 string `json:"bill_info1"`
+	BillInfo2 string `json:"bill_info2"`
+	BillInfo3 string `json:"bill_info3,omitempty"`
+	BillInfo4 string `json:"bill_info4,omitempty"`
+	BillInfo5 string `json:"bill_info5,omitempty"`
+	BillInfo6 string `json:"bill_info6,omitempty"`
+	BillInfo7 string `json:"bill_info7,omitempty"`
+	BillInfo8 string `json:"bill_info8,omitempty"`
 }
 
 type Qris struct {
@@ -115,6 +138,48 @@ type Shopeepay struct {
 	CallbackUrl string `json:"callback_url"`
 }
 
+type BcaKlikpay struct {
+	// Only 1 (full transfer) is supported.
+	Type        int32  `json:"type"`
+	Description string `json:"description"`
+	MiscFee     int64  `json:"misc_fee"`
+}
+
+type BcaKlikbca struct {
+	Description string `json:"description"`
+	// KlikBCA User ID, maximum 12 characters.
+	UserId string `json:"user_id"`
+}
+
+type CimbClicks struct {
+	Description string `json:"description"`
+}
+
+type Cstore struct {
+	// Possible values are alfamart or indomaret.
+	Store   string `json:"store"`
+	Message string `json:"message"`
+	// Printed on Alfamart receipts, maximum 40 characters each.
+	AlfamartFreeText1 string `json:"alfamart_free_text_1"`
+	AlfamartFreeText2 string `json:"alfamart_free_text_2"`
+	AlfamartFreeText3 string `json:"alfamart_free_text_3"`
+}
+
+type UobEzpay struct {
+	// CallbackUrl is where UOB sends the customer back to after paying, required.
+	CallbackUrl string `json:"callback_url"`
+}
+
+type BriEpay struct {
+	// CallbackUrl is where BRI sends the customer back to after paying.
+	CallbackUrl string `json:"callback_url"`
+}
+
+type DanamonOnline struct {
+	// CallbackUrl is where Danamon sends the customer back to after paying.
+	CallbackUrl string `json:"callback_url"`
+}
+
 type CreditCard struct {
 	TokenId         string   `json:"token_id"`
 	Bank            string   `json:"bank"`
@@ -122,11 +187,37 @@ type CreditCard struct {
 	Bins            []string `json:"bins"`
 	Type            string   `json:"type"`
 	SaveTokenId     bool     `json:"save_token_id"`
+	// Authentication asks for 3D Secure, and CallbackType is how its result comes back,
+	// js_event or form.
+	Authentication bool   `json:"authentication"`
+	CallbackType   string `json:"callback_type"`
+
+	// The fields below are the ones of the Snap credit_card object.
+	Secure            bool                  `json:"secure"`
+	Channel           string                `json:"channel"`
+	SaveCard          bool                  `json:"save_card"`
+	WhitelistBins     []string              `json:"whitelist_bins"`
+	Installment       CreditCardInstallment `json:"installment"`
+	DynamicDescriptor DynamicDescriptor     `json:"dynamic_descriptor"`
+}
+
+type CreditCardInstallment struct {
+	Required bool `json:"required"`
+	// Terms are the installment terms that every bank offers, as in {"bni": [3, 6, 12]}.
+	Terms map[string][]int32 `json:"terms"`
+}
+
+// DynamicDescriptor is what the customer's card statement shows for the transaction.
+type DynamicDescriptor struct {
+	MerchantName string `json:"merchant_name"`
+	CityName     string `json:"city_name"`
+	CountryCode  string `json:"country_code"`
 }
 
 type CustomExpiry struct {
-	OrderTime      time.Time `json:"order_time"`
-	ExpiryDuration int64     `json:"expiry_duration"`
+	// Formatted as "2006-01-02 15:04:05 -0700", defaults to the time the transaction is created.
+	OrderTime      string `json:"order_time"`
+	ExpiryDuration int64  `json:"expiry_duration"`
 	// Possible values are second, minute, hour or day.
 	// Default value is minute.
 	Unit string `json:"unit"`
@@ -135,18 +226,23 @@ type CustomExpiry struct {
 type NotificationRequest struct {
 	CreditCardNotification
 	VirtualAccountNotification
-	TransactionTime   string `json:"transaction_time"`
-	TransactionStatus string `json:"transaction_status"`
-	TransactionId     string `json:"transaction_id"`
-	StatusMessage     string `json:"status_message"`
-	StatusCode        string `json:"status_code"`
-	SignatureKey      string `json:"signature_key"`
-	PaymentType       string `json:"payment_type"`
-	OrderId           string `json:"order_id"`
-	MerchantId        string `json:"merchant_id"`
-	GrossAmount       string `json:"gross_amount"`
-	FraudStatus       string `json:"fraud_status"`
-	Currency          string `json:"currency"`
+	TransactionTime   string                 `json:"transaction_time"`
+	TransactionStatus string                 `json:"transaction_status"`
+	TransactionId     string                 `json:"transaction_id"`
+	StatusMessage     string                 `json:"status_message"`
+	StatusCode        string                 `json:"status_code"`
+	SignatureKey      string                 `json:"signature_key"`
+	PaymentType       string                 `json:"payment_type"`
+	OrderId           string                 `json:"order_id"`
+	MerchantId        string                 `json:"merchant_id"`
+	GrossAmount       string                 `json:"gross_amount"`
+	FraudStatus       string                 `json:"fraud_status"`
+	Currency          string                 `json:"currency"`
+	PaymentLinkId     string                 `json:"payment_link_id,omitempty"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	CustomField1      string                 `json:"custom_field1,omitempty"`
+	CustomField2      string                 `json:"custom_field2,omitempty"`
+	CustomField3      string                 `json:"custom_field3,omitempty"`
 }
 
 type CreditCardNotification struct {
@@ -165,7 +261,8 @@ type VirtualAccountNumbers struct {
 }
 
 type VirtualAccountNotification struct {
-	VaNumbers      []VirtualAccountNumbers `json:"va_numbers,omitempty"`
-	SettlementTime string                  `json:"settlement_time,omitempty"`
-	PaymentAmounts []string                `json:"payment_amounts,omitempty"`
+	VaNumbers       []VirtualAccountNumbers `json:"va_numbers,omitempty"`
+	PermataVaNumber string                  `json:"permata_va_number,omitempty"`
+	SettlementTime  string                  `json:"settlement_time,omitempty"`
+	PaymentAmounts  []string                `json:"payment_amounts,omitempty"`
 }
@@ -1,7 +1,9 @@
-package main
+package mocktrans
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -13,9 +15,73 @@ func (d *Dependencies) Confirm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Confirm the transaction
+	var transaction Transaction
+	var err error
+	switch r.URL.Query().Get("action") {
+	case "", "settle":
+		transaction, err = d.updateTransactionToPaid(r.Context(), transactionId)
+	case "deny":
+		transaction, err = d.updateTransactionToDenied(r.Context(), transactionId)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTransactionNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, ErrTransactionCannotModify):
+			w.WriteHeader(int(ErrorCannotModify))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The simulator page hands the result over to snap.js
+	result, err := d.snapResult(r.Context(), transaction)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (d *Dependencies) updateTransactionToPaid(ctx context.Context, transactionId string) (Transaction, error) {
+	return d.updatePendingTransaction(ctx, transactionId, TransactionStatusSettlement)
+}
+
+func (d *Dependencies) updateTransactionToDenied(ctx context.Context, transactionId string) (Transaction, error) {
+	return d.updatePendingTransaction(ctx, transactionId, TransactionStatusDeny)
 }
 
-func (d *Dependencies) updateTransactionToPaid(ctx context.Context, transactionId string) error {
+// updatePendingTransaction moves a pending transaction into its final status
+// and notifies the merchant about it.
+func (d *Dependencies) updatePendingTransaction(ctx context.Context, transactionId string, status TransactionStatus) (Transaction, error) {
+	transaction, err := d.Storage.getTransaction(ctx, transactionId)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if transaction.TransactionStatus != TransactionStatusPending {
+		return Transaction{}, ErrTransactionCannotModify
+	}
+
+	// The customer may confirm twice at once, or the transaction may expire meanwhile
+	err = d.Storage.updateTransactionStatusFrom(ctx, transaction.Id, TransactionStatusPending, status, transaction.FraudStatus, d.Clock.Now())
+	if err != nil {
+		if errors.Is(err, ErrTransactionStatusChanged) {
+			return Transaction{}, ErrTransactionCannotModify
+		}
+
+		return Transaction{}, err
+	}
+
+	transaction.TransactionStatus = status
 
-	return nil
+	d.Notify(transaction)
+	return transaction, nil
 }
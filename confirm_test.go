@@ -0,0 +1,38 @@
+package mocktrans
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentConfirm(t *testing.T) {
+	d, transaction := newRaceDependencies(t, 2)
+	defer d.WaitForNotifications()
+
+	// Paying and denying on the simulator page at the same time, only one of them can happen
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, update := range []func(context.Context, string) (Transaction, error){d.updateTransactionToPaid, d.updateTransactionToDenied} {
+		wg.Add(1)
+		go func(i int, update func(context.Context, string) (Transaction, error)) {
+			defer wg.Done()
+			_, errs[i] = update(context.Background(), transaction.Id)
+		}(i, update)
+	}
+	wg.Wait()
+
+	var succeeded int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrTransactionCannotModify):
+			t.Fatalf("expected the losing confirmation to be refused, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one confirmation to succeed, got %d", succeeded)
+	}
+}
@@ -0,0 +1,36 @@
+package mocktrans
+
+import "context"
+
+// The methods in this file drive Mocktrans from Go, the way the admin API does over HTTP,
+// for programs that embed it, such as the mocktranstest package.
+
+// FindTransaction finds a transaction by either its transaction ID or its order ID.
+func (d *Dependencies) FindTransaction(ctx context.Context, id string) (Transaction, error) {
+	return d.Storage.getTransaction(ctx, id)
+}
+
+// ListNotifications lists every notification that was sent, oldest first, including the ones
+// that failed to be delivered. An empty transactionId lists the notifications of every transaction.
+func (d *Dependencies) ListNotifications(ctx context.Context, transactionId string) ([]WebhookAttempt, error) {
+	return d.Storage.listWebhookAttempts(ctx, transactionId)
+}
+
+// WaitForNotifications blocks until every notification that is being sent has been
+// delivered, or has failed to be, retries included.
+func (d *Dependencies) WaitForNotifications() {
+	d.notifying.wait()
+}
+
+// ResetData deletes every transaction and everything else that was created through the API.
+// The scenario transitions and the held notifications of the transactions go with them.
+func (d *Dependencies) ResetData(ctx context.Context) error {
+	err := d.Storage.reset(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.clearScenarioTransitions()
+	d.dropHeldNotifications()
+	return nil
+}
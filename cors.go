@@ -0,0 +1,31 @@
+package mocktrans
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Cors allows browsers to call the Snap routes from any origin, so frontends
+// that load snap.js can be tested against it. Browsers do not send cookies or
+// other credentials along, and the rest of Mocktrans is left alone.
+func (d *Dependencies) Cors(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") == "" || !strings.HasPrefix(r.URL.Path, "/snap/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		// Preflight request
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,477 @@
+package mocktrans
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const dashboardStyle = `<style>` + pollenStyle + `
+
+		.container {
+			width: 100%;
+			max-width: var(--width-xl);
+			margin: 0 auto;
+			font-family: var(--font-sans);
+		}
+
+		header {
+			padding: 1rem;
+			background-color: var(--color-blue-700);
+			color: var(--color-grey-50);
+			font-weight: var(--weight-bold);
+		}
+
+		header a {
+			color: var(--color-grey-50);
+			text-decoration: none;
+		}
+
+		h1 {
+			font-size: var(--scale-3);
+			font-weight: var(--weight-bold);
+			padding-top: 1rem;
+		}
+
+		h2 {
+			font-size: var(--scale-2);
+			font-weight: var(--weight-semibold);
+			padding-top: 1rem;
+		}
+
+		form.filters {
+			display: flex;
+			flex-wrap: wrap;
+			gap: 0.5rem;
+			align-items: end;
+			padding: 1rem 0;
+		}
+
+		form.filters label {
+			display: flex;
+			flex-direction: column;
+			font-size: var(--scale-00);
+		}
+
+		table {
+			width: 100%;
+			border-collapse: collapse;
+		}
+
+		th, td {
+			padding: 0.5rem;
+			border-bottom: 1px solid var(--color-grey-200);
+			text-align: left;
+			vertical-align: top;
+		}
+
+		button {
+			padding: 0.5rem;
+			border: none;
+			background-color: var(--color-blue-700);
+			color: var(--color-grey-50);
+		}
+
+		button:hover {
+			cursor: pointer;
+		}
+
+		form.action {
+			display: inline-block;
+		}
+
+		pre {
+			white-space: pre-wrap;
+			word-break: break-all;
+		}
+	</style>`
+
+const dashboardTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans Dashboard - Dummy Midtrans for Development purposes</title>
+
+	` + dashboardStyle + `
+</head>
+
+<body>
+	<div class="container">
+		<header><a href="/dashboard">Mocktrans Dashboard</a></header>
+		<h1>Transactions</h1>
+
+		<form class="filters" method="GET" action="/dashboard">
+			<label>Merchant
+				<select name="merchant_id">
+{{merchant_options}}
+				</select>
+			</label>
+			<label>Status
+				<select name="status">
+{{status_options}}
+				</select>
+			</label>
+			<label>Payment type
+				<select name="payment_type">
+{{payment_type_options}}
+				</select>
+			</label>
+			<label>Order ID
+				<input type="text" name="order_id" value="{{order_id}}">
+			</label>
+			<label>From
+				<input type="date" name="from" value="{{from}}">
+			</label>
+			<label>To
+				<input type="date" name="to" value="{{to}}">
+			</label>
+			<button>Filter</button>
+		</form>
+
+		<table>
+			<thead>
+				<tr>
+					<th>Transaction time</th>
+					<th>Order ID</th>
+					<th>Payment type</th>
+					<th>Amount</th>
+					<th>Status</th>
+					<th>Fraud status</th>
+				</tr>
+			</thead>
+			<tbody>
+{{transaction_rows}}
+			</tbody>
+		</table>
+		<p>Showing the latest {{limit}} matching transactions.</p>
+	</div>
+</body>
+
+</html>`
+
+const dashboardTransactionTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans Dashboard - Dummy Midtrans for Development purposes</title>
+
+	` + dashboardStyle + `
+</head>
+
+<body>
+	<div class="container">
+		<header><a href="/dashboard?merchant_id={{merchant_id_query}}">Mocktrans Dashboard</a></header>
+		<h1>Order {{order_id}}</h1>
+		<p>{{action_result}}</p>
+
+		<table>
+			<tbody>
+				<tr><th>Transaction ID</th><td>{{transaction_id}}</td></tr>
+				<tr><th>Merchant ID</th><td>{{merchant_id}}</td></tr>
+				<tr><th>Payment type</th><td>{{payment_type}}</td></tr>
+				<tr><th>Amount</th><td>IDR {{gross_amount}}</td></tr>
+				<tr><th>Status</th><td>{{transaction_status}}</td></tr>
+				<tr><th>Fraud status</th><td>{{fraud_status}}</td></tr>
+				<tr><th>Transaction time</th><td>{{transaction_time}}</td></tr>
+			</tbody>
+		</table>
+
+		<div>
+{{action_buttons}}
+		</div>
+
+		<h2>Status history</h2>
+		<table>
+			<thead>
+				<tr>
+					<th>Time</th>
+					<th>Status</th>
+					<th>Fraud status</th>
+				</tr>
+			</thead>
+			<tbody>
+{{history_rows}}
+			</tbody>
+		</table>
+
+		<h2>Virtual accounts</h2>
+		<table>
+			<thead>
+				<tr>
+					<th>Bank</th>
+					<th>VA number</th>
+				</tr>
+			</thead>
+			<tbody>
+{{virtual_account_rows}}
+			</tbody>
+		</table>
+
+		<h2>Notifications</h2>
+		<table>
+			<thead>
+				<tr>
+					<th>Time</th>
+					<th>Status</th>
+					<th>Delivered</th>
+					<th>Payload</th>
+				</tr>
+			</thead>
+			<tbody>
+{{webhook_rows}}
+			</tbody>
+		</table>
+	</div>
+</body>
+
+</html>`
+
+// dashboardDateLayout is the format of the date inputs, which are dates in Western Indonesian Time.
+const dashboardDateLayout = "2006-01-02"
+
+// Dashboard lists the transactions of a merchant, like the transactions page of the Midtrans dashboard.
+func (d *Dependencies) Dashboard(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	merchant := d.merchant(query.Get("merchant_id"))
+
+	filter := TransactionFilter{
+		MerchantId:        merchant.MerchantId,
+		TransactionStatus: TransactionStatus(query.Get("status")),
+		PaymentType:       query.Get("payment_type"),
+		OrderId:           query.Get("order_id"),
+		Limit:             100,
+	}
+
+	if from := query.Get("from"); from != "" {
+		createdFrom, err := time.ParseInLocation(dashboardDateLayout, from, transactionTimeLocation)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		filter.CreatedFrom = createdFrom
+	}
+
+	// The to date is inclusive, so everything before the next day matches
+	if to := query.Get("to"); to != "" {
+		createdUntil, err := time.ParseInLocation(dashboardDateLayout, to, transactionTimeLocation)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		filter.CreatedUntil = createdUntil.AddDate(0, 0, 1)
+	}
+
+	transactions, err := d.Storage.listTransactions(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var merchantIds []string
+	for _, m := range d.Merchants {
+		merchantIds = append(merchantIds, m.MerchantId)
+	}
+
+	statuses := []string{"", string(TransactionStatusPending), string(TransactionStatusCapture), string(TransactionStatusSettlement), string(TransactionStatusDeny), string(TransactionStatusCancel), string(TransactionStatusExpire), string(TransactionStatusRefund)}
+
+	var transactionRows strings.Builder
+	for _, transaction := range transactions {
+		transactionRows.WriteString(`				<tr>` +
+			`<td>` + transaction.TransactionTime() + `</td>` +
+			`<td><a href="` + html.EscapeString(d.dashboardTransactionUrl(transaction.Id)) + `">` + html.EscapeString(transaction.OrderId) + `</a></td>` +
+			`<td>` + html.EscapeString(transaction.PaymentType) + `</td>` +
+			`<td>` + transaction.FormattedGrossAmount() + `</td>` +
+			`<td>` + string(transaction.TransactionStatus) + `</td>` +
+			`<td>` + string(transaction.FraudStatus) + `</td>` +
+			"</tr>\n")
+	}
+
+	if len(transactions) == 0 {
+		transactionRows.WriteString("				<tr><td colspan=\"6\">No transactions found.</td></tr>\n")
+	}
+
+	// Render the template
+	replacer := strings.NewReplacer(
+		"{{merchant_options}}", dashboardOptions(merchantIds, merchant.MerchantId),
+		"{{status_options}}", dashboardOptions(statuses, string(filter.TransactionStatus)),
+		"{{payment_type_options}}", dashboardOptions(append([]string{""}, paymentTypes...), filter.PaymentType),
+		"{{order_id}}", html.EscapeString(filter.OrderId),
+		"{{from}}", html.EscapeString(query.Get("from")),
+		"{{to}}", html.EscapeString(query.Get("to")),
+		"{{transaction_rows}}", transactionRows.String(),
+		"{{limit}}", "100",
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(dashboardTemplate)))
+}
+
+// DashboardTransaction shows everything that happened to a transaction, and lets the
+// tester do what would otherwise be done by the bank or on the Midtrans dashboard.
+func (d *Dependencies) DashboardTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction, err := d.Storage.getTransaction(r.Context(), chi.URLParam(r, "transactionId"))
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history, err := d.Storage.listTransactionStatusHistory(r.Context(), transaction.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	virtualAccounts, err := d.Storage.listVirtualAccounts(r.Context(), transaction.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	attempts, err := d.Storage.listWebhookAttempts(r.Context(), transaction.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var historyRows strings.Builder
+	for _, change := range history {
+		historyRows.WriteString(`				<tr>` +
+			`<td>` + change.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout) + `</td>` +
+			`<td>` + string(change.TransactionStatus) + `</td>` +
+			`<td>` + string(change.FraudStatus) + `</td>` +
+			"</tr>\n")
+	}
+
+	var virtualAccountRows strings.Builder
+	for _, virtualAccount := range virtualAccounts {
+		virtualAccountRows.WriteString(`				<tr>` +
+			`<td>` + html.EscapeString(virtualAccount.Bank) + `</td>` +
+			`<td>` + html.EscapeString(virtualAccount.VaNumber) + `</td>` +
+			"</tr>\n")
+	}
+
+	if len(virtualAccounts) == 0 {
+		virtualAccountRows.WriteString("				<tr><td colspan=\"2\">None.</td></tr>\n")
+	}
+
+	var webhookRows strings.Builder
+	for _, attempt := range attempts {
+		delivered := "no"
+		if attempt.Success {
+			delivered = "yes"
+		}
+
+		webhookRows.WriteString(`				<tr>` +
+			`<td>` + attempt.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout) + `</td>` +
+			`<td>` + html.EscapeString(attempt.Status) + `</td>` +
+			`<td>` + delivered + `</td>` +
+			`<td><details><summary>Show</summary><pre>` + html.EscapeString(attempt.Data) + `</pre></details></td>` +
+			"</tr>\n")
+	}
+
+	if len(attempts) == 0 {
+		webhookRows.WriteString("				<tr><td colspan=\"4\">No notifications were sent.</td></tr>\n")
+	}
+
+	// Only the actions that the current status allows are offered
+	var actionButtons strings.Builder
+	for _, name := range transactionActionNames {
+		if action, ok := transactionActions[name]; ok && !action.allows(transaction.TransactionStatus) {
+			continue
+		}
+
+		actionButtons.WriteString(`			<form class="action" method="POST" action="` + html.EscapeString(d.dashboardTransactionUrl(transaction.Id)+"/"+name) + `">` +
+			`<button>` + strings.ToUpper(name[:1]) + name[1:] + `</button></form>` + "\n")
+	}
+
+	var actionResult string
+	switch r.URL.Query().Get("result") {
+	case "ok":
+		actionResult = "Done, the merchant is being notified."
+	case "conflict":
+		actionResult = "The transaction can not be changed from its current status."
+	}
+
+	// Render the template
+	replacer := strings.NewReplacer(
+		"{{merchant_id_query}}", html.EscapeString(url.QueryEscape(transaction.MerchantId)),
+		"{{order_id}}", html.EscapeString(transaction.OrderId),
+		"{{action_result}}", actionResult,
+		"{{transaction_id}}", html.EscapeString(transaction.Id),
+		"{{merchant_id}}", html.EscapeString(transaction.MerchantId),
+		"{{payment_type}}", html.EscapeString(transaction.PaymentType),
+		"{{gross_amount}}", transaction.FormattedGrossAmount(),
+		"{{transaction_status}}", string(transaction.TransactionStatus),
+		"{{fraud_status}}", string(transaction.FraudStatus),
+		"{{transaction_time}}", transaction.TransactionTime(),
+		"{{action_buttons}}", actionButtons.String(),
+		"{{history_rows}}", historyRows.String(),
+		"{{virtual_account_rows}}", virtualAccountRows.String(),
+		"{{webhook_rows}}", webhookRows.String(),
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(dashboardTransactionTemplate)))
+}
+
+// DashboardTransactionAction applies an action from the transaction page, then goes back to it.
+func (d *Dependencies) DashboardTransactionAction(w http.ResponseWriter, r *http.Request) {
+	transaction, err := d.ApplyTransactionAction(r.Context(), chi.URLParam(r, "transactionId"), chi.URLParam(r, "action"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTransactionNotFound):
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+		case errors.Is(err, ErrUnknownTransactionAction):
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+		case errors.Is(err, ErrTransactionCannotModify):
+			http.Redirect(w, r, d.dashboardTransactionUrl(chi.URLParam(r, "transactionId"))+"?result=conflict", http.StatusSeeOther)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, d.dashboardTransactionUrl(transaction.Id)+"?result=ok", http.StatusSeeOther)
+}
+
+func (d *Dependencies) dashboardTransactionUrl(transactionId string) string {
+	return d.PublicUrl + "/dashboard/transactions/" + url.PathEscape(transactionId)
+}
+
+// dashboardOptions renders the options of a select, where an empty value stands for any.
+func dashboardOptions(values []string, selected string) string {
+	var options strings.Builder
+	for _, value := range values {
+		label := value
+		if label == "" {
+			label = "Any"
+		}
+
+		attributes := ` value="` + html.EscapeString(value) + `"`
+		if value == selected {
+			attributes += " selected"
+		}
+
+		options.WriteString(`					<option` + attributes + `>` + html.EscapeString(label) + "</option>\n")
+	}
+
+	return options.String()
+}
@@ -0,0 +1,13 @@
+package mocktrans
+
+// directDebitBanks lists the direct debit and internet banking payment types.
+// Every one of them redirects the customer to the bank's page, which is
+// replaced by a simulator page on Mocktrans.
+var directDebitBanks = map[string]simulatorBrand{
+	"bca_klikpay":    {Name: "BCA KlikPay", Color: "#0060af"},
+	"bca_klikbca":    {Name: "KlikBCA", Color: "#0060af"},
+	"bri_epay":       {Name: "BRI e-Pay", Color: "#00529c"},
+	"cimb_clicks":    {Name: "CIMB Clicks", Color: "#7a0a0a"},
+	"danamon_online": {Name: "Danamon Online Banking", Color: "#f47920"},
+	"uob_ezpay":      {Name: "UOB EZ Pay", Color: "#005eb8"},
+}
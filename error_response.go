@@ -0,0 +1,73 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// errorResponse is the body of every failed Core API request.
+type errorResponse struct {
+	StatusCode         string   `json:"status_code"`
+	StatusMessage      string   `json:"status_message"`
+	ValidationMessages []string `json:"validation_messages,omitempty"`
+	Id                 string   `json:"id"`
+}
+
+var errorStatusMessages = map[ErrorStatusCode]string{
+	ErrorValidation:          "One or more parameters in the payload is invalid.",
+	ErrorAccessDenied:        "Access denied due to unauthorized transaction, please check client or server key",
+	ErrorNotFound:            "The requested resource is not found",
+	ErrorDuplicateOrderId:    "The request could not be processed due to duplicate order ID. Order ID has already been utilized previously.",
+	ErrorExpiredTransaction:  "The transaction has expired",
+	ErrorWrongDataType:       "The request cannot be processed due to wrong data type in the request body",
+	ErrorTooManyTransactions: "Merchant has sent too many transactions for the same card number",
+	ErrorCannotModify:        "Transaction status cannot be updated.",
+	ErrorSyntaxInBody:        "The request cannot be processed due to syntax error in the request body",
+	ErrorRefundRejected:      "Refund request is rejected due to merchant's insufficient funds",
+	ErrorInternal:            "Sorry. Our system is recovering from unexpected issues. Please retry.",
+}
+
+// writeErrorResponse writes the error body that Midtrans sends for the status code,
+// with the HTTP status set to the same code.
+func writeErrorResponse(w http.ResponseWriter, statusCode ErrorStatusCode, validationMessages ...string) {
+	writeErrorMessageResponse(w, statusCode, errorStatusMessages[statusCode], validationMessages...)
+}
+
+// writeErrorMessageResponse is writeErrorResponse for the few errors where Midtrans
+// sends a different status_message than the usual one of the status code.
+func writeErrorMessageResponse(w http.ResponseWriter, statusCode ErrorStatusCode, statusMessage string, validationMessages ...string) {
+	// The id is only there for support tickets, it is fine to leave it empty
+	id, err := newId()
+	if err != nil {
+		log.Printf("failed to generate error id: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(statusCode))
+	json.NewEncoder(w).Encode(errorResponse{
+		StatusCode:         strconv.Itoa(int(statusCode)),
+		StatusMessage:      statusMessage,
+		ValidationMessages: validationMessages,
+		Id:                 id,
+	})
+}
+
+// writeStatusErrorResponse writes the error body of any HTTP status code, for the failures
+// that are made up on purpose, such as the ones of the scenario and chaos rules.
+func writeStatusErrorResponse(w http.ResponseWriter, statusCode int) {
+	message, ok := errorStatusMessages[ErrorStatusCode(statusCode)]
+	if !ok {
+		message = http.StatusText(statusCode)
+	}
+
+	writeErrorMessageResponse(w, ErrorStatusCode(statusCode), message)
+}
+
+// writeInternalErrorResponse logs the cause of the unexpected error, which Midtrans
+// would not disclose, and writes the 500 error body.
+func writeInternalErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	writeErrorResponse(w, ErrorInternal)
+}
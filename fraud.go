@@ -0,0 +1,101 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type FraudStatus string
+
+const (
+	FraudStatusAccept    FraudStatus = "accept"
+	FraudStatusChallenge FraudStatus = "challenge"
+	FraudStatusDeny      FraudStatus = "deny"
+)
+
+// FraudRule decides the fraud_status of a charge. Every condition that is set
+// must match for the rule to apply, and a rule without any conditions
+// matches every charge. Rules are evaluated in order, the first one wins.
+type FraudRule struct {
+	FraudStatus FraudStatus `json:"fraud_status"`
+	// Matches when the gross_amount is greater than or equal to this value.
+	MinimumAmount int64 `json:"minimum_amount"`
+	// Matches the domain part of customer_details.email, case insensitive.
+	EmailDomain string `json:"email_domain"`
+	// Matches the first digits of the card number, taken from credit_card.token_id.
+	CardBin string `json:"card_bin"`
+	// Regular expression that is matched against the order_id.
+	OrderIdPattern string `json:"order_id_pattern"`
+
+	orderIdRegexp *regexp.Regexp
+}
+
+// LoadFraudRules reads the fraud rules from a JSON file containing an array of FraudRule.
+func LoadFraudRules(path string) ([]FraudRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fraud rules file: %w", err)
+	}
+
+	var rules []FraudRule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fraud rules file: %w", err)
+	}
+
+	for i := range rules {
+		switch rules[i].FraudStatus {
+		case FraudStatusAccept, FraudStatusChallenge, FraudStatusDeny:
+			break
+		default:
+			return nil, fmt.Errorf("rule %d: unknown fraud_status of %s", i, rules[i].FraudStatus)
+		}
+
+		if rules[i].OrderIdPattern != "" {
+			rules[i].orderIdRegexp, err = regexp.Compile(rules[i].OrderIdPattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid order_id_pattern: %w", i, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+func (f FraudRule) matches(c chargeRequest) bool {
+	if f.MinimumAmount > 0 && c.TransactionDetails.GrossAmount < f.MinimumAmount {
+		return false
+	}
+
+	if f.EmailDomain != "" {
+		_, domain, ok := strings.Cut(c.CustomerDetails.Email, "@")
+		if !ok || !strings.EqualFold(domain, f.EmailDomain) {
+			return false
+		}
+	}
+
+	if f.CardBin != "" && (c.PaymentType != "credit_card" || !strings.HasPrefix(c.CreditCard.TokenId, f.CardBin)) {
+		return false
+	}
+
+	if f.orderIdRegexp != nil && !f.orderIdRegexp.MatchString(c.TransactionDetails.OrderId) {
+		return false
+	}
+
+	return true
+}
+
+// EvaluateFraud returns the fraud status of the first matching rule,
+// or accept if none of them matches.
+func (d *Dependencies) EvaluateFraud(c chargeRequest) FraudStatus {
+	for _, rule := range d.FraudRules {
+		if rule.matches(c) {
+			return rule.FraudStatus
+		}
+	}
+
+	return FraudStatusAccept
+}
@@ -0,0 +1,82 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type fraudReviewResponse struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	TransactionId     string `json:"transaction_id"`
+	OrderId           string `json:"order_id"`
+	MerchantId        string `json:"merchant_id,omitempty"`
+	GrossAmount       string `json:"gross_amount"`
+	Currency          string `json:"currency"`
+	PaymentType       string `json:"payment_type"`
+	TransactionTime   string `json:"transaction_time"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+}
+
+// Approve accepts a transaction that was challenged by the fraud detection system.
+func (d *Dependencies) Approve(w http.ResponseWriter, r *http.Request) {
+	d.reviewChallengedTransaction(w, r, FraudStatusAccept)
+}
+
+// Deny rejects a transaction that was challenged by the fraud detection system.
+func (d *Dependencies) Deny(w http.ResponseWriter, r *http.Request) {
+	d.reviewChallengedTransaction(w, r, FraudStatusDeny)
+}
+
+func (d *Dependencies) reviewChallengedTransaction(w http.ResponseWriter, r *http.Request, decision FraudStatus) {
+	transaction, err := d.Storage.getMerchantTransaction(r.Context(), merchantFromContext(r.Context()).MerchantId, chi.URLParam(r, "orderId"))
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			writeErrorResponse(w, ErrorNotFound)
+			return
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	if transaction.FraudStatus != FraudStatusChallenge {
+		writeErrorResponse(w, ErrorCannotModify)
+		return
+	}
+
+	statusMessage := "Success, transaction is approved"
+	transaction.FraudStatus = decision
+	if decision == FraudStatusDeny {
+		statusMessage = "Success, transaction is denied"
+		transaction.TransactionStatus = TransactionStatusDeny
+	}
+
+	err = d.Storage.updateTransactionStatus(r.Context(), transaction.Id, transaction.TransactionStatus, transaction.FraudStatus, d.Clock.Now())
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fraudReviewResponse{
+		StatusCode:        "200",
+		StatusMessage:     statusMessage,
+		TransactionId:     transaction.Id,
+		OrderId:           transaction.OrderId,
+		MerchantId:        transaction.MerchantId,
+		GrossAmount:       transaction.FormattedGrossAmount(),
+		Currency:          "IDR",
+		PaymentType:       transaction.PaymentType,
+		TransactionTime:   transaction.TransactionTime(),
+		TransactionStatus: string(transaction.TransactionStatus),
+		FraudStatus:       string(transaction.FraudStatus),
+	})
+
+	d.Notify(transaction)
+}
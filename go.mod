@@ -1,4 +1,4 @@
-module mocktrans
+module github.com/aldy505/mocktrans
 
 go 1.18
 
@@ -7,4 +7,5 @@ require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/lib/pq v1.10.6
 	github.com/mattn/go-sqlite3 v1.14.13
+	gopkg.in/yaml.v3 v3.0.1
 )
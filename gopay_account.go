@@ -0,0 +1,552 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrGopayAccountNotFound = errors.New("gopay account not found")
+
+type GopayAccountStatus string
+
+const (
+	GopayAccountStatusPending  GopayAccountStatus = "PENDING"
+	GopayAccountStatusEnabled  GopayAccountStatus = "ENABLED"
+	GopayAccountStatusDisabled GopayAccountStatus = "DISABLED"
+	GopayAccountStatusExpired  GopayAccountStatus = "EXPIRED"
+)
+
+// The activation link has to be opened by the customer within 15 minutes.
+const gopayActivationLifetime = time.Minute * 15
+
+// Every linked account gets the same balances, charges that exceed them are denied.
+const (
+	gopayWalletBalance   int64 = 8000000
+	gopayPayLaterBalance int64 = 5000000
+)
+
+type gopayAccountRequest struct {
+	PaymentType  string       `json:"payment_type"`
+	GopayPartner GopayPartner `json:"gopay_partner"`
+}
+
+type GopayPartner struct {
+	PhoneNumber string `json:"phone_number"`
+	CountryCode string `json:"country_code"`
+	// The customer is sent back here after the activation.
+	RedirectUrl string `json:"redirect_url"`
+}
+
+type gopayAccountResponse struct {
+	StatusCode    string               `json:"status_code"`
+	PaymentType   string               `json:"payment_type"`
+	AccountId     string               `json:"account_id"`
+	AccountStatus string               `json:"account_status"`
+	Actions       []Action             `json:"actions,omitempty"`
+	Metadata      gopayAccountMetadata `json:"metadata"`
+}
+
+type gopayAccountMetadata struct {
+	ReferenceId    string               `json:"reference_id,omitempty"`
+	PaymentOptions []GopayPaymentOption `json:"payment_options,omitempty"`
+}
+
+type GopayPaymentOption struct {
+	Name     string                 `json:"name"`
+	Active   bool                   `json:"active"`
+	Balance  GopayBalance           `json:"balance"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Token    string                 `json:"token"`
+}
+
+type GopayBalance struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+type gopayUnbindResponse struct {
+	StatusCode             string `json:"status_code"`
+	PaymentType            string `json:"payment_type"`
+	AccountId              string `json:"account_id"`
+	AccountStatus          string `json:"account_status"`
+	ChannelResponseCode    string `json:"channel_response_code"`
+	ChannelResponseMessage string `json:"channel_response_message"`
+}
+
+type GopayAccount struct {
+	Id            string
+	MerchantId    string
+	Status        GopayAccountStatus
+	PhoneNumber   string
+	CountryCode   string
+	RedirectUrl   string
+	ReferenceId   string
+	WalletToken   string
+	PayLaterToken string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// LinkGopayAccount starts linking the customer's GoPay account, which the
+// customer finishes on the activation page.
+func (d *Dependencies) LinkGopayAccount(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var req gopayAccountRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code": "400", "status_message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	// Validate request body
+	if reason := req.Validate(); reason != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code": "400", "status_message": ` + strconv.Quote(reason) + `}`))
+		return
+	}
+
+	var ids [4]string
+	for i := range ids {
+		ids[i], err = newId()
+		if err != nil {
+			writeInternalErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	now := d.Clock.Now()
+	account := GopayAccount{
+		Id:            ids[0],
+		MerchantId:    merchantFromContext(r.Context()).MerchantId,
+		Status:        GopayAccountStatusPending,
+		PhoneNumber:   req.GopayPartner.PhoneNumber,
+		CountryCode:   req.GopayPartner.CountryCode,
+		RedirectUrl:   req.GopayPartner.RedirectUrl,
+		ReferenceId:   ids[1],
+		WalletToken:   ids[2],
+		PayLaterToken: ids[3],
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = d.Storage.insertGopayAccount(r.Context(), account)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d.gopayAccountResponse(account))
+}
+
+// GetGopayAccount returns the status of the account, and its payment options once it is linked.
+func (d *Dependencies) GetGopayAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := d.Storage.getGopayAccount(r.Context(), chi.URLParam(r, "accountId"))
+	if err == nil && account.MerchantId != merchantFromContext(r.Context()).MerchantId {
+		err = ErrGopayAccountNotFound
+	}
+	if err != nil {
+		d.writeGopayAccountError(w, r, err)
+		return
+	}
+
+	response := d.gopayAccountResponse(account)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UnbindGopayAccount unlinks the account, after which its payment option tokens are rejected.
+func (d *Dependencies) UnbindGopayAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := d.Storage.getGopayAccount(r.Context(), chi.URLParam(r, "accountId"))
+	if err == nil && account.MerchantId != merchantFromContext(r.Context()).MerchantId {
+		err = ErrGopayAccountNotFound
+	}
+	if err != nil {
+		d.writeGopayAccountError(w, r, err)
+		return
+	}
+
+	if account.Status != GopayAccountStatusEnabled {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status_code": "412", "status_message": "Account is not linked"}`))
+		return
+	}
+
+	err = d.Storage.updateGopayAccountStatus(r.Context(), account.Id, GopayAccountStatusDisabled, d.Clock.Now())
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(gopayUnbindResponse{
+		StatusCode:             "204",
+		PaymentType:            "gopay",
+		AccountId:              account.Id,
+		AccountStatus:          string(GopayAccountStatusDisabled),
+		ChannelResponseCode:    "0",
+		ChannelResponseMessage: "Process service request successfully.",
+	})
+}
+
+func (d *Dependencies) writeGopayAccountError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrGopayAccountNotFound) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status_code": "404", "status_message": "Account doesn't exist."}`))
+		return
+	}
+
+	writeInternalErrorResponse(w, r, err)
+}
+
+func (g gopayAccountRequest) Validate() string {
+	if g.PaymentType != "gopay" {
+		return "payment_type must be gopay"
+	}
+
+	if g.GopayPartner.PhoneNumber == "" {
+		return "gopay_partner.phone_number is required"
+	}
+
+	if _, err := strconv.ParseUint(g.GopayPartner.PhoneNumber, 10, 64); err != nil {
+		return "gopay_partner.phone_number must only contain digits"
+	}
+
+	if g.GopayPartner.CountryCode == "" {
+		return "gopay_partner.country_code is required"
+	}
+
+	return ""
+}
+
+// status returns the account status, with pending accounts that were never activated
+// being expired.
+func (g GopayAccount) status(now time.Time) GopayAccountStatus {
+	if g.Status == GopayAccountStatusPending && now.After(g.CreatedAt.Add(gopayActivationLifetime)) {
+		return GopayAccountStatusExpired
+	}
+
+	return g.Status
+}
+
+func (g GopayAccount) paymentOptions() []GopayPaymentOption {
+	return []GopayPaymentOption{
+		{
+			Name:     "GOPAY_WALLET",
+			Active:   true,
+			Balance:  GopayBalance{Value: Transaction{GrossAmount: gopayWalletBalance}.FormattedGrossAmount(), Currency: "IDR"},
+			Metadata: map[string]interface{}{},
+			Token:    g.WalletToken,
+		},
+		{
+			Name:     "PAY_LATER",
+			Active:   true,
+			Balance:  GopayBalance{Value: Transaction{GrossAmount: gopayPayLaterBalance}.FormattedGrossAmount(), Currency: "IDR"},
+			Metadata: map[string]interface{}{},
+			Token:    g.PayLaterToken,
+		},
+	}
+}
+
+// balance returns the balance of the payment option that the token belongs to,
+// and false if the token is not one of the account's.
+func (g GopayAccount) balance(paymentOptionToken string) (int64, bool) {
+	switch paymentOptionToken {
+	case g.WalletToken:
+		return gopayWalletBalance, true
+	case g.PayLaterToken:
+		return gopayPayLaterBalance, true
+	default:
+		return 0, false
+	}
+}
+
+func (d *Dependencies) gopayAccountResponse(account GopayAccount) gopayAccountResponse {
+	response := gopayAccountResponse{
+		StatusCode:    "201",
+		PaymentType:   "gopay",
+		AccountId:     account.Id,
+		AccountStatus: string(account.status(d.Clock.Now())),
+	}
+
+	switch GopayAccountStatus(response.AccountStatus) {
+	case GopayAccountStatusPending:
+		activationUrl := d.gopayActivationUrl(account.Id)
+		response.Actions = []Action{
+			{Name: "activation-deeplink", Method: "GET", Url: activationUrl},
+			{Name: "activation-link-url", Method: "GET", Url: activationUrl},
+			{Name: "activation-link-app", Method: "GET", Url: activationUrl},
+		}
+		response.Metadata.ReferenceId = account.ReferenceId
+	case GopayAccountStatusEnabled:
+		response.StatusCode = "200"
+		response.Metadata.PaymentOptions = account.paymentOptions()
+	default:
+		response.StatusCode = "204"
+	}
+
+	return response
+}
+
+// chargeGopayToken decides the status of a GoPay charge that is paid with a payment option token.
+// Recurring charges settle straight away, the others wait for the customer's PIN on the simulator page.
+func (d *Dependencies) chargeGopayToken(ctx context.Context, req chargeRequest) (TransactionStatus, error) {
+	account, err := d.Storage.getGopayAccount(ctx, req.Gopay.AccountId)
+	if err != nil {
+		if errors.Is(err, ErrGopayAccountNotFound) {
+			return TransactionStatusDeny, nil
+		}
+
+		return "", err
+	}
+
+	// Accounts are linked to a single merchant
+	if account.MerchantId != req.merchantId || account.status(d.Clock.Now()) != GopayAccountStatusEnabled {
+		return TransactionStatusDeny, nil
+	}
+
+	balance, ok := account.balance(req.Gopay.PaymentOptionToken)
+	if !ok || req.TransactionDetails.GrossAmount > balance {
+		return TransactionStatusDeny, nil
+	}
+
+	if req.Gopay.Recurring {
+		return TransactionStatusSettlement, nil
+	}
+
+	return TransactionStatusPending, nil
+}
+
+func (d *Dependencies) gopayActivationUrl(accountId string) string {
+	return d.PublicUrl + "/gopay/activation/" + accountId
+}
+
+const gopayAccountColumns = `id,
+		COALESCE(merchant_id, ''),
+		status,
+		phone_number,
+		country_code,
+		COALESCE(redirect_url, ''),
+		reference_id,
+		wallet_token,
+		pay_later_token,
+		created_at,
+		updated_at`
+
+func (s *sqlStorage) insertGopayAccount(ctx context.Context, account GopayAccount) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	err = s.insertGopayAccountTx(ctx, tx, account)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// insertGopayAccountTx inserts the account within a database transaction, such as the one that inserts a seed.
+func (s *sqlStorage) insertGopayAccountTx(ctx context.Context, tx *sql.Tx, account GopayAccount) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		gopay_accounts
+		(
+			id,
+			merchant_id,
+			status,
+			phone_number,
+			country_code,
+			redirect_url,
+			reference_id,
+			wallet_token,
+			pay_later_token,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		account.Id,
+		account.MerchantId,
+		account.Status,
+		account.PhoneNumber,
+		account.CountryCode,
+		account.RedirectUrl,
+		account.ReferenceId,
+		account.WalletToken,
+		account.PayLaterToken,
+		account.CreatedAt,
+		account.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert gopay account: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) getGopayAccount(ctx context.Context, accountId string) (GopayAccount, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + gopayAccountColumns + `
+	FROM
+		gopay_accounts
+	WHERE
+		id = $1`)
+	if err != nil {
+		return GopayAccount{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return GopayAccount{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var account GopayAccount
+	err = conn.QueryRowContext(ctx, formattedQuery, accountId).Scan(
+		&account.Id,
+		&account.MerchantId,
+		&account.Status,
+		&account.PhoneNumber,
+		&account.CountryCode,
+		&account.RedirectUrl,
+		&account.ReferenceId,
+		&account.WalletToken,
+		&account.PayLaterToken,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return GopayAccount{}, ErrGopayAccountNotFound
+		}
+
+		return GopayAccount{}, fmt.Errorf("failed to query gopay account: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return GopayAccount{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return account, nil
+}
+
+func (s *sqlStorage) updateGopayAccountStatus(ctx context.Context, accountId string, status GopayAccountStatus, now time.Time) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		gopay_accounts
+	SET
+		status = $1,
+		updated_at = $2
+	WHERE
+		id = $3`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, status, now, accountId)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update gopay account: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
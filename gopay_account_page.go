@@ -0,0 +1,143 @@
+package mocktrans
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const gopayActivationTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans GoPay Activation - Dummy Midtrans for Development purposes</title>
+
+	<style>` + pollenStyle + `
+
+		.container {
+			width: 100%;
+			max-width: var(--width-md);
+			margin: 0 auto;
+			font-family: var(--font-sans);
+		}
+
+		header {
+			padding: 1rem;
+			background-color: #00aed6;
+			color: var(--color-grey-50);
+			font-weight: var(--weight-bold);
+		}
+
+		button {
+			padding: 0.5rem;
+			border: none;
+			background-color: #00aed6;
+			color: var(--color-grey-50);
+		}
+
+		button.secondary {
+			background-color: var(--color-grey-500);
+		}
+
+		button:hover {
+			cursor: pointer;
+		}
+	</style>
+</head>
+
+<body>
+	<div class="container">
+		<header>GoPay</header>
+		<p>Link GoPay account +{{country_code}} {{phone_number}} to the merchant?</p>
+		<p>Account status: {{account_status}}</p>
+
+		<form method="POST" action="{{activation_url}}" style="display: {{form_display}};">
+			<button name="action" value="link">Link</button>
+			<button class="secondary" name="action" value="decline">Decline</button>
+		</form>
+	</div>
+</body>
+
+</html>`
+
+// GopayActivationPage replaces the GoPay app, where the customer agrees to link the account.
+func (d *Dependencies) GopayActivationPage(w http.ResponseWriter, r *http.Request) {
+	account, err := d.Storage.getGopayAccount(r.Context(), chi.URLParam(r, "accountId"))
+	if err != nil {
+		if errors.Is(err, ErrGopayAccountNotFound) {
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := account.status(d.Clock.Now())
+	formDisplay := "none"
+	if status == GopayAccountStatusPending {
+		formDisplay = "block"
+	}
+
+	// Render the template
+	replacer := strings.NewReplacer(
+		"{{country_code}}", html.EscapeString(account.CountryCode),
+		"{{phone_number}}", html.EscapeString(account.PhoneNumber),
+		"{{account_status}}", string(status),
+		"{{activation_url}}", html.EscapeString(d.gopayActivationUrl(account.Id)),
+		"{{form_display}}", formDisplay,
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(gopayActivationTemplate)))
+}
+
+// GopayActivate links or declines the account, then sends the customer back to the merchant.
+func (d *Dependencies) GopayActivate(w http.ResponseWriter, r *http.Request) {
+	account, err := d.Storage.getGopayAccount(r.Context(), chi.URLParam(r, "accountId"))
+	if err != nil {
+		if errors.Is(err, ErrGopayAccountNotFound) {
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if account.status(d.Clock.Now()) != GopayAccountStatusPending {
+		http.Error(w, "Account is not waiting for activation", http.StatusConflict)
+		return
+	}
+
+	var status GopayAccountStatus
+	switch r.FormValue("action") {
+	case "link":
+		status = GopayAccountStatusEnabled
+	case "decline":
+		status = GopayAccountStatusDisabled
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	err = d.Storage.updateGopayAccountStatus(r.Context(), account.Id, status, d.Clock.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirectUrl := account.RedirectUrl
+	if redirectUrl == "" {
+		redirectUrl = d.gopayActivationUrl(account.Id)
+	}
+
+	http.Redirect(w, r, redirectUrl, http.StatusSeeOther)
+}
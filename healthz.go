@@ -1,9 +1,9 @@
-package main
+package mocktrans
 
 import "net/http"
 
 func (d *Dependencies) Healthz(w http.ResponseWriter, r *http.Request) {
-	err := d.DB.PingContext(r.Context())
+	err := d.Storage.ping(r.Context())
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
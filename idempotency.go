@@ -0,0 +1,230 @@
+package mocktrans
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+var ErrIdempotentResponseNotFound = errors.New("idempotent response not found")
+
+// IdempotentResponse is what was sent back the first time that an Idempotency-Key was used.
+// Every merchant has its own Idempotency-Keys.
+type IdempotentResponse struct {
+	MerchantId string
+	Key        string
+	// RequestHash is the SHA-256 of the request body, empty for the responses that
+	// were kept before Mocktrans compared the bodies.
+	RequestHash string
+	StatusCode  int
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// responseRecorder passes the response through, while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency replays the original response of a request that is retried with the
+// same Idempotency-Key header, instead of handling it again. Server errors are not
+// kept, so that those requests can be retried for real. Requests with the same key wait
+// for each other, and a key that is used again with a different body is rejected.
+func (d *Dependencies) Idempotency(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		merchantId := merchantFromContext(r.Context()).MerchantId
+		unlock := d.idempotencyKeys.lock(merchantId + "\x00" + key)
+		defer unlock()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeErrorResponse(w, ErrorSyntaxInBody)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		stored, err := d.Storage.getIdempotentResponse(r.Context(), merchantId, key)
+		if err == nil {
+			if stored.RequestHash != "" && stored.RequestHash != requestHash {
+				writeErrorResponse(w, ErrorValidation, "Idempotency-Key has already been used with a different request body")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		if !errors.Is(err, ErrIdempotentResponseNotFound) {
+			writeInternalErrorResponse(w, r, err)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		h.ServeHTTP(recorder, r)
+
+		if recorder.statusCode == 0 || recorder.statusCode >= 500 {
+			return
+		}
+
+		err = d.Storage.insertIdempotentResponse(r.Context(), IdempotentResponse{
+			MerchantId:  merchantId,
+			Key:         key,
+			RequestHash: requestHash,
+			StatusCode:  recorder.statusCode,
+			Body:        recorder.body.Bytes(),
+			CreatedAt:   d.Clock.Now(),
+		})
+		if err != nil {
+			log.Printf("failed to store response of idempotency key %s: %v", key, err)
+		}
+	})
+}
+
+func (s *sqlStorage) getIdempotentResponse(ctx context.Context, merchantId string, key string) (IdempotentResponse, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		merchant_id,
+		idempotency_key,
+		request_hash,
+		status_code,
+		body,
+		created_at
+	FROM
+		idempotent_responses
+	WHERE
+		merchant_id = $1
+		AND idempotency_key = $2`)
+	if err != nil {
+		return IdempotentResponse{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return IdempotentResponse{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var response IdempotentResponse
+	var body string
+	err = conn.QueryRowContext(ctx, formattedQuery, merchantId, key).Scan(
+		&response.MerchantId,
+		&response.Key,
+		&response.RequestHash,
+		&response.StatusCode,
+		&body,
+		&response.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return IdempotentResponse{}, ErrIdempotentResponseNotFound
+		}
+
+		return IdempotentResponse{}, fmt.Errorf("failed to query idempotent response: %w", err)
+	}
+	response.Body = []byte(body)
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return IdempotentResponse{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return response, nil
+}
+
+func (s *sqlStorage) insertIdempotentResponse(ctx context.Context, response IdempotentResponse) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		idempotent_responses
+		(
+			merchant_id,
+			idempotency_key,
+			request_hash,
+			status_code,
+			body,
+			created_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, response.MerchantId, response.Key, response.RequestHash, response.StatusCode, string(response.Body), response.CreatedAt)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to insert idempotent response: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package mocktrans
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// irisFailedAccount is the account number that does not exist on any bank,
+// account validations of it fail and payouts to it are failed after approval.
+const irisFailedAccount = "9999999999"
+
+type irisErrorResponse struct {
+	ErrorMessage string   `json:"error_message"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+type IrisBank struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+var irisBanks = []IrisBank{
+	{Code: "bca", Name: "Bank Central Asia"},
+	{Code: "bni", Name: "Bank Negara Indonesia"},
+	{Code: "bri", Name: "Bank Rakyat Indonesia"},
+	{Code: "mandiri", Name: "Bank Mandiri"},
+	{Code: "permata", Name: "Bank Permata"},
+	{Code: "cimb", Name: "Bank CIMB Niaga"},
+	{Code: "danamon", Name: "Bank Danamon"},
+	{Code: "bsi", Name: "Bank Syariah Indonesia"},
+	{Code: "gopay", Name: "GoPay"},
+}
+
+func irisBankExists(code string) bool {
+	for _, bank := range irisBanks {
+		if bank.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+type irisNotification struct {
+	ReferenceNo  string `json:"reference_no"`
+	Amount       string `json:"amount"`
+	Status       string `json:"status"`
+	UpdatedAt    string `json:"updated_at"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+type irisRole string
+
+const (
+	irisRoleCreator  irisRole = "creator"
+	irisRoleApprover irisRole = "approver"
+)
+
+type irisRoleKey struct{}
+
+// IrisAuthorization only lets through the requests that are authenticated with the
+// API key of one of the roles. Iris keeps creating and approving payouts separate,
+// so that no single key can move money on its own.
+func (d *Dependencies) IrisAuthorization(roles ...irisRole) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys := map[irisRole]string{
+				irisRoleCreator:  d.IrisCreatorKey,
+				irisRoleApprover: d.IrisApproverKey,
+			}
+
+			for _, role := range roles {
+				if r.Header.Get("Authorization") == "Basic "+base64.StdEncoding.EncodeToString([]byte(keys[role]+":")) {
+					h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), irisRoleKey{}, role)))
+					return
+				}
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+}
+
+func (d *Dependencies) IrisBalance(w http.ResponseWriter, r *http.Request) {
+	balance, err := d.irisBalance(r.Context())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"balance": "` + Transaction{GrossAmount: balance}.FormattedGrossAmount() + `"}`))
+}
+
+func (d *Dependencies) IrisBeneficiaryBanks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]IrisBank{"beneficiary_banks": irisBanks})
+}
+
+// IrisAccountValidation looks up the holder of a bank account. Every account exists
+// and is held by "Test-{account}", except for irisFailedAccount.
+func (d *Dependencies) IrisAccountValidation(w http.ResponseWriter, r *http.Request) {
+	bank := r.URL.Query().Get("bank")
+	account := r.URL.Query().Get("account")
+
+	var errorMessages []string
+	if !irisBankExists(bank) {
+		errorMessages = append(errorMessages, "bank is not supported")
+	}
+
+	if account == "" {
+		errorMessages = append(errorMessages, "account is required")
+	}
+
+	if account == irisFailedAccount {
+		errorMessages = append(errorMessages, "account does not exist")
+	}
+
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when doing account validation", Errors: errorMessages})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"account_name": "Test-" + account,
+		"account_no":   account,
+		"bank_name":    bank,
+	})
+}
+
+// irisSpentStatuses are the statuses of the payouts whose amount has left the balance.
+var irisSpentStatuses = []IrisPayoutStatus{IrisPayoutStatusApproved, IrisPayoutStatusProcessed, IrisPayoutStatusCompleted}
+
+// irisBalance is the starting balance, minus every payout that has been approved and not failed.
+func (d *Dependencies) irisBalance(ctx context.Context) (int64, error) {
+	spent, err := d.Storage.sumIrisPayouts(ctx, irisSpentStatuses...)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.IrisInitialBalance - spent, nil
+}
+
+// sumIrisPayouts adds up the amount of the payouts that are in one of the statuses.
+func (s *sqlStorage) sumIrisPayouts(ctx context.Context, statuses ...IrisPayoutStatus) (int64, error) {
+	formattedQuery, args, err := s.sumIrisPayoutsQuery(statuses)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var spent int64
+	err = conn.QueryRowContext(ctx, formattedQuery, args...).Scan(&spent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query balance: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return 0, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return spent, nil
+}
+
+// sumIrisPayoutsQuery builds the query of sumIrisPayouts, along with its arguments.
+func (s *sqlStorage) sumIrisPayoutsQuery(statuses []IrisPayoutStatus) (string, []any, error) {
+	placeholders := make([]string, len(statuses))
+	args := make([]any, len(statuses))
+	for i, status := range statuses {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = status
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		COALESCE(SUM(amount), 0)
+	FROM
+		iris_payouts
+	WHERE
+		status IN (` + strings.Join(placeholders, ", ") + `)`)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	return formattedQuery, args, nil
+}
+
+// NotifyIris sends the payout status notification to the Iris callback URL, if there is one.
+// Notifications are sent in order, as the payout moves through several statuses at once.
+func (d *Dependencies) NotifyIris(payouts ...IrisPayout) {
+	if d.IrisCallbackUrl == "" {
+		return
+	}
+
+	go func() {
+		for _, payout := range payouts {
+			err := d.sendIrisNotification(payout)
+			if err != nil {
+				log.Printf("failed to send iris notification for payout %s: %v", payout.ReferenceNo, err)
+			}
+		}
+	}()
+}
+
+func (d *Dependencies) sendIrisNotification(payout IrisPayout) error {
+	notification := irisNotification{
+		ReferenceNo:  payout.ReferenceNo,
+		Amount:       Transaction{GrossAmount: payout.Amount}.FormattedGrossAmount(),
+		Status:       string(payout.Status),
+		UpdatedAt:    payout.UpdatedAt.UTC().Format(time.RFC3339),
+		ErrorCode:    payout.ErrorCode,
+		ErrorMessage: payout.ErrorMessage,
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.IrisCallbackUrl, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Iris-Signature is SHA512(body + merchant key)
+	signature := sha512.Sum512(append(payload, []byte(d.IrisMerchantKey)...))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Iris-Signature", hex.EncodeToString(signature[:]))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("callback responded with %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// parseIrisAmount parses the amounts that Iris accepts as strings, like "100000.00".
+func parseIrisAmount(amount string) (int64, bool) {
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if strings.Trim(fraction, "0") != "" {
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+
+	return value, true
+}
@@ -0,0 +1,448 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrIrisBeneficiaryNotFound = errors.New("iris beneficiary not found")
+
+var irisAliasNameRegexp = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+type IrisBeneficiary struct {
+	Name      string    `json:"name"`
+	Account   string    `json:"account"`
+	Bank      string    `json:"bank"`
+	AliasName string    `json:"alias_name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func (d *Dependencies) CreateIrisBeneficiary(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var beneficiary IrisBeneficiary
+	err := d.decodeRequestBody(r, &beneficiary)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when creating beneficiary", Errors: []string{err.Error()}})
+		return
+	}
+
+	// Validate request body
+	errorMessages := beneficiary.Validate()
+	if len(errorMessages) == 0 {
+		_, err := d.Storage.getIrisBeneficiary(r.Context(), beneficiary.AliasName)
+		if err == nil {
+			errorMessages = append(errorMessages, "alias_name has already been taken")
+		} else if !errors.Is(err, ErrIrisBeneficiaryNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+			return
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when creating beneficiary", Errors: errorMessages})
+		return
+	}
+
+	now := d.Clock.Now()
+	beneficiary.CreatedAt = now
+	beneficiary.UpdatedAt = now
+
+	err = d.Storage.insertIrisBeneficiary(r.Context(), beneficiary)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"status": "created"}`))
+}
+
+func (d *Dependencies) ListIrisBeneficiaries(w http.ResponseWriter, r *http.Request) {
+	beneficiaries, err := d.Storage.listIrisBeneficiaries(r.Context())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	if beneficiaries == nil {
+		beneficiaries = []IrisBeneficiary{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(beneficiaries)
+}
+
+// UpdateIrisBeneficiary replaces the beneficiary that is known by the alias name on the URL.
+func (d *Dependencies) UpdateIrisBeneficiary(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	existing, err := d.Storage.getIrisBeneficiary(r.Context(), chi.URLParam(r, "aliasName"))
+	if err != nil {
+		if errors.Is(err, ErrIrisBeneficiaryNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "Beneficiary not found"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	beneficiary := existing
+	err = d.decodeRequestBody(r, &beneficiary)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when updating beneficiary", Errors: []string{err.Error()}})
+		return
+	}
+
+	errorMessages := beneficiary.Validate()
+	if beneficiary.AliasName != existing.AliasName {
+		_, err := d.Storage.getIrisBeneficiary(r.Context(), beneficiary.AliasName)
+		if err == nil {
+			errorMessages = append(errorMessages, "alias_name has already been taken")
+		} else if !errors.Is(err, ErrIrisBeneficiaryNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+			return
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when updating beneficiary", Errors: errorMessages})
+		return
+	}
+
+	beneficiary.UpdatedAt = d.Clock.Now()
+	err = d.Storage.updateIrisBeneficiary(r.Context(), existing.AliasName, beneficiary)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status": "updated"}`))
+}
+
+func (b IrisBeneficiary) Validate() []string {
+	var errorMessages []string
+
+	if b.Name == "" {
+		errorMessages = append(errorMessages, "name is required")
+	}
+
+	if b.Account == "" {
+		errorMessages = append(errorMessages, "account is required")
+	}
+
+	if !irisBankExists(b.Bank) {
+		errorMessages = append(errorMessages, "bank is not supported")
+	}
+
+	if !irisAliasNameRegexp.MatchString(b.AliasName) {
+		errorMessages = append(errorMessages, "alias_name must be up to 20 lowercase alphanumeric characters")
+	}
+
+	if b.Email != "" {
+		if _, err := mail.ParseAddress(b.Email); err != nil {
+			errorMessages = append(errorMessages, "email is invalid")
+		}
+	}
+
+	return errorMessages
+}
+
+const irisBeneficiaryColumns = `name,
+		account,
+		bank,
+		alias_name,
+		COALESCE(email, ''),
+		created_at,
+		updated_at`
+
+func scanIrisBeneficiary(row rowScanner) (IrisBeneficiary, error) {
+	var beneficiary IrisBeneficiary
+	err := row.Scan(
+		&beneficiary.Name,
+		&beneficiary.Account,
+		&beneficiary.Bank,
+		&beneficiary.AliasName,
+		&beneficiary.Email,
+		&beneficiary.CreatedAt,
+		&beneficiary.UpdatedAt,
+	)
+	return beneficiary, err
+}
+
+func (s *sqlStorage) insertIrisBeneficiary(ctx context.Context, beneficiary IrisBeneficiary) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		iris_beneficiaries
+		(
+			name,
+			account,
+			bank,
+			alias_name,
+			email,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		beneficiary.Name,
+		beneficiary.Account,
+		beneficiary.Bank,
+		beneficiary.AliasName,
+		beneficiary.Email,
+		beneficiary.CreatedAt,
+		beneficiary.UpdatedAt,
+	)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to insert iris beneficiary: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) getIrisBeneficiary(ctx context.Context, aliasName string) (IrisBeneficiary, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + irisBeneficiaryColumns + `
+	FROM
+		iris_beneficiaries
+	WHERE
+		alias_name = $1`)
+	if err != nil {
+		return IrisBeneficiary{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return IrisBeneficiary{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	beneficiary, err := scanIrisBeneficiary(conn.QueryRowContext(ctx, formattedQuery, aliasName))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return IrisBeneficiary{}, ErrIrisBeneficiaryNotFound
+		}
+
+		return IrisBeneficiary{}, fmt.Errorf("failed to query iris beneficiary: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return IrisBeneficiary{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return beneficiary, nil
+}
+
+func (s *sqlStorage) listIrisBeneficiaries(ctx context.Context) ([]IrisBeneficiary, error) {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, `SELECT
+		`+irisBeneficiaryColumns+`
+	FROM
+		iris_beneficiaries
+	ORDER BY
+		created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query iris beneficiaries: %w", err)
+	}
+	defer rows.Close()
+
+	var beneficiaries []IrisBeneficiary
+	for rows.Next() {
+		beneficiary, err := scanIrisBeneficiary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan iris beneficiary: %w", err)
+		}
+
+		beneficiaries = append(beneficiaries, beneficiary)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate iris beneficiaries: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return beneficiaries, nil
+}
+
+func (s *sqlStorage) updateIrisBeneficiary(ctx context.Context, aliasName string, beneficiary IrisBeneficiary) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		iris_beneficiaries
+	SET
+		name = $1,
+		account = $2,
+		bank = $3,
+		alias_name = $4,
+		email = $5,
+		updated_at = $6
+	WHERE
+		alias_name = $7`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		beneficiary.Name,
+		beneficiary.Account,
+		beneficiary.Bank,
+		beneficiary.AliasName,
+		beneficiary.Email,
+		beneficiary.UpdatedAt,
+		aliasName,
+	)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update iris beneficiary: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,724 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrIrisPayoutNotFound = errors.New("iris payout not found")
+
+// ErrIrisBalanceInsufficient is returned when the balance can not cover the payouts that are approved.
+var ErrIrisBalanceInsufficient = errors.New("iris balance is not sufficient")
+
+// ErrIrisPayoutNotQueued is returned when a payout was approved or rejected by another request in the meantime.
+var ErrIrisPayoutNotQueued = errors.New("iris payout is no longer queued")
+
+type IrisPayoutStatus string
+
+const (
+	IrisPayoutStatusQueued    IrisPayoutStatus = "queued"
+	IrisPayoutStatusApproved  IrisPayoutStatus = "approved"
+	IrisPayoutStatusRejected  IrisPayoutStatus = "rejected"
+	IrisPayoutStatusProcessed IrisPayoutStatus = "processed"
+	IrisPayoutStatusCompleted IrisPayoutStatus = "completed"
+	IrisPayoutStatusFailed    IrisPayoutStatus = "failed"
+)
+
+type irisPayoutsRequest struct {
+	Payouts []irisPayoutRequest `json:"payouts"`
+}
+
+type irisPayoutRequest struct {
+	BeneficiaryName    string `json:"beneficiary_name"`
+	BeneficiaryAccount string `json:"beneficiary_account"`
+	BeneficiaryBank    string `json:"beneficiary_bank"`
+	BeneficiaryEmail   string `json:"beneficiary_email"`
+	Amount             string `json:"amount"`
+	Notes              string `json:"notes"`
+}
+
+type irisApprovalRequest struct {
+	ReferenceNos []string `json:"reference_nos"`
+	// Iris asks the approver for an OTP, which Mocktrans accepts whatever it is.
+	Otp          string `json:"otp"`
+	RejectReason string `json:"reject_reason"`
+}
+
+type irisPayoutResponse struct {
+	Amount             string `json:"amount"`
+	BeneficiaryName    string `json:"beneficiary_name"`
+	BeneficiaryAccount string `json:"beneficiary_account"`
+	Bank               string `json:"bank"`
+	ReferenceNo        string `json:"reference_no"`
+	Notes              string `json:"notes"`
+	BeneficiaryEmail   string `json:"beneficiary_email"`
+	Status             string `json:"status"`
+	CreatedBy          string `json:"created_by"`
+	CreatedAt          string `json:"created_at"`
+	UpdatedAt          string `json:"updated_at"`
+	ErrorCode          string `json:"error_code,omitempty"`
+	ErrorMessage       string `json:"error_message,omitempty"`
+}
+
+type IrisPayout struct {
+	ReferenceNo        string
+	BeneficiaryName    string
+	BeneficiaryAccount string
+	BeneficiaryBank    string
+	BeneficiaryEmail   string
+	Amount             int64
+	Notes              string
+	Status             IrisPayoutStatus
+	CreatedBy          irisRole
+	ErrorCode          string
+	ErrorMessage       string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (d *Dependencies) CreateIrisPayouts(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var req irisPayoutsRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when creating payouts", Errors: []string{err.Error()}})
+		return
+	}
+
+	// Validate request body
+	errorMessages := req.Validate()
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when creating payouts", Errors: errorMessages})
+		return
+	}
+
+	role, _ := r.Context().Value(irisRoleKey{}).(irisRole)
+	now := d.Clock.Now()
+
+	var total int64 = 0
+	var payouts []IrisPayout
+	for _, payoutRequest := range req.Payouts {
+		referenceNo, err := newId()
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+			return
+		}
+
+		// Validate has made sure that the amount is parseable
+		amount, _ := parseIrisAmount(payoutRequest.Amount)
+		total += amount
+
+		payouts = append(payouts, IrisPayout{
+			ReferenceNo:        strings.ReplaceAll(referenceNo, "-", "")[:20],
+			BeneficiaryName:    payoutRequest.BeneficiaryName,
+			BeneficiaryAccount: payoutRequest.BeneficiaryAccount,
+			BeneficiaryBank:    payoutRequest.BeneficiaryBank,
+			BeneficiaryEmail:   payoutRequest.BeneficiaryEmail,
+			Amount:             amount,
+			Notes:              payoutRequest.Notes,
+			Status:             IrisPayoutStatusQueued,
+			CreatedBy:          role,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+		})
+	}
+
+	balance, err := d.irisBalance(r.Context())
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	if total > balance {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when creating payouts", Errors: []string{"Balance is not sufficient"}})
+		return
+	}
+
+	err = d.Storage.insertIrisPayouts(r.Context(), payouts)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	type createdPayout struct {
+		Status      string `json:"status"`
+		ReferenceNo string `json:"reference_no"`
+	}
+
+	var created []createdPayout
+	for _, payout := range payouts {
+		created = append(created, createdPayout{Status: string(payout.Status), ReferenceNo: payout.ReferenceNo})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string][]createdPayout{"payouts": created})
+}
+
+func (d *Dependencies) GetIrisPayout(w http.ResponseWriter, r *http.Request) {
+	payout, err := d.Storage.getIrisPayout(r.Context(), chi.URLParam(r, "referenceNo"))
+	if err != nil {
+		if errors.Is(err, ErrIrisPayoutNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "Payout not found"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payout.response())
+}
+
+// ApproveIrisPayouts approves the queued payouts, which are then sent to the banks.
+// Payouts to irisFailedAccount fail, every other payout completes straight away.
+func (d *Dependencies) ApproveIrisPayouts(w http.ResponseWriter, r *http.Request) {
+	payouts, _, ok := d.findQueuedIrisPayouts(w, r, "An error occurred when approving payouts")
+	if !ok {
+		return
+	}
+
+	now := d.Clock.Now()
+	approved := make([]IrisPayout, len(payouts))
+	done := make([]IrisPayout, len(payouts))
+	for i, payout := range payouts {
+		approved[i] = payout
+		approved[i].Status = IrisPayoutStatusApproved
+		approved[i].UpdatedAt = now
+
+		done[i] = approved[i]
+		done[i].Status = IrisPayoutStatusCompleted
+		if payout.BeneficiaryAccount == irisFailedAccount {
+			done[i].Status = IrisPayoutStatusFailed
+			done[i].ErrorCode = "001"
+			done[i].ErrorMessage = "Account does not exist"
+		}
+	}
+
+	// The balance covers either every payout or none of them
+	err := d.Storage.approveIrisPayouts(r.Context(), d.IrisInitialBalance, done)
+	if err != nil {
+		if errors.Is(err, ErrIrisBalanceInsufficient) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when approving payouts", Errors: []string{"Balance is not sufficient"}})
+			return
+		}
+
+		if errors.Is(err, ErrIrisPayoutNotQueued) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when approving payouts", Errors: []string{"Only queued payouts can be approved or rejected"}})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+		return
+	}
+
+	for i := range payouts {
+		d.NotifyIris(approved[i], done[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+func (d *Dependencies) RejectIrisPayouts(w http.ResponseWriter, r *http.Request) {
+	payouts, req, ok := d.findQueuedIrisPayouts(w, r, "An error occurred when rejecting payouts")
+	if !ok {
+		return
+	}
+
+	if req.RejectReason == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: "An error occurred when rejecting payouts", Errors: []string{"reject_reason is required"}})
+		return
+	}
+
+	for _, payout := range payouts {
+		payout.Status = IrisPayoutStatusRejected
+		payout.ErrorMessage = req.RejectReason
+		payout.UpdatedAt = d.Clock.Now()
+
+		err := d.Storage.updateIrisPayout(r.Context(), payout)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+			return
+		}
+
+		d.NotifyIris(payout)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+// findQueuedIrisPayouts parses the approval request and looks up its payouts,
+// which must all be waiting for approval. It writes the error response if they are not.
+func (d *Dependencies) findQueuedIrisPayouts(w http.ResponseWriter, r *http.Request, errorMessage string) ([]IrisPayout, irisApprovalRequest, bool) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return nil, irisApprovalRequest{}, false
+	}
+
+	var req irisApprovalRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: errorMessage, Errors: []string{err.Error()}})
+		return nil, irisApprovalRequest{}, false
+	}
+
+	if len(req.ReferenceNos) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: errorMessage, Errors: []string{"reference_nos is required"}})
+		return nil, irisApprovalRequest{}, false
+	}
+
+	var payouts []IrisPayout
+	var errorMessages []string
+	for _, referenceNo := range req.ReferenceNos {
+		payout, err := d.Storage.getIrisPayout(r.Context(), referenceNo)
+		if err != nil {
+			if errors.Is(err, ErrIrisPayoutNotFound) {
+				errorMessages = append(errorMessages, "Payout "+referenceNo+" not found")
+				continue
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"status": "error", "message": ` + strconv.Quote(err.Error()) + `}`))
+			return nil, irisApprovalRequest{}, false
+		}
+
+		if payout.Status != IrisPayoutStatusQueued {
+			errorMessages = append(errorMessages, "Payout "+referenceNo+" is "+string(payout.Status)+", only queued payouts can be approved or rejected")
+			continue
+		}
+
+		payouts = append(payouts, payout)
+	}
+
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(irisErrorResponse{ErrorMessage: errorMessage, Errors: errorMessages})
+		return nil, irisApprovalRequest{}, false
+	}
+
+	return payouts, req, true
+}
+
+func (p irisPayoutsRequest) Validate() []string {
+	var errorMessages []string
+
+	if len(p.Payouts) == 0 {
+		errorMessages = append(errorMessages, "payouts is required")
+	}
+
+	for i, payout := range p.Payouts {
+		prefix := fmt.Sprintf("payouts[%d].", i)
+
+		if payout.BeneficiaryName == "" {
+			errorMessages = append(errorMessages, prefix+"beneficiary_name is required")
+		}
+
+		if payout.BeneficiaryAccount == "" {
+			errorMessages = append(errorMessages, prefix+"beneficiary_account is required")
+		}
+
+		if !irisBankExists(payout.BeneficiaryBank) {
+			errorMessages = append(errorMessages, prefix+"beneficiary_bank is not supported")
+		}
+
+		if payout.BeneficiaryEmail != "" {
+			if _, err := mail.ParseAddress(payout.BeneficiaryEmail); err != nil {
+				errorMessages = append(errorMessages, prefix+"beneficiary_email is invalid")
+			}
+		}
+
+		if _, ok := parseIrisAmount(payout.Amount); !ok {
+			errorMessages = append(errorMessages, prefix+"amount must be a positive whole number")
+		}
+
+		if payout.Notes == "" {
+			errorMessages = append(errorMessages, prefix+"notes is required")
+		}
+
+		if len(payout.Notes) > 100 {
+			errorMessages = append(errorMessages, prefix+"notes must not exceed 100 characters")
+		}
+	}
+
+	return errorMessages
+}
+
+func (p IrisPayout) response() irisPayoutResponse {
+	return irisPayoutResponse{
+		Amount:             Transaction{GrossAmount: p.Amount}.FormattedGrossAmount(),
+		BeneficiaryName:    p.BeneficiaryName,
+		BeneficiaryAccount: p.BeneficiaryAccount,
+		Bank:               p.BeneficiaryBank,
+		ReferenceNo:        p.ReferenceNo,
+		Notes:              p.Notes,
+		BeneficiaryEmail:   p.BeneficiaryEmail,
+		Status:             string(p.Status),
+		CreatedBy:          string(p.CreatedBy),
+		CreatedAt:          p.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:          p.UpdatedAt.UTC().Format(time.RFC3339),
+		ErrorCode:          p.ErrorCode,
+		ErrorMessage:       p.ErrorMessage,
+	}
+}
+
+func (s *sqlStorage) insertIrisPayouts(ctx context.Context, payouts []IrisPayout) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		iris_payouts
+		(
+			reference_no,
+			beneficiary_name,
+			beneficiary_account,
+			beneficiary_bank,
+			beneficiary_email,
+			amount,
+			notes,
+			status,
+			created_by,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	// Payouts of the same request are created all together, or not at all
+	for _, payout := range payouts {
+		_, err = tx.ExecContext(
+			ctx,
+			formattedQuery,
+			payout.ReferenceNo,
+			payout.BeneficiaryName,
+			payout.BeneficiaryAccount,
+			payout.BeneficiaryBank,
+			payout.BeneficiaryEmail,
+			payout.Amount,
+			payout.Notes,
+			payout.Status,
+			payout.CreatedBy,
+			payout.CreatedAt,
+			payout.UpdatedAt,
+		)
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+
+			return fmt.Errorf("failed to insert iris payout: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) getIrisPayout(ctx context.Context, referenceNo string) (IrisPayout, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		reference_no,
+		beneficiary_name,
+		beneficiary_account,
+		beneficiary_bank,
+		COALESCE(beneficiary_email, ''),
+		amount,
+		notes,
+		status,
+		created_by,
+		COALESCE(error_code, ''),
+		COALESCE(error_message, ''),
+		created_at,
+		updated_at
+	FROM
+		iris_payouts
+	WHERE
+		reference_no = $1`)
+	if err != nil {
+		return IrisPayout{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return IrisPayout{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var payout IrisPayout
+	err = conn.QueryRowContext(ctx, formattedQuery, referenceNo).Scan(
+		&payout.ReferenceNo,
+		&payout.BeneficiaryName,
+		&payout.BeneficiaryAccount,
+		&payout.BeneficiaryBank,
+		&payout.BeneficiaryEmail,
+		&payout.Amount,
+		&payout.Notes,
+		&payout.Status,
+		&payout.CreatedBy,
+		&payout.ErrorCode,
+		&payout.ErrorMessage,
+		&payout.CreatedAt,
+		&payout.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return IrisPayout{}, ErrIrisPayoutNotFound
+		}
+
+		return IrisPayout{}, fmt.Errorf("failed to query iris payout: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return IrisPayout{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return payout, nil
+}
+
+func (s *sqlStorage) updateIrisPayout(ctx context.Context, payout IrisPayout) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		iris_payouts
+	SET
+		status = $1,
+		error_code = $2,
+		error_message = $3,
+		updated_at = $4
+	WHERE
+		reference_no = $5`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, payout.Status, payout.ErrorCode, payout.ErrorMessage, payout.UpdatedAt, payout.ReferenceNo)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update iris payout: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// approveIrisPayouts moves the queued payouts to their status after approval, as long as the
+// balance covers them. The balance is checked and the payouts are updated within one database
+// transaction, so that concurrent approvals can not spend the same balance twice.
+func (s *sqlStorage) approveIrisPayouts(ctx context.Context, initialBalance int64, payouts []IrisPayout) error {
+	sumQuery, sumArgs, err := s.sumIrisPayoutsQuery(irisSpentStatuses)
+	if err != nil {
+		return err
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		iris_payouts
+	SET
+		status = $1,
+		error_code = $2,
+		error_message = $3,
+		updated_at = $4
+	WHERE
+		reference_no = $5
+		AND status = $6`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	var spent int64
+	err = tx.QueryRowContext(ctx, sumQuery, sumArgs...).Scan(&spent)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to query balance: %w", err)
+	}
+
+	var total int64
+	for _, payout := range payouts {
+		total += payout.Amount
+	}
+
+	if total > initialBalance-spent {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return ErrIrisBalanceInsufficient
+	}
+
+	for _, payout := range payouts {
+		result, err := tx.ExecContext(ctx, formattedQuery, payout.Status, payout.ErrorCode, payout.ErrorMessage, payout.UpdatedAt, payout.ReferenceNo, IrisPayoutStatusQueued)
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+
+			return fmt.Errorf("failed to update iris payout: %w", err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil || affected == 0 {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to get affected rows: %w", err)
+			}
+
+			return ErrIrisPayoutNotQueued
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package mocktrans
+
+import "sync"
+
+// keyedMutex serializes the work on the same key, such as an order_id, while the work
+// on other keys goes on. A key is forgotten once nobody holds or waits for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+// lock waits until nobody else holds the key, and returns the function that releases it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.holders++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		k.mu.Lock()
+		l.holders--
+		if l.holders == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// counter counts the work that is in progress, like a sync.WaitGroup that may be
+// added to at any time, even while it is waited for.
+type counter struct {
+	mu    sync.Mutex
+	zero  *sync.Cond
+	count int
+}
+
+func (c *counter) add(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count += delta
+	if c.count == 0 && c.zero != nil {
+		c.zero.Broadcast()
+	}
+}
+
+func (c *counter) done() {
+	c.add(-1)
+}
+
+// wait blocks until the count is zero.
+func (c *counter) wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.zero == nil {
+		c.zero = sync.NewCond(&c.mu)
+	}
+
+	for c.count > 0 {
+		c.zero.Wait()
+	}
+}
@@ -0,0 +1,119 @@
+package mocktrans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Merchant is one Midtrans merchant account. Every transaction belongs to the
+// merchant whose server key created it, and its notifications are sent to
+// that merchant's callback URL, signed with that merchant's server key.
+type Merchant struct {
+	MerchantId  string `json:"merchant_id"`
+	ServerKey   string `json:"server_key"`
+	ClientKey   string `json:"client_key"`
+	CallbackUrl string `json:"callback_url"`
+}
+
+// LoadMerchants reads the merchants from a JSON file containing an array of Merchant.
+func LoadMerchants(path string) ([]Merchant, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merchants file: %w", err)
+	}
+
+	var merchants []Merchant
+	err = json.Unmarshal(content, &merchants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse merchants file: %w", err)
+	}
+
+	if len(merchants) == 0 {
+		return nil, fmt.Errorf("merchants file has no merchants")
+	}
+
+	err = ValidateMerchants(merchants)
+	if err != nil {
+		return nil, err
+	}
+
+	return merchants, nil
+}
+
+// ValidateMerchants checks that every merchant can be told apart by its merchant_id and server_key.
+func ValidateMerchants(merchants []Merchant) error {
+	merchantIds := make(map[string]bool)
+	serverKeys := make(map[string]bool)
+	for i, merchant := range merchants {
+		if merchant.MerchantId == "" || merchant.ServerKey == "" {
+			return fmt.Errorf("merchant %d: merchant_id and server_key are required", i)
+		}
+
+		if merchantIds[merchant.MerchantId] {
+			return fmt.Errorf("merchant %d: duplicate merchant_id of %s", i, merchant.MerchantId)
+		}
+
+		if serverKeys[merchant.ServerKey] {
+			return fmt.Errorf("merchant %d: server_key is used by another merchant", i)
+		}
+
+		merchantIds[merchant.MerchantId] = true
+		serverKeys[merchant.ServerKey] = true
+	}
+
+	return nil
+}
+
+// ValidateMerchantEnvironment checks that the keys of every merchant are made for the environment,
+// since Midtrans would not know the keys of the other one.
+func ValidateMerchantEnvironment(merchants []Merchant, production bool) error {
+	environment, serverKeyPrefix, clientKeyPrefix := "sandbox", sandboxServerKeyPrefix, sandboxClientKeyPrefix
+	if production {
+		environment, serverKeyPrefix, clientKeyPrefix = "production", productionServerKeyPrefix, productionClientKeyPrefix
+	}
+
+	for i, merchant := range merchants {
+		if !strings.HasPrefix(merchant.ServerKey, serverKeyPrefix) {
+			return fmt.Errorf("merchant %d: server_key of a %s merchant must start with %s", i, environment, serverKeyPrefix)
+		}
+
+		if merchant.ClientKey != "" && !strings.HasPrefix(merchant.ClientKey, clientKeyPrefix) {
+			return fmt.Errorf("merchant %d: client_key of a %s merchant must start with %s", i, environment, clientKeyPrefix)
+		}
+	}
+
+	return nil
+}
+
+// merchant finds the merchant by its merchant_id. Records of a merchant that is
+// no longer configured fall back to the first merchant.
+func (d *Dependencies) merchant(merchantId string) Merchant {
+	for _, merchant := range d.Merchants {
+		if merchant.MerchantId == merchantId {
+			return merchant
+		}
+	}
+
+	return d.Merchants[0]
+}
+
+func (d *Dependencies) merchantByServerKey(serverKey string) (Merchant, bool) {
+	for _, merchant := range d.Merchants {
+		if merchant.ServerKey == serverKey {
+			return merchant, true
+		}
+	}
+
+	return Merchant{}, false
+}
+
+type merchantKey struct{}
+
+// merchantFromContext returns the merchant that Authorization resolved for the request.
+func merchantFromContext(ctx context.Context) Merchant {
+	merchant, _ := ctx.Value(merchantKey{}).(Merchant)
+	return merchant
+}
@@ -0,0 +1,49 @@
+// Package mocktrans is a mock of the Midtrans API. The mocktrans command serves it
+// on its own, and the mocktranstest package runs it inside Go tests.
+package mocktrans
+
+// Dependencies is everything that the handlers of Mocktrans share. Router serves them.
+type Dependencies struct {
+	Storage Storage
+	Clock   Clock
+	// Merchants is never empty, the first merchant is the default one.
+	Merchants       []Merchant
+	PublicUrl       string
+	SnapFinishUrl   string
+	SnapUnfinishUrl string
+	SnapErrorUrl    string
+	FraudRules      []FraudRule
+	// ScenarioRules force the outcome of the charges that they match.
+	ScenarioRules []ScenarioRule
+	// StrictMode rejects request bodies with fields that Midtrans does not know about.
+	StrictMode bool
+	// Production behaves like api.midtrans.com instead of the sandbox: only production
+	// server keys are accepted, there are no simulator pages and requests are decoded strictly.
+	Production bool
+	// AdminKey authenticates the /_mocktrans admin API, which test suites use to drive Mocktrans.
+	AdminKey string
+	// Snapshots are the named copies of the data that the admin API restores between tests.
+	Snapshots *SnapshotStore
+
+	IrisCreatorKey     string
+	IrisApproverKey    string
+	IrisMerchantKey    string
+	IrisCallbackUrl    string
+	IrisInitialBalance int64
+
+	// chaos holds the chaos rules, set by SetChaosRules.
+	chaos chaos
+	// webhookFaults holds the webhook fault rules, set by SetWebhookFaultRules.
+	webhookFaults webhookFaults
+	// scenarioTransitions are the transitions of the scenario rules that are yet to happen.
+	scenarioTransitions scenarioTransitions
+	// deliveries keeps the notifications of every transaction in order.
+	deliveries deliveries
+	// notifying counts the notifications that are being sent, for WaitForNotifications.
+	notifying counter
+	// orders serializes the charges of the same order_id of a merchant, so that
+	// two concurrent charges can not both pass the duplicate order_id check.
+	orders keyedMutex
+	// idempotencyKeys serializes the requests with the same Idempotency-Key of a merchant.
+	idempotencyKeys keyedMutex
+}
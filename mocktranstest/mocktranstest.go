@@ -0,0 +1,217 @@
+// Package mocktranstest runs Mocktrans inside Go tests, without a database or another process.
+// Every Mocktrans has its own data and its own clock, so that every test can have one.
+//
+//	server := mocktranstest.NewServer(mocktranstest.Options{CallbackUrl: callback.URL})
+//	defer server.Close()
+//
+//	// Point the Midtrans client at server.URL with server.ServerKey, charge, and then
+//	transaction, err := server.Settle(ctx, "order-1")
+package mocktranstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/aldy505/mocktrans"
+)
+
+// Options configures the only merchant of a Mocktrans. Empty fields get the same defaults
+// as the mocktrans command.
+type Options struct {
+	MerchantId string
+	ServerKey  string
+	ClientKey  string
+	// CallbackUrl receives the notifications. They are only kept for Notifications when it is empty.
+	CallbackUrl string
+	// AdminKey authenticates the admin API under /_mocktrans.
+	AdminKey string
+	// PublicUrl is where the customers are sent to pay. NewServer sets it to the URL of the server.
+	PublicUrl string
+	// Now is when the clock starts, defaults to the current time.
+	Now time.Time
+	// Production behaves like api.midtrans.com instead of the sandbox.
+	Production bool
+	FraudRules []mocktrans.FraudRule
+	// ScenarioRules force the outcome of the charges that they match.
+	ScenarioRules []mocktrans.ScenarioRule
+}
+
+// Mocktrans is a Mocktrans with the controls that tests need, served by Handler.
+type Mocktrans struct {
+	MerchantId string
+	ServerKey  string
+	ClientKey  string
+	AdminKey   string
+	// Clock is the time of this Mocktrans, which only moves with AdvanceClock.
+	Clock *Clock
+
+	dependencies *mocktrans.Dependencies
+}
+
+// Notification is a notification that was sent to the callback URL.
+type Notification struct {
+	mocktrans.NotificationRequest
+	// Delivered is whether the callback URL responded with a 200.
+	Delivered bool
+	Time      time.Time
+}
+
+// Server is a Mocktrans that is served by an httptest.Server. Close it when the test is done.
+type Server struct {
+	*httptest.Server
+	*Mocktrans
+}
+
+// New returns a Mocktrans that keeps its data in memory, to be served with Handler.
+func New(options Options) *Mocktrans {
+	if options.MerchantId == "" {
+		options.MerchantId = "G000000000"
+	}
+	if options.ServerKey == "" {
+		options.ServerKey = "SB-Mid-server-abc123cde456"
+		if options.Production {
+			options.ServerKey = "Mid-server-abc123cde456"
+		}
+	}
+	if options.ClientKey == "" {
+		options.ClientKey = "SB-Mid-client-abc123cde456"
+		if options.Production {
+			options.ClientKey = "Mid-client-abc123cde456"
+		}
+	}
+	if options.AdminKey == "" {
+		options.AdminKey = "MOCKTRANS-admin-abc123"
+	}
+	if options.Now.IsZero() {
+		options.Now = time.Now()
+	}
+
+	clock := NewClock(options.Now)
+	return &Mocktrans{
+		MerchantId: options.MerchantId,
+		ServerKey:  options.ServerKey,
+		ClientKey:  options.ClientKey,
+		AdminKey:   options.AdminKey,
+		Clock:      clock,
+		dependencies: &mocktrans.Dependencies{
+			Storage: mocktrans.NewMemoryStorage(),
+			Clock:   clock,
+			Merchants: []mocktrans.Merchant{{
+				MerchantId:  options.MerchantId,
+				ServerKey:   options.ServerKey,
+				ClientKey:   options.ClientKey,
+				CallbackUrl: options.CallbackUrl,
+			}},
+			PublicUrl:     strings.TrimSuffix(options.PublicUrl, "/"),
+			FraudRules:    options.FraudRules,
+			ScenarioRules: options.ScenarioRules,
+			StrictMode:    options.Production,
+			Production:    options.Production,
+			AdminKey:      options.AdminKey,
+			Snapshots:     mocktrans.NewSnapshotStore(),
+
+			IrisCreatorKey:     "IRIS-creator-abc123",
+			IrisApproverKey:    "IRIS-approver-abc123",
+			IrisMerchantKey:    "IRIS-merchant-abc123",
+			IrisInitialBalance: 100000000,
+		},
+	}
+}
+
+// NewServer starts a Mocktrans on a local port, whose URL is the base URL of both
+// the Midtrans API and the pages that customers pay on.
+func NewServer(options Options) *Server {
+	m := New(options)
+	server := httptest.NewServer(m.Handler())
+	if options.PublicUrl == "" {
+		m.dependencies.PublicUrl = server.URL
+	}
+
+	return &Server{Server: server, Mocktrans: m}
+}
+
+// Handler serves the Midtrans API along with everything else that the mocktrans command serves.
+func (m *Mocktrans) Handler() http.Handler {
+	return m.dependencies.Router()
+}
+
+// Transaction finds a transaction by either its transaction ID or its order ID.
+func (m *Mocktrans) Transaction(ctx context.Context, id string) (mocktrans.Transaction, error) {
+	return m.dependencies.FindTransaction(ctx, id)
+}
+
+// Settle settles a pending or captured transaction, as if the customer paid, and notifies the merchant.
+func (m *Mocktrans) Settle(ctx context.Context, id string) (mocktrans.Transaction, error) {
+	return m.dependencies.ApplyTransactionAction(ctx, id, "settle")
+}
+
+// Expire expires a pending transaction and notifies the merchant.
+func (m *Mocktrans) Expire(ctx context.Context, id string) (mocktrans.Transaction, error) {
+	return m.dependencies.ApplyTransactionAction(ctx, id, "expire")
+}
+
+// Cancel cancels a pending or captured transaction and notifies the merchant.
+func (m *Mocktrans) Cancel(ctx context.Context, id string) (mocktrans.Transaction, error) {
+	return m.dependencies.ApplyTransactionAction(ctx, id, "cancel")
+}
+
+// Refund refunds a settled transaction and notifies the merchant.
+func (m *Mocktrans) Refund(ctx context.Context, id string) (mocktrans.Transaction, error) {
+	return m.dependencies.ApplyTransactionAction(ctx, id, "refund")
+}
+
+// AdvanceClock moves the clock forward, applies the transitions of the scenario rules that
+// became due and charges the subscriptions that became due, which the mocktrans command does
+// on its own every few seconds.
+func (m *Mocktrans) AdvanceClock(ctx context.Context, duration time.Duration) error {
+	m.Clock.Advance(duration)
+	m.dependencies.ExecuteDueScenarioTransitions(ctx)
+	return m.dependencies.ExecuteDueSubscriptions(ctx)
+}
+
+// Notifications lists the notifications of the transaction, oldest first, or of every
+// transaction when transactionId is empty. It waits for the notifications that are
+// still being sent, so that it includes everything that happened before it was called.
+func (m *Mocktrans) Notifications(ctx context.Context, transactionId string) ([]Notification, error) {
+	m.dependencies.WaitForNotifications()
+
+	attempts, err := m.dependencies.ListNotifications(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []Notification
+	for _, attempt := range attempts {
+		notification := Notification{Delivered: attempt.Success, Time: attempt.CreatedAt}
+		err := json.Unmarshal([]byte(attempt.Data), &notification.NotificationRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode notification: %w", err)
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// SetChaos replaces the chaos rules, which make the requests to Mocktrans fail or slow down.
+// Setting no rules turns chaos off.
+func (m *Mocktrans) SetChaos(rules []mocktrans.ChaosRule) error {
+	return m.dependencies.SetChaosRules(rules)
+}
+
+// SetWebhookFaults replaces the webhook fault rules, which change how the notifications are
+// delivered. Setting no rules turns them off, and sends the notifications that were held back.
+func (m *Mocktrans) SetWebhookFaults(rules []mocktrans.WebhookFaultRule) error {
+	return m.dependencies.SetWebhookFaultRules(rules)
+}
+
+// Reset deletes every transaction and everything else that was created through the API.
+func (m *Mocktrans) Reset(ctx context.Context) error {
+	return m.dependencies.ResetData(ctx)
+}
@@ -0,0 +1,495 @@
+package mocktranstest_test
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aldy505/mocktrans"
+	"github.com/aldy505/mocktrans/mocktranstest"
+)
+
+func TestServer(t *testing.T) {
+	var mu sync.Mutex
+	var received []mocktrans.NotificationRequest
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification mocktrans.NotificationRequest
+		err := json.NewDecoder(r.Body).Decode(&notification)
+		if err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+
+		mu.Lock()
+		received = append(received, notification)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer callback.Close()
+
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	server := mocktranstest.NewServer(mocktranstest.Options{CallbackUrl: callback.URL, Now: start})
+	defer server.Close()
+
+	ctx := context.Background()
+
+	var charge struct {
+		StatusCode        string `json:"status_code"`
+		TransactionId     string `json:"transaction_id"`
+		TransactionStatus string `json:"transaction_status"`
+	}
+	post(t, server, "/v2/charge", `{
+		"payment_type": "bank_transfer",
+		"transaction_details": {"order_id": "order-1", "gross_amount": 150000},
+		"bank_transfer": {"bank": "bni"}
+	}`, &charge)
+	if charge.StatusCode != "201" || charge.TransactionStatus != "pending" {
+		t.Fatalf("expected a pending charge, got %+v", charge)
+	}
+
+	transaction, err := server.Settle(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("failed to settle: %v", err)
+	}
+	if transaction.Id != charge.TransactionId || transaction.TransactionStatus != mocktrans.TransactionStatusSettlement {
+		t.Fatalf("expected transaction %s to be settled, got %+v", charge.TransactionId, transaction)
+	}
+
+	notifications, err := server.Notifications(ctx, transaction.Id)
+	if err != nil {
+		t.Fatalf("failed to list notifications: %v", err)
+	}
+
+	var statuses []string
+	for _, notification := range notifications {
+		statuses = append(statuses, notification.TransactionStatus)
+
+		if !notification.Delivered {
+			t.Errorf("expected the %s notification to be delivered", notification.TransactionStatus)
+		}
+
+		sum := sha512.Sum512([]byte(notification.OrderId + notification.StatusCode + notification.GrossAmount + server.ServerKey))
+		if notification.SignatureKey != hex.EncodeToString(sum[:]) {
+			t.Errorf("expected the %s notification to be signed with the server key", notification.TransactionStatus)
+		}
+	}
+	if strings.Join(statuses, ",") != "pending,settlement" {
+		t.Errorf("expected pending and settlement notifications, got %v", statuses)
+	}
+
+	mu.Lock()
+	if len(received) != len(notifications) {
+		t.Errorf("expected the callback to receive %d notifications, got %d", len(notifications), len(received))
+	}
+	mu.Unlock()
+
+	var subscription struct {
+		Id string `json:"id"`
+	}
+	post(t, server, "/v1/subscriptions", `{
+		"name": "Monthly",
+		"amount": "50000",
+		"currency": "IDR",
+		"payment_type": "credit_card",
+		"token": "481111-1114-abc",
+		"schedule": {"interval": 1, "interval_unit": "day"}
+	}`, &subscription)
+
+	for interval := 1; interval <= 2; interval++ {
+		err = server.AdvanceClock(ctx, 24*time.Hour)
+		if err != nil {
+			t.Fatalf("failed to advance the clock: %v", err)
+		}
+
+		orderId := subscription.Id + "-" + strconv.Itoa(interval)
+		transaction, err := server.Transaction(ctx, orderId)
+		if err != nil {
+			t.Fatalf("expected subscription charge %s after %d days: %v", orderId, interval, err)
+		}
+		if transaction.SubscriptionId != subscription.Id {
+			t.Errorf("expected %s to belong to subscription %s", orderId, subscription.Id)
+		}
+	}
+
+	if now := server.Clock.Now(); !now.Equal(start.Add(48 * time.Hour)) {
+		t.Errorf("expected the clock at %s, got %s", start.Add(48*time.Hour), now)
+	}
+}
+
+func post(t *testing.T, server *mocktranstest.Server, path string, body string, response any) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(server.ServerKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+
+	err = json.Unmarshal(content, response)
+	if err != nil {
+		t.Fatalf("failed to decode response %s: %v", content, err)
+	}
+}
+
+func TestScenarioTransitions(t *testing.T) {
+	server := mocktranstest.NewServer(mocktranstest.Options{
+		Now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		ScenarioRules: []mocktrans.ScenarioRule{{
+			OrderId: "AUTO-*",
+			Transitions: []mocktrans.ScenarioTransition{
+				{After: mocktrans.Duration(10 * time.Minute), TransactionStatus: mocktrans.TransactionStatusSettlement},
+				{After: mocktrans.Duration(20 * time.Minute), TransactionStatus: mocktrans.TransactionStatusRefund},
+			},
+		}},
+	})
+	defer server.Close()
+
+	ctx := context.Background()
+
+	for _, orderId := range []string{"AUTO-1", "AUTO-2"} {
+		var charge struct {
+			TransactionStatus string `json:"transaction_status"`
+		}
+		post(t, server, "/v2/charge", `{
+			"payment_type": "bank_transfer",
+			"transaction_details": {"order_id": "`+orderId+`", "gross_amount": 150000},
+			"bank_transfer": {"bank": "bni"}
+		}`, &charge)
+		if charge.TransactionStatus != "pending" {
+			t.Fatalf("expected %s to be pending, got %s", orderId, charge.TransactionStatus)
+		}
+	}
+
+	// The transaction that is canceled in the meantime leaves its scenario
+	_, err := server.Cancel(ctx, "AUTO-2")
+	if err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+
+	steps := []struct {
+		advance time.Duration
+		auto1   mocktrans.TransactionStatus
+	}{
+		{advance: 5 * time.Minute, auto1: mocktrans.TransactionStatusPending},
+		{advance: 5 * time.Minute, auto1: mocktrans.TransactionStatusSettlement},
+		{advance: time.Hour, auto1: mocktrans.TransactionStatusRefund},
+	}
+	for _, step := range steps {
+		err := server.AdvanceClock(ctx, step.advance)
+		if err != nil {
+			t.Fatalf("failed to advance the clock: %v", err)
+		}
+
+		transaction, err := server.Transaction(ctx, "AUTO-1")
+		if err != nil {
+			t.Fatalf("failed to get AUTO-1: %v", err)
+		}
+		if transaction.TransactionStatus != step.auto1 {
+			t.Errorf("expected AUTO-1 to be %s at %s, got %s", step.auto1, server.Clock.Now(), transaction.TransactionStatus)
+		}
+
+		transaction, err = server.Transaction(ctx, "AUTO-2")
+		if err != nil {
+			t.Fatalf("failed to get AUTO-2: %v", err)
+		}
+		if transaction.TransactionStatus != mocktrans.TransactionStatusCancel {
+			t.Errorf("expected AUTO-2 to stay canceled at %s, got %s", server.Clock.Now(), transaction.TransactionStatus)
+		}
+	}
+}
+
+func TestChaosWithRecorder(t *testing.T) {
+	m := mocktranstest.New(mocktranstest.Options{})
+
+	rules := [][]mocktrans.ChaosRule{
+		{{ResetPercentage: 100}},
+		{{TruncatePercentage: 100}},
+	}
+	for _, rule := range rules {
+		err := m.SetChaos(rule)
+		if err != nil {
+			t.Fatalf("failed to set chaos: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/v2/order-1/status", nil)
+		req.SetBasicAuth(m.ServerKey, "")
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadGateway {
+			t.Errorf("expected %+v to respond with a 502 without a connection, got %d", rule[0], recorder.Code)
+		}
+	}
+
+	err := m.SetChaos([]mocktrans.ChaosRule{{Latency: mocktrans.Duration(mocktrans.MaxChaosLatency + time.Second)}})
+	if err == nil {
+		t.Error("expected a latency beyond MaxChaosLatency to be rejected")
+	}
+}
+
+func TestDeliverAfterNext(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification mocktrans.NotificationRequest
+		err := json.NewDecoder(r.Body).Decode(&notification)
+		if err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+
+		mu.Lock()
+		received[notification.OrderId] = append(received[notification.OrderId], notification.TransactionStatus)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer callback.Close()
+
+	server := mocktranstest.NewServer(mocktranstest.Options{CallbackUrl: callback.URL})
+	defer server.Close()
+
+	err := server.SetWebhookFaults([]mocktrans.WebhookFaultRule{{
+		TransactionStatus: "pending",
+		DeliverAfterNext:  true,
+		HoldTimeout:       mocktrans.Duration(50 * time.Millisecond),
+	}})
+	if err != nil {
+		t.Fatalf("failed to set webhook faults: %v", err)
+	}
+
+	ctx := context.Background()
+
+	for _, orderId := range []string{"OOO-1", "OOO-2"} {
+		var charge struct {
+			TransactionStatus string `json:"transaction_status"`
+		}
+		post(t, server, "/v2/charge", `{
+			"payment_type": "bank_transfer",
+			"transaction_details": {"order_id": "`+orderId+`", "gross_amount": 150000},
+			"bank_transfer": {"bank": "bni"}
+		}`, &charge)
+	}
+
+	_, err = server.Settle(ctx, "OOO-1")
+	if err != nil {
+		t.Fatalf("failed to settle: %v", err)
+	}
+
+	// OOO-2 has no next notification, its pending is sent once the hold timeout is over
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.Notifications(ctx, "")
+
+		mu.Lock()
+		done := len(received["OOO-1"]) == 2 && len(received["OOO-2"]) == 1
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if got := strings.Join(received["OOO-1"], ","); got != "settlement,pending" {
+		t.Errorf("expected the pending of OOO-1 after its settlement, got %s", got)
+	}
+	if got := strings.Join(received["OOO-2"], ","); got != "pending" {
+		t.Errorf("expected the held pending of OOO-2 after the hold timeout, got %s", got)
+	}
+}
+
+func TestPaymentLinkEnabledPayments(t *testing.T) {
+	server := mocktranstest.NewServer(mocktranstest.Options{})
+	defer server.Close()
+
+	var created struct {
+		OrderId       string   `json:"order_id"`
+		PaymentUrl    string   `json:"payment_url"`
+		ErrorMessages []string `json:"error_messages"`
+	}
+	post(t, server, "/v1/payment-links", `{
+		"transaction_details": {"order_id": "link-1", "gross_amount": 10000},
+		"enabled_payments": ["bank_transfer"]
+	}`, &created)
+	if len(created.ErrorMessages) != 1 || created.ErrorMessages[0] != "enabled_payments contains unknown payment type of bank_transfer" {
+		t.Fatalf("expected bank_transfer to be refused, got %+v", created)
+	}
+
+	post(t, server, "/v1/payment-links", `{
+		"transaction_details": {"order_id": "link-1", "gross_amount": 10000}
+	}`, &created)
+	if created.PaymentUrl == "" {
+		t.Fatalf("expected a payment link, got %+v", created)
+	}
+
+	var paymentLink struct {
+		EnabledPayments []string `json:"enabled_payments"`
+	}
+	get(t, server, "/v1/payment-links/link-1", &paymentLink)
+	if got := strings.Join(paymentLink.EnabledPayments, ","); !strings.Contains(got, "bca_va") || !strings.Contains(got, "indomaret") || strings.Contains(got, "bank_transfer") {
+		t.Errorf("expected the Snap payments to be enabled, got %s", got)
+	}
+
+	// A purchase opens the Snap page with the same payments
+	resp, err := http.PostForm(created.PaymentUrl+"/pay", nil)
+	if err != nil {
+		t.Fatalf("failed to pay the payment link: %v", err)
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the Snap page: %v", err)
+	}
+	if !strings.Contains(string(page), `value="bca_va"`) || !strings.Contains(string(page), `value="indomaret"`) {
+		t.Errorf("expected the Snap page to offer bca_va and indomaret, got %s", page)
+	}
+}
+
+func get(t *testing.T, server *mocktranstest.Server, path string, response any) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.SetBasicAuth(server.ServerKey, "")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+
+	err = json.Unmarshal(content, response)
+	if err != nil {
+		t.Fatalf("failed to decode response %s: %v", content, err)
+	}
+}
+
+func TestResetDropsScheduledWork(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification mocktrans.NotificationRequest
+		err := json.NewDecoder(r.Body).Decode(&notification)
+		if err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+
+		mu.Lock()
+		received = append(received, notification.OrderId+" "+notification.TransactionStatus)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer callback.Close()
+
+	server := mocktranstest.NewServer(mocktranstest.Options{
+		CallbackUrl: callback.URL,
+		ScenarioRules: []mocktrans.ScenarioRule{{
+			OrderId: "AUTO-*",
+			Transitions: []mocktrans.ScenarioTransition{
+				{After: mocktrans.Duration(10 * time.Minute), TransactionStatus: mocktrans.TransactionStatusSettlement},
+			},
+		}},
+	})
+	defer server.Close()
+
+	err := server.SetWebhookFaults([]mocktrans.WebhookFaultRule{{
+		TransactionStatus: "pending",
+		DeliverAfterNext:  true,
+		HoldTimeout:       mocktrans.Duration(50 * time.Millisecond),
+	}})
+	if err != nil {
+		t.Fatalf("failed to set webhook faults: %v", err)
+	}
+
+	ctx := context.Background()
+
+	var charge struct {
+		TransactionStatus string `json:"transaction_status"`
+	}
+	post(t, server, "/v2/charge", `{
+		"payment_type": "bank_transfer",
+		"transaction_details": {"order_id": "AUTO-1", "gross_amount": 150000},
+		"bank_transfer": {"bank": "bni"}
+	}`, &charge)
+	if charge.TransactionStatus != "pending" {
+		t.Fatalf("expected AUTO-1 to be pending, got %s", charge.TransactionStatus)
+	}
+
+	// The held pending and the scheduled settlement belong to the transaction that is reset
+	_, err = server.Notifications(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to list notifications: %v", err)
+	}
+	err = server.Reset(ctx)
+	if err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+
+	err = server.AdvanceClock(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to advance the clock: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	notifications, err := server.Notifications(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to list notifications: %v", err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("expected no notifications after the reset, got %+v", notifications)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 0 {
+		t.Errorf("expected the callback to receive nothing after the reset, got %v", received)
+	}
+}
+
+func TestProductionHidesDashboard(t *testing.T) {
+	for _, production := range []bool{false, true} {
+		m := mocktranstest.New(mocktranstest.Options{Production: production})
+
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+
+		expected := http.StatusOK
+		if production {
+			expected = http.StatusNotFound
+		}
+		if recorder.Code != expected {
+			t.Errorf("expected the dashboard to respond with %d when production is %t, got %d", expected, production, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const paymentLinkExpiryLayout = "2006-01-02 15:04 -0700"
+
+// paymentLinkOrderIdMaxLength leaves room for the dash and the 8 characters that follow the
+// payment link's order_id in the order_id of every purchase, which is at most 50 characters.
+const paymentLinkOrderIdMaxLength = 50 - 9
+
+var ErrPaymentLinkNotFound = errors.New("payment link not found")
+
+type paymentLinkRequest struct {
+	TransactionDetails PaymentLinkTransactionDetail `json:"transaction_details"`
+	CustomerRequired   bool                         `json:"customer_required"`
+	UsageLimit         int64                        `json:"usage_limit"`
+	Expiry             PaymentLinkExpiry            `json:"expiry"`
+	EnabledPayments    []string                     `json:"enabled_payments"`
+	ItemDetails        []ItemDetail                 `json:"item_details"`
+	CustomerDetails    CustomerDetail               `json:"customer_details"`
+	Title              string                       `json:"title"`
+	Metadata           map[string]interface{}       `json:"metadata"`
+	CustomField1       string                       `json:"custom_field1"`
+	CustomField2       string                       `json:"custom_field2"`
+	CustomField3       string                       `json:"custom_field3"`
+}
+
+// PaymentLinkTransactionDetail is the TransactionDetail of a payment link, whose
+// payment_link_id picks the ID of the link.
+type PaymentLinkTransactionDetail struct {
+	OrderId       string `json:"order_id"`
+	GrossAmount   int64  `json:"gross_amount"`
+	PaymentLinkId string `json:"payment_link_id,omitempty"`
+}
+
+type PaymentLinkExpiry struct {
+	// Formatted as "2006-01-02 15:04 -0700", defaults to the time the link is created.
+	StartTime string `json:"start_time"`
+	Duration  int64  `json:"duration"`
+	// Possible values are days, hours or minutes.
+	Unit string `json:"unit"`
+}
+
+type paymentLinkResponse struct {
+	OrderId    string `json:"order_id"`
+	PaymentUrl string `json:"payment_url"`
+}
+
+type paymentLinkPurchase struct {
+	OrderId       string `json:"order_id"`
+	TransactionId string `json:"transaction_id"`
+	PaymentStatus string `json:"payment_status"`
+	PaymentMethod string `json:"payment_method"`
+	Amount        string `json:"amount"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type paymentLinkDetailResponse struct {
+	Id               string                `json:"id"`
+	OrderId          string                `json:"order_id"`
+	GrossAmount      int64                 `json:"gross_amount"`
+	UsageLimit       int64                 `json:"usage_limit"`
+	CustomerRequired bool                  `json:"customer_required"`
+	EnabledPayments  []string              `json:"enabled_payments"`
+	Expiry           PaymentLinkExpiry     `json:"expiry"`
+	ItemDetails      []ItemDetail          `json:"item_details"`
+	CustomerDetails  CustomerDetail        `json:"customer_details"`
+	Title            string                `json:"title,omitempty"`
+	PaymentLinkUrl   string                `json:"payment_link_url"`
+	Purchases        []paymentLinkPurchase `json:"purchases"`
+	CreatedAt        string                `json:"created_at"`
+	UpdatedAt        string                `json:"updated_at"`
+}
+
+type PaymentLink struct {
+	Id         string
+	MerchantId string
+	OrderId    string
+	UsageLimit int64
+	Request    paymentLinkRequest
+	// ExpiredAt is nil for payment links that never expire.
+	ExpiredAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CreatePaymentLink creates a shareable payment link. Every time it is paid,
+// a new transaction is made with the payment link's order_id as its prefix.
+func (d *Dependencies) CreatePaymentLink(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var req paymentLinkRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{err.Error()}})
+		return
+	}
+
+	// Validate request body
+	now := d.Clock.Now()
+	expiredAt, errorMessages := req.Validate(now)
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: errorMessages})
+		return
+	}
+
+	paymentLinkId := req.TransactionDetails.PaymentLinkId
+	if paymentLinkId == "" {
+		paymentLinkId, err = newId()
+		if err != nil {
+			writeInternalErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	_, err = d.Storage.getPaymentLink(r.Context(), paymentLinkId)
+	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{"payment link with the same order_id or payment_link_id already exists"}})
+		return
+	}
+	if !errors.Is(err, ErrPaymentLinkNotFound) {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	_, err = d.Storage.getPaymentLink(r.Context(), req.TransactionDetails.OrderId)
+	if err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{"payment link with the same order_id or payment_link_id already exists"}})
+		return
+	}
+	if !errors.Is(err, ErrPaymentLinkNotFound) {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	// The purchases are paid on Snap, which knows the payment methods by its own names
+	if len(req.EnabledPayments) == 0 {
+		req.EnabledPayments = snapPaymentNames()
+	}
+
+	req.TransactionDetails.PaymentLinkId = paymentLinkId
+	paymentLink := PaymentLink{
+		Id:         paymentLinkId,
+		MerchantId: merchantFromContext(r.Context()).MerchantId,
+		OrderId:    req.TransactionDetails.OrderId,
+		UsageLimit: req.UsageLimit,
+		Request:    req,
+		ExpiredAt:  expiredAt,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err = d.Storage.insertPaymentLink(r.Context(), paymentLink)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(paymentLinkResponse{
+		OrderId:    paymentLink.OrderId,
+		PaymentUrl: d.paymentLinkUrl(paymentLink.Id),
+	})
+}
+
+// GetPaymentLink returns the payment link along with every purchase made through it.
+func (d *Dependencies) GetPaymentLink(w http.ResponseWriter, r *http.Request) {
+	paymentLink, err := d.Storage.getPaymentLink(r.Context(), chi.URLParam(r, "orderId"))
+	if err == nil && paymentLink.MerchantId != merchantFromContext(r.Context()).MerchantId {
+		err = ErrPaymentLinkNotFound
+	}
+	if err != nil {
+		if errors.Is(err, ErrPaymentLinkNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{"payment link not found"}})
+			return
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	transactions, err := d.listPaymentLinkTransactions(r.Context(), paymentLink.Id)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	purchases := make([]paymentLinkPurchase, 0, len(transactions))
+	for _, transaction := range transactions {
+		purchases = append(purchases, paymentLinkPurchase{
+			OrderId:       transaction.OrderId,
+			TransactionId: transaction.Id,
+			PaymentStatus: strings.ToUpper(string(transaction.TransactionStatus)),
+			PaymentMethod: transaction.PaymentType,
+			Amount:        transaction.FormattedGrossAmount(),
+			CreatedAt:     transaction.TransactionTime(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(paymentLinkDetailResponse{
+		Id:               paymentLink.Id,
+		OrderId:          paymentLink.OrderId,
+		GrossAmount:      paymentLink.Request.TransactionDetails.GrossAmount,
+		UsageLimit:       paymentLink.UsageLimit,
+		CustomerRequired: paymentLink.Request.CustomerRequired,
+		EnabledPayments:  paymentLink.Request.EnabledPayments,
+		Expiry:           paymentLink.Request.Expiry,
+		ItemDetails:      paymentLink.Request.ItemDetails,
+		CustomerDetails:  paymentLink.Request.CustomerDetails,
+		Title:            paymentLink.Request.Title,
+		PaymentLinkUrl:   d.paymentLinkUrl(paymentLink.Id),
+		Purchases:        purchases,
+		CreatedAt:        paymentLink.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+		UpdatedAt:        paymentLink.UpdatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+	})
+}
+
+// DeletePaymentLink deactivates a payment link. Transactions that were
+// already made through it are kept.
+func (d *Dependencies) DeletePaymentLink(w http.ResponseWriter, r *http.Request) {
+	paymentLink, err := d.Storage.getPaymentLink(r.Context(), chi.URLParam(r, "orderId"))
+	if err == nil && paymentLink.MerchantId != merchantFromContext(r.Context()).MerchantId {
+		err = ErrPaymentLinkNotFound
+	}
+	if err != nil {
+		if errors.Is(err, ErrPaymentLinkNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{"payment link not found"}})
+			return
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	err = d.Storage.deletePaymentLink(r.Context(), paymentLink.Id)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status_code": "200", "status_message": "Payment link deleted successfully"}`))
+}
+
+// Validate checks the payment link request, and returns when the payment link expires.
+func (p paymentLinkRequest) Validate(now time.Time) (*time.Time, []string) {
+	var errorMessages []string
+
+	if p.TransactionDetails.OrderId == "" {
+		errorMessages = append(errorMessages, "transaction_details.order_id is required")
+	}
+
+	if strings.ContainsAny(p.TransactionDetails.OrderId, "!@#$%^&*()+=[]{}|;':,/<>?\\") {
+		errorMessages = append(errorMessages, "transaction_details.order_id must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)")
+	}
+
+	if len(p.TransactionDetails.OrderId) > paymentLinkOrderIdMaxLength {
+		errorMessages = append(errorMessages, fmt.Sprintf("transaction_details.order_id must not exceed %d characters", paymentLinkOrderIdMaxLength))
+	}
+
+	if strings.ContainsAny(p.TransactionDetails.PaymentLinkId, "!@#$%^&*()+=[]{}|;':,/<>?\\ ") {
+		errorMessages = append(errorMessages, "transaction_details.payment_link_id must only contain alphanumeric characters, dash(-), underscore(_), tilde (~), and dot (.)")
+	}
+
+	if p.TransactionDetails.GrossAmount <= 0 {
+		errorMessages = append(errorMessages, "transaction_details.gross_amount must be greater than or equal to 0.01")
+	}
+
+	if reason := validateItemDetails(p.TransactionDetails.GrossAmount, p.ItemDetails); reason != "" {
+		errorMessages = append(errorMessages, reason)
+	}
+
+	if p.UsageLimit < 0 {
+		errorMessages = append(errorMessages, "usage_limit must not be negative")
+	}
+
+	for _, enabledPayment := range p.EnabledPayments {
+		if _, ok := findSnapPayment(enabledPayment); !ok {
+			errorMessages = append(errorMessages, fmt.Sprintf("enabled_payments contains unknown payment type of %s", enabledPayment))
+		}
+	}
+
+	if p.Expiry.Duration == 0 {
+		return nil, errorMessages
+	}
+
+	startTime := now
+	if p.Expiry.StartTime != "" {
+		parsed, err := time.Parse(paymentLinkExpiryLayout, p.Expiry.StartTime)
+		if err != nil {
+			errorMessages = append(errorMessages, "expiry.start_time must be formatted as yyyy-MM-dd HH:mm Z")
+		}
+		startTime = parsed
+	}
+
+	var unit time.Duration
+	switch p.Expiry.Unit {
+	case "days", "day":
+		unit = time.Hour * 24
+	case "hours", "hour":
+		unit = time.Hour
+	case "minutes", "minute":
+		unit = time.Minute
+	default:
+		errorMessages = append(errorMessages, "expiry.unit must be one of days, hours or minutes")
+	}
+
+	if p.Expiry.Duration < 0 {
+		errorMessages = append(errorMessages, "expiry.duration must not be negative")
+	}
+
+	expiredAt := startTime.Add(unit * time.Duration(p.Expiry.Duration))
+	return &expiredAt, errorMessages
+}
+
+func (d *Dependencies) paymentLinkUrl(paymentLinkId string) string {
+	return d.PublicUrl + "/payment-links/" + paymentLinkId
+}
+
+func (s *sqlStorage) insertPaymentLink(ctx context.Context, paymentLink PaymentLink) error {
+	request, err := json.Marshal(paymentLink.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment link request: %w", err)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		payment_links
+		(
+			id,
+			merchant_id,
+			order_id,
+			usage_limit,
+			request,
+			expired_at,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	var expiredAt sql.NullTime
+	if paymentLink.ExpiredAt != nil {
+		expiredAt = sql.NullTime{Time: *paymentLink.ExpiredAt, Valid: true}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		paymentLink.Id,
+		paymentLink.MerchantId,
+		paymentLink.OrderId,
+		paymentLink.UsageLimit,
+		string(request),
+		expiredAt,
+		paymentLink.CreatedAt,
+		paymentLink.UpdatedAt,
+	)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to insert payment link: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// getPaymentLink finds a payment link by either its ID or its order ID.
+func (s *sqlStorage) getPaymentLink(ctx context.Context, id string) (PaymentLink, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		id,
+		COALESCE(merchant_id, ''),
+		order_id,
+		usage_limit,
+		request,
+		expired_at,
+		created_at,
+		updated_at
+	FROM
+		payment_links
+	WHERE
+		id = $1
+		OR order_id = $2
+	LIMIT 1`)
+	if err != nil {
+		return PaymentLink{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return PaymentLink{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var paymentLink PaymentLink
+	var request string
+	var expiredAt sql.NullTime
+	err = conn.QueryRowContext(ctx, formattedQuery, id, id).Scan(
+		&paymentLink.Id,
+		&paymentLink.MerchantId,
+		&paymentLink.OrderId,
+		&paymentLink.UsageLimit,
+		&request,
+		&expiredAt,
+		&paymentLink.CreatedAt,
+		&paymentLink.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return PaymentLink{}, ErrPaymentLinkNotFound
+		}
+
+		return PaymentLink{}, fmt.Errorf("failed to query payment link: %w", err)
+	}
+
+	if expiredAt.Valid {
+		paymentLink.ExpiredAt = &expiredAt.Time
+	}
+
+	err = json.Unmarshal([]byte(request), &paymentLink.Request)
+	if err != nil {
+		return PaymentLink{}, fmt.Errorf("failed to unmarshal payment link request: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return PaymentLink{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return paymentLink, nil
+}
+
+func (s *sqlStorage) deletePaymentLink(ctx context.Context, paymentLinkId string) error {
+	formattedQuery, err := s.formatPlaceholder(`DELETE FROM payment_links WHERE id = $1`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, paymentLinkId)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to delete payment link: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
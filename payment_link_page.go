@@ -0,0 +1,248 @@
+package mocktrans
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const paymentLinkTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans Payment Link - Dummy Midtrans for Development purposes</title>
+
+	<style>` + pollenStyle + `
+
+		.container {
+			width: 100%;
+			max-width: var(--width-md);
+			margin: 0 auto;
+			font-family: var(--font-sans);
+		}
+
+		h1 {
+			font-size: var(--scale-3);
+			font-weight: var(--weight-bold);
+			padding-top: 1rem;
+		}
+
+		label {
+			display: block;
+			margin-bottom: 0.5rem;
+		}
+
+		input {
+			display: block;
+			width: 100%;
+			padding: 0.5rem;
+		}
+
+		button {
+			padding: 0.5rem;
+			border: none;
+			background-color: var(--color-blue-700);
+			color: var(--color-grey-50);
+		}
+
+		button:hover {
+			cursor: pointer;
+		}
+	</style>
+</head>
+
+<body>
+	<div class="container">
+		<h1>{{title}}</h1>
+		<p>Order ID: {{order_id}}</p>
+		<p>Amount: IDR {{gross_amount}}</p>
+		<ul>
+{{item_details}}
+		</ul>
+
+		<p style="display: {{unavailable_display}};">{{unavailable_reason}}</p>
+
+		<form method="POST" action="{{pay_url}}" style="display: {{form_display}};">
+			<div style="display: {{customer_display}};">
+				<label>First name <input name="first_name" value="{{first_name}}" {{customer_required}}></label>
+				<label>Last name <input name="last_name" value="{{last_name}}"></label>
+				<label>Email <input name="email" type="email" value="{{email}}" {{customer_required}}></label>
+				<label>Phone <input name="phone" value="{{phone}}" {{customer_required}}></label>
+			</div>
+
+			<button>Pay</button>
+		</form>
+	</div>
+</body>
+
+</html>`
+
+// PaymentLinkPage is the shareable page of a payment link.
+func (d *Dependencies) PaymentLinkPage(w http.ResponseWriter, r *http.Request) {
+	paymentLink, err := d.Storage.getPaymentLink(r.Context(), chi.URLParam(r, "paymentLinkId"))
+	if err != nil {
+		if errors.Is(err, ErrPaymentLinkNotFound) {
+			http.Error(w, "Payment link not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unavailableReason, err := d.paymentLinkUnavailableReason(r.Context(), paymentLink)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unavailableDisplay, formDisplay := "none", "block"
+	if unavailableReason != "" {
+		unavailableDisplay, formDisplay = "block", "none"
+	}
+
+	customerDisplay, customerRequired := "none", ""
+	if paymentLink.Request.CustomerRequired {
+		customerDisplay, customerRequired = "block", "required"
+	}
+
+	title := paymentLink.Request.Title
+	if title == "" {
+		title = "Payment for " + paymentLink.OrderId
+	}
+
+	var itemDetails strings.Builder
+	for _, item := range paymentLink.Request.ItemDetails {
+		itemDetails.WriteString("			<li>" + html.EscapeString(item.Name) + " &times; " + strconv.FormatInt(item.Quantity, 10) + " (IDR " + Transaction{GrossAmount: item.Price}.FormattedGrossAmount() + ")</li>\n")
+	}
+
+	// Render the template
+	customer := paymentLink.Request.CustomerDetails
+	replacer := strings.NewReplacer(
+		"{{title}}", html.EscapeString(title),
+		"{{order_id}}", html.EscapeString(paymentLink.OrderId),
+		"{{gross_amount}}", Transaction{GrossAmount: paymentLink.Request.TransactionDetails.GrossAmount}.FormattedGrossAmount(),
+		"{{item_details}}", itemDetails.String(),
+		"{{unavailable_display}}", unavailableDisplay,
+		"{{unavailable_reason}}", html.EscapeString(unavailableReason),
+		"{{form_display}}", formDisplay,
+		"{{pay_url}}", html.EscapeString(d.paymentLinkUrl(paymentLink.Id)+"/pay"),
+		"{{customer_display}}", customerDisplay,
+		"{{customer_required}}", customerRequired,
+		"{{first_name}}", html.EscapeString(customer.FirstName),
+		"{{last_name}}", html.EscapeString(customer.LastName),
+		"{{email}}", html.EscapeString(customer.Email),
+		"{{phone}}", html.EscapeString(customer.Phone),
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(paymentLinkTemplate)))
+}
+
+// PaymentLinkPay spawns a new transaction out of the payment link, and sends
+// the customer to the Snap payment page of it.
+func (d *Dependencies) PaymentLinkPay(w http.ResponseWriter, r *http.Request) {
+	paymentLink, err := d.Storage.getPaymentLink(r.Context(), chi.URLParam(r, "paymentLinkId"))
+	if err != nil {
+		if errors.Is(err, ErrPaymentLinkNotFound) {
+			http.Error(w, "Payment link not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unavailableReason, err := d.paymentLinkUnavailableReason(r.Context(), paymentLink)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if unavailableReason != "" {
+		http.Error(w, unavailableReason, http.StatusGone)
+		return
+	}
+
+	customer := paymentLink.Request.CustomerDetails
+	if paymentLink.Request.CustomerRequired {
+		customer.FirstName = r.FormValue("first_name")
+		customer.LastName = r.FormValue("last_name")
+		customer.Email = r.FormValue("email")
+		customer.Phone = r.FormValue("phone")
+
+		if customer.FirstName == "" || customer.Email == "" || customer.Phone == "" {
+			http.Error(w, "first_name, email and phone are required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	suffix, err := newId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Every purchase gets its own order_id, prefixed by the payment link's
+	transactionDetails := TransactionDetail{
+		OrderId:       paymentLink.OrderId + "-" + suffix[:8],
+		GrossAmount:   paymentLink.Request.TransactionDetails.GrossAmount,
+		PaymentLinkId: paymentLink.Id,
+	}
+
+	snapTransaction, err := d.createSnapTransaction(r.Context(), paymentLink.MerchantId, snapRequest{
+		TransactionDetails: transactionDetails,
+		ItemDetails:        paymentLink.Request.ItemDetails,
+		CustomerDetails:    customer,
+		EnabledPayments:    paymentLink.Request.EnabledPayments,
+		Metadata:           paymentLink.Request.Metadata,
+		CustomField1:       paymentLink.Request.CustomField1,
+		CustomField2:       paymentLink.Request.CustomField2,
+		CustomField3:       paymentLink.Request.CustomField3,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, d.snapPaymentPageUrl(snapTransaction.Token), http.StatusSeeOther)
+}
+
+// paymentLinkUnavailableReason returns why the payment link can not be paid anymore,
+// or an empty string if it still can be.
+func (d *Dependencies) paymentLinkUnavailableReason(ctx context.Context, paymentLink PaymentLink) (string, error) {
+	if paymentLink.ExpiredAt != nil && d.Clock.Now().After(*paymentLink.ExpiredAt) {
+		return "This payment link has expired.", nil
+	}
+
+	if paymentLink.UsageLimit == 0 {
+		return "", nil
+	}
+
+	transactions, err := d.listPaymentLinkTransactions(ctx, paymentLink.Id)
+	if err != nil {
+		return "", err
+	}
+
+	var usage int64 = 0
+	for _, transaction := range transactions {
+		if transaction.TransactionStatus == TransactionStatusSettlement || (transaction.TransactionStatus == TransactionStatusCapture && transaction.FraudStatus == FraudStatusAccept) {
+			usage++
+		}
+	}
+
+	if usage >= paymentLink.UsageLimit {
+		return "This payment link has reached its usage limit.", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,50 @@
+package mocktrans
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaymentLinkOrderIdLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		orderId string
+		message string
+	}{
+		{
+			name:    "room for the purchase suffix",
+			orderId: strings.Repeat("a", 41),
+		},
+		{
+			name:    "50 characters leave no room for the purchase suffix",
+			orderId: strings.Repeat("a", 50),
+			message: "transaction_details.order_id must not exceed 41 characters",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := paymentLinkRequest{
+				TransactionDetails: PaymentLinkTransactionDetail{OrderId: test.orderId, GrossAmount: 10000},
+			}
+
+			_, errorMessages := req.Validate(time.Now())
+			if strings.Join(errorMessages, "; ") != test.message {
+				t.Fatalf("expected %q, got %v", test.message, errorMessages)
+			}
+			if test.message != "" {
+				return
+			}
+
+			// The order_id of a purchase has to pass as a charge's
+			charge := chargeRequest{
+				PaymentType:        "gopay",
+				TransactionDetails: TransactionDetail{OrderId: test.orderId + "-" + strings.Repeat("b", 8), GrossAmount: 10000},
+			}
+			if errorStatus, validationMessages := charge.Validate(); errorStatus != 0 {
+				t.Errorf("expected the purchase's order_id to be valid, got %v", validationMessages)
+			}
+		})
+	}
+}
@@ -1,24 +1,24 @@
-package main
+package mocktrans
 
 import (
 	"fmt"
 	"regexp"
 )
 
-func (d *Dependencies) formatPlaceholder(s string) (string, error) {
-	r, err := regexp.Compile("$[0-9]+")
+func (s *sqlStorage) formatPlaceholder(query string) (string, error) {
+	r, err := regexp.Compile(`\$[0-9]+`)
 	if err != nil {
 		return "", fmt.Errorf("failed to compile regexp: %w", err)
 	}
 
-	switch d.DatabaseProvider {
+	switch s.DatabaseProvider {
 	case "sqlite3":
 		fallthrough
 	case "sqlite":
 		fallthrough
 	case "mysql":
-		return r.ReplaceAllString(s, "?"), nil
+		return r.ReplaceAllString(query, "?"), nil
 	}
 
-	return s, nil
+	return query, nil
 }
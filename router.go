@@ -0,0 +1,107 @@
+package mocktrans
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Router serves every route of Mocktrans: the Midtrans API, the simulator pages,
+// the dashboard, the admin API and Iris.
+func (d *Dependencies) Router() http.Handler {
+	app := chi.NewRouter()
+	app.Use(d.Cors)
+	app.Use(d.Chaos(app))
+
+	// Customers pay for real in production, there is nothing to simulate
+	if !d.Production {
+		app.Get("/", d.UserConfirmation)
+		app.Put("/confirm", d.Confirm)
+	}
+
+	app.Get("/snap/snap.js", d.SnapJs)
+	app.Get("/snap/v2/vtweb/{token}", d.SnapPaymentPage)
+	app.Post("/snap/v2/vtweb/{token}/pay", d.SnapPay)
+	app.Get("/payment-links/{paymentLinkId}", d.PaymentLinkPage)
+	app.Post("/payment-links/{paymentLinkId}/pay", d.PaymentLinkPay)
+	app.Get("/gopay/activation/{accountId}", d.GopayActivationPage)
+	app.Post("/gopay/activation/{accountId}", d.GopayActivate)
+
+	// The dashboard shows the transactions of every merchant to anyone, and settles or
+	// refunds them by hand, which are sandbox conveniences
+	if !d.Production {
+		app.Get("/dashboard", d.Dashboard)
+		app.Get("/dashboard/transactions/{transactionId}", d.DashboardTransaction)
+		app.Post("/dashboard/transactions/{transactionId}/{action}", d.DashboardTransactionAction)
+	}
+
+	// Check for Authorization
+	app.Group(func(r chi.Router) {
+		r.Use(d.Authorization)
+		r.Get("/healthz", d.Healthz)
+		r.With(d.Idempotency).Post("/v2/charge", d.Charge)
+		r.Get("/v2/{orderId}/status", d.Status)
+		r.Post("/v2/{orderId}/approve", d.Approve)
+		r.Post("/v2/{orderId}/deny", d.Deny)
+		r.Post("/snap/v1/transactions", d.SnapTransaction)
+		r.Post("/v1/payment-links", d.CreatePaymentLink)
+		r.Get("/v1/payment-links/{orderId}", d.GetPaymentLink)
+		r.Delete("/v1/payment-links/{orderId}", d.DeletePaymentLink)
+		r.Post("/v2/pay/account", d.LinkGopayAccount)
+		r.Get("/v2/pay/account/{accountId}", d.GetGopayAccount)
+		r.Post("/v2/pay/account/{accountId}/unbind", d.UnbindGopayAccount)
+		r.Post("/v1/subscriptions", d.CreateSubscription)
+		r.Get("/v1/subscriptions/{subscriptionId}", d.GetSubscription)
+		r.Patch("/v1/subscriptions/{subscriptionId}", d.UpdateSubscription)
+		r.Post("/v1/subscriptions/{subscriptionId}/enable", d.EnableSubscription)
+		r.Post("/v1/subscriptions/{subscriptionId}/disable", d.DisableSubscription)
+		r.Post("/v1/subscriptions/{subscriptionId}/cancel", d.CancelSubscription)
+	})
+
+	// The admin API checks for the admin key
+	app.Route("/_mocktrans", func(r chi.Router) {
+		r.Use(d.AdminAuthorization)
+		r.Get("/transactions", d.AdminListTransactions)
+		r.Get("/transactions/{transactionId}", d.AdminGetTransaction)
+		r.Put("/transactions/{transactionId}/status", d.AdminSetTransactionStatus)
+		r.Post("/reset", d.AdminReset)
+		r.Get("/snapshots", d.AdminListSnapshots)
+		r.Post("/snapshots/{name}", d.AdminTakeSnapshot)
+		r.Post("/snapshots/{name}/restore", d.AdminRestoreSnapshot)
+		r.Delete("/snapshots/{name}", d.AdminDeleteSnapshot)
+		r.Get("/notifications", d.AdminListNotifications)
+		r.Get("/chaos", d.AdminGetChaos)
+		r.Put("/chaos", d.AdminSetChaos)
+		r.Delete("/chaos", d.AdminDeleteChaos)
+		r.Get("/webhook-faults", d.AdminGetWebhookFaults)
+		r.Put("/webhook-faults", d.AdminSetWebhookFaults)
+		r.Delete("/webhook-faults", d.AdminDeleteWebhookFaults)
+	})
+
+	// Iris checks for its own API keys
+	app.Route("/api/v1", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(d.IrisAuthorization(irisRoleCreator, irisRoleApprover))
+			r.Get("/beneficiaries", d.ListIrisBeneficiaries)
+			r.Get("/payouts/{referenceNo}", d.GetIrisPayout)
+			r.Get("/balance", d.IrisBalance)
+			r.Get("/beneficiary_banks", d.IrisBeneficiaryBanks)
+			r.Get("/account_validation", d.IrisAccountValidation)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(d.IrisAuthorization(irisRoleCreator))
+			r.Post("/beneficiaries", d.CreateIrisBeneficiary)
+			r.Patch("/beneficiaries/{aliasName}", d.UpdateIrisBeneficiary)
+			r.Post("/payouts", d.CreateIrisPayouts)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(d.IrisAuthorization(irisRoleApprover))
+			r.Post("/payouts/approve", d.ApproveIrisPayouts)
+			r.Post("/payouts/reject", d.RejectIrisPayouts)
+		})
+	})
+
+	return app
+}
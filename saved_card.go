@@ -0,0 +1,106 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var ErrSavedCardNotFound = errors.New("saved card not found")
+
+// SavedCard is a card that a customer saved with a merchant, which is charged again
+// by its saved_token_id instead of a one-time token_id.
+type SavedCard struct {
+	SavedTokenId string
+	MerchantId   string
+	MaskedCard   string
+	Bank         string
+	CreatedAt    time.Time
+}
+
+// insertSavedCardTx inserts the saved card within a database transaction, such as the one that inserts a seed.
+func (s *sqlStorage) insertSavedCardTx(ctx context.Context, tx *sql.Tx, savedCard SavedCard) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		saved_cards
+		(
+			saved_token_id,
+			merchant_id,
+			masked_card,
+			bank,
+			created_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		savedCard.SavedTokenId,
+		savedCard.MerchantId,
+		savedCard.MaskedCard,
+		savedCard.Bank,
+		savedCard.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert saved card: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) getSavedCard(ctx context.Context, merchantId string, savedTokenId string) (SavedCard, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		saved_token_id,
+		merchant_id,
+		masked_card,
+		bank,
+		created_at
+	FROM
+		saved_cards
+	WHERE
+		merchant_id = $1
+		AND saved_token_id = $2`)
+	if err != nil {
+		return SavedCard{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return SavedCard{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var savedCard SavedCard
+	err = conn.QueryRowContext(ctx, formattedQuery, merchantId, savedTokenId).Scan(
+		&savedCard.SavedTokenId,
+		&savedCard.MerchantId,
+		&savedCard.MaskedCard,
+		&savedCard.Bank,
+		&savedCard.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SavedCard{}, ErrSavedCardNotFound
+		}
+
+		return SavedCard{}, fmt.Errorf("failed to query saved card: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return SavedCard{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return savedCard, nil
+}
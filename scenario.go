@@ -0,0 +1,342 @@
+package mocktrans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScenarioRule forces the outcome of the charges that it matches, so that the same charge
+// always ends the same way. Every condition that is set must match for the rule to apply,
+// and a rule without any conditions matches every charge. Rules are evaluated in order,
+// the first one wins.
+type ScenarioRule struct {
+	// Pattern that is matched against the order_id, where * matches anything, as in "DENY-*".
+	OrderId string `json:"order_id"`
+	// Matches when the gross_amount is exactly this value.
+	GrossAmount int64 `json:"gross_amount"`
+	// Pattern that is matched against customer_details.email, case insensitive, as in "*@timeout.test".
+	Email       string `json:"email"`
+	PaymentType string `json:"payment_type"`
+
+	// Latency delays the response to the charge.
+	Latency Duration `json:"latency"`
+	// StatusCode fails the charge with the error response of that HTTP status, such as 500 or 503,
+	// without creating a transaction.
+	StatusCode int `json:"status_code"`
+	// TransactionStatus is the status that the transaction is created in, instead of the usual one.
+	TransactionStatus TransactionStatus `json:"transaction_status"`
+	// Transitions move the transaction into other statuses later on, unless something else
+	// changed the transaction in the meantime.
+	Transitions []ScenarioTransition `json:"transitions"`
+	// SkipNotifications keeps the notifications of the transaction from being sent.
+	SkipNotifications bool `json:"skip_notifications"`
+	// NotificationDelay delays every notification of the transaction.
+	NotificationDelay Duration `json:"notification_delay"`
+}
+
+// ScenarioTransition moves the transaction into TransactionStatus, After the charge.
+type ScenarioTransition struct {
+	After             Duration          `json:"after"`
+	TransactionStatus TransactionStatus `json:"transaction_status"`
+}
+
+// Duration is a time.Duration that is written as a string in JSON, such as "30s" or "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenarioRules reads the scenario rules from a JSON file containing an array of ScenarioRule.
+func LoadScenarioRules(filePath string) ([]ScenarioRule, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario rules file: %w", err)
+	}
+
+	var rules []ScenarioRule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scenario rules file: %w", err)
+	}
+
+	for i, rule := range rules {
+		err := rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (s ScenarioRule) validate() error {
+	for _, pattern := range []string{s.OrderId, s.Email} {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+
+	if s.StatusCode != 0 && (s.StatusCode < 400 || s.StatusCode > 599) {
+		return fmt.Errorf("status_code must be between 400 and 599, got %d", s.StatusCode)
+	}
+
+	switch s.TransactionStatus {
+	case "", TransactionStatusPending, TransactionStatusCapture, TransactionStatusSettlement, TransactionStatusDeny, TransactionStatusCancel, TransactionStatusExpire:
+	default:
+		return fmt.Errorf("unknown transaction_status of %s", s.TransactionStatus)
+	}
+
+	var previous Duration
+	for i, transition := range s.Transitions {
+		switch transition.TransactionStatus {
+		case TransactionStatusPending, TransactionStatusCapture, TransactionStatusSettlement, TransactionStatusDeny, TransactionStatusCancel, TransactionStatusExpire, TransactionStatusRefund:
+		default:
+			return fmt.Errorf("transition %d: unknown transaction_status of %s", i, transition.TransactionStatus)
+		}
+
+		if transition.After < previous {
+			return fmt.Errorf("transition %d: transitions must be ordered by after", i)
+		}
+		previous = transition.After
+	}
+
+	return nil
+}
+
+func (s ScenarioRule) matches(c chargeRequest) bool {
+	if s.OrderId != "" {
+		if ok, _ := path.Match(s.OrderId, c.TransactionDetails.OrderId); !ok {
+			return false
+		}
+	}
+
+	if s.GrossAmount != 0 && c.TransactionDetails.GrossAmount != s.GrossAmount {
+		return false
+	}
+
+	if s.Email != "" {
+		if ok, _ := path.Match(strings.ToLower(s.Email), strings.ToLower(c.CustomerDetails.Email)); !ok {
+			return false
+		}
+	}
+
+	if s.PaymentType != "" && c.PaymentType != s.PaymentType {
+		return false
+	}
+
+	return true
+}
+
+// EvaluateScenario returns the first scenario rule that matches the charge, if any does.
+func (d *Dependencies) EvaluateScenario(c chargeRequest) (ScenarioRule, bool) {
+	for _, rule := range d.ScenarioRules {
+		if rule.matches(c) {
+			return rule, true
+		}
+	}
+
+	return ScenarioRule{}, false
+}
+
+// waitLatency sleeps for the latency, or until the client gives up.
+func waitLatency(ctx context.Context, latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// notifyScenario notifies the merchant about the transaction, the way the scenario says.
+func (d *Dependencies) notifyScenario(transaction Transaction, scenario ScenarioRule) {
+	if scenario.SkipNotifications {
+		return
+	}
+
+	if scenario.NotificationDelay <= 0 {
+		d.Notify(transaction)
+		return
+	}
+
+	d.notifying.add(1)
+	time.AfterFunc(time.Duration(scenario.NotificationDelay), func() {
+		defer d.notifying.done()
+		d.Notify(transaction)
+	})
+}
+
+// scenarioTransitions are the transitions of the scenarios that are yet to happen, in the
+// order that they were scheduled.
+type scenarioTransitions struct {
+	mu      sync.Mutex
+	pending []scenarioTransition
+	// running keeps the transitions of a transaction from being applied out of order, by
+	// two ExecuteDueScenarioTransitions at once.
+	running sync.Mutex
+}
+
+type scenarioTransition struct {
+	transactionId string
+	// from is the status that the transaction must still be in for the transition to happen.
+	from     TransactionStatus
+	to       TransactionStatus
+	at       time.Time
+	scenario ScenarioRule
+}
+
+// scheduleScenarioTransitions schedules the transitions of the scenario after the charge of
+// the transaction. ExecuteDueScenarioTransitions applies them once the Clock has reached them.
+func (d *Dependencies) scheduleScenarioTransitions(transaction Transaction, scenario ScenarioRule) {
+	if len(scenario.Transitions) == 0 {
+		return
+	}
+
+	d.scenarioTransitions.mu.Lock()
+	defer d.scenarioTransitions.mu.Unlock()
+
+	from := transaction.TransactionStatus
+	for _, transition := range scenario.Transitions {
+		d.scenarioTransitions.pending = append(d.scenarioTransitions.pending, scenarioTransition{
+			transactionId: transaction.Id,
+			from:          from,
+			to:            transition.TransactionStatus,
+			at:            transaction.CreatedAt.Add(time.Duration(transition.After)),
+			scenario:      scenario,
+		})
+		from = transition.TransactionStatus
+	}
+}
+
+// clearScenarioTransitions forgets the transitions that are yet to happen, whose transactions
+// are gone or are back to how they were before the transitions were scheduled.
+func (d *Dependencies) clearScenarioTransitions() {
+	d.scenarioTransitions.mu.Lock()
+	defer d.scenarioTransitions.mu.Unlock()
+
+	d.scenarioTransitions.pending = nil
+}
+
+// RunScenarioTransitions applies the scenario transitions that are due on every tick,
+// until the context is canceled.
+func (d *Dependencies) RunScenarioTransitions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.ExecuteDueScenarioTransitions(ctx)
+		}
+	}
+}
+
+// ExecuteDueScenarioTransitions moves the transactions through the transitions of their scenario
+// that the Clock has reached. The transitions of a transaction stop as soon as it is not in the
+// status that the scenario left it in, such as when a test settled it on its own.
+func (d *Dependencies) ExecuteDueScenarioTransitions(ctx context.Context) {
+	d.scenarioTransitions.running.Lock()
+	defer d.scenarioTransitions.running.Unlock()
+
+	now := d.Clock.Now()
+
+	d.scenarioTransitions.mu.Lock()
+	var due, pending []scenarioTransition
+	for _, transition := range d.scenarioTransitions.pending {
+		if transition.at.After(now) {
+			pending = append(pending, transition)
+		} else {
+			due = append(due, transition)
+		}
+	}
+	d.scenarioTransitions.pending = pending
+	d.scenarioTransitions.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+
+	stopped := make(map[string]bool)
+	for _, transition := range due {
+		if stopped[transition.transactionId] {
+			continue
+		}
+
+		transaction, err := d.applyScenarioTransition(ctx, transition)
+		if err != nil {
+			if !errors.Is(err, ErrTransactionStatusChanged) {
+				log.Printf("failed to apply the scenario of transaction %s: %v", transition.transactionId, err)
+			}
+
+			stopped[transition.transactionId] = true
+			continue
+		}
+
+		d.notifyScenario(transaction, transition.scenario)
+	}
+
+	if len(stopped) == 0 {
+		return
+	}
+
+	d.scenarioTransitions.mu.Lock()
+	pending = nil
+	for _, transition := range d.scenarioTransitions.pending {
+		if !stopped[transition.transactionId] {
+			pending = append(pending, transition)
+		}
+	}
+	d.scenarioTransitions.pending = pending
+	d.scenarioTransitions.mu.Unlock()
+}
+
+func (d *Dependencies) applyScenarioTransition(ctx context.Context, transition scenarioTransition) (Transaction, error) {
+	transaction, err := d.Storage.getTransaction(ctx, transition.transactionId)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	// The update only happens when the transaction is still in the status that was read
+	err = d.Storage.updateTransactionStatusFrom(ctx, transaction.Id, transition.from, transition.to, transaction.FraudStatus, transition.at)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	transaction.TransactionStatus = transition.to
+	transaction.UpdatedAt = transition.at
+	return transaction, nil
+}
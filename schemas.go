@@ -1,4 +1,4 @@
-package main
+package mocktrans
 
 import (
 	"context"
@@ -6,10 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 )
 
-func (d *Dependencies) MigrateSchema(ctx context.Context) error {
-	conn, err := d.DB.Conn(ctx)
+func (s *sqlStorage) migrate(ctx context.Context, defaultMerchantId string) error {
+	conn, err := s.DB.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
@@ -32,13 +33,27 @@ func (d *Dependencies) MigrateSchema(ctx context.Context) error {
 			payment_type VARCHAR(50) NOT NULL,
 			gross_amount BIGINT NOT NULL,
 			merchant_id VARCHAR(255),
+			transaction_status VARCHAR(50) NOT NULL,
+			fraud_status VARCHAR(50) NOT NULL,
+			masked_card VARCHAR(50),
+			bank VARCHAR(50),
+			payment_link_id VARCHAR(50),
+			subscription_id VARCHAR(36),
 			metadata TEXT,
 			custom_field_1 VARCHAR(255),
 			custom_field_2 VARCHAR(255),
 			custom_field_3 VARCHAR(255),
-			created_at DATETIME NOT NULL
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
 		)`,
 		`CREATE INDEX IF NOT EXISTS transactions_order_id_idx ON transactions (order_id)`,
+		`CREATE TABLE IF NOT EXISTS transaction_status_history (
+			transaction_id VARCHAR(36) NOT NULL,
+			transaction_status VARCHAR(50) NOT NULL,
+			fraud_status VARCHAR(50) NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS transaction_status_history_transaction_id_idx ON transaction_status_history (transaction_id)`,
 		`CREATE TABLE IF NOT EXISTS transaction_virtual_account (
 			id VARCHAR(36) PRIMARY KEY,
 			transaction_id VARCHAR(36) NOT NULL,
@@ -47,6 +62,86 @@ func (d *Dependencies) MigrateSchema(ctx context.Context) error {
 			created_at DATETIME NOT NULL
 		)`,
 		`CREATE INDEX IF NOT EXISTS transaction_virtual_account_transaction_id_idx ON transaction_virtual_account (transaction_id)`,
+		`CREATE TABLE IF NOT EXISTS snap_transactions (
+			token VARCHAR(36) PRIMARY KEY,
+			transaction_id VARCHAR(36),
+			merchant_id VARCHAR(255),
+			order_id VARCHAR(50) NOT NULL,
+			payment_link_id VARCHAR(50),
+			request TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expired_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS snap_transactions_transaction_id_idx ON snap_transactions (transaction_id)`,
+		`CREATE TABLE IF NOT EXISTS payment_links (
+			id VARCHAR(50) PRIMARY KEY,
+			merchant_id VARCHAR(255),
+			order_id VARCHAR(50) NOT NULL,
+			usage_limit BIGINT NOT NULL,
+			request TEXT NOT NULL,
+			expired_at DATETIME,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS payment_links_order_id_idx ON payment_links (order_id)`,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			id VARCHAR(36) PRIMARY KEY,
+			merchant_id VARCHAR(255),
+			status VARCHAR(20) NOT NULL,
+			request TEXT NOT NULL,
+			current_interval BIGINT NOT NULL,
+			current_retry BIGINT NOT NULL,
+			next_execution_at DATETIME,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS subscriptions_next_execution_at_idx ON subscriptions (status, next_execution_at)`,
+		`CREATE TABLE IF NOT EXISTS gopay_accounts (
+			id VARCHAR(36) PRIMARY KEY,
+			merchant_id VARCHAR(255),
+			status VARCHAR(20) NOT NULL,
+			phone_number VARCHAR(20) NOT NULL,
+			country_code VARCHAR(5) NOT NULL,
+			redirect_url TEXT,
+			reference_id VARCHAR(36) NOT NULL,
+			wallet_token VARCHAR(36) NOT NULL,
+			pay_later_token VARCHAR(36) NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS saved_cards (
+			saved_token_id VARCHAR(64) PRIMARY KEY,
+			merchant_id VARCHAR(255) NOT NULL,
+			masked_card VARCHAR(20) NOT NULL,
+			bank VARCHAR(20) NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS iris_beneficiaries (
+			alias_name VARCHAR(20) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			account VARCHAR(50) NOT NULL,
+			bank VARCHAR(20) NOT NULL,
+			email VARCHAR(255),
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS iris_payouts (
+			reference_no VARCHAR(20) PRIMARY KEY,
+			beneficiary_name VARCHAR(255) NOT NULL,
+			beneficiary_account VARCHAR(50) NOT NULL,
+			beneficiary_bank VARCHAR(20) NOT NULL,
+			beneficiary_email VARCHAR(255),
+			amount BIGINT NOT NULL,
+			notes VARCHAR(100) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			created_by VARCHAR(20) NOT NULL,
+			error_code VARCHAR(20),
+			error_message TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS iris_payouts_status_idx ON iris_payouts (status)`,
+		createIdempotentResponsesTable,
 		`CREATE TABLE IF NOT EXISTS webhook_history (
 			transaction_id VARCHAR(36) NOT NULL,
 			event_type VARCHAR(50) NOT NULL,
@@ -68,6 +163,32 @@ func (d *Dependencies) MigrateSchema(ctx context.Context) error {
 		}
 	}
 
+	for _, column := range addedColumns {
+		err := s.addColumn(ctx, tx, column, defaultMerchantId)
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.column, err)
+		}
+	}
+
+	err = s.backfillTransactionMerchants(ctx, tx, defaultMerchantId)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+		return fmt.Errorf("failed to backfill transactions.merchant_id: %w", err)
+	}
+
+	err = s.migrateIdempotentResponses(ctx, tx, defaultMerchantId)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+		return fmt.Errorf("failed to migrate idempotent_responses: %w", err)
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		if e := tx.Rollback(); e != nil && !errors.Is(err, sql.ErrTxDone) {
@@ -83,3 +204,278 @@ func (d *Dependencies) MigrateSchema(ctx context.Context) error {
 
 	return nil
 }
+
+const createIdempotentResponsesTable = `CREATE TABLE IF NOT EXISTS idempotent_responses (
+	merchant_id VARCHAR(255) NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	request_hash VARCHAR(64) NOT NULL DEFAULT '',
+	status_code INT NOT NULL,
+	body TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (merchant_id, idempotency_key)
+)`
+
+// addedColumn is a column that was added to a table after the table was first created.
+type addedColumn struct {
+	table      string
+	column     string
+	definition string
+	// backfill sets the column of the rows that the table had already, when its default can not.
+	// It is given the ID of the default merchant as $1 when it has a placeholder.
+	backfill string
+	// index is created once the column exists, on new and old tables alike.
+	index string
+}
+
+// addedColumns are added with ALTER TABLE to the tables that an older Mocktrans created, which
+// CREATE TABLE IF NOT EXISTS leaves as they are. NOT NULL columns need a default for those rows.
+var addedColumns = []addedColumn{
+	{table: "transactions", column: "transaction_status", definition: "VARCHAR(50) NOT NULL DEFAULT 'pending'"},
+	{table: "transactions", column: "fraud_status", definition: "VARCHAR(50) NOT NULL DEFAULT 'accept'"},
+	{table: "transactions", column: "masked_card", definition: "VARCHAR(50)"},
+	{table: "transactions", column: "bank", definition: "VARCHAR(50)"},
+	{
+		table:      "transactions",
+		column:     "updated_at",
+		definition: "DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00'",
+		backfill:   "UPDATE transactions SET updated_at = created_at",
+	},
+	{
+		table:      "transactions",
+		column:     "payment_link_id",
+		definition: "VARCHAR(50)",
+		index:      "CREATE INDEX IF NOT EXISTS transactions_payment_link_id_idx ON transactions (payment_link_id)",
+	},
+	{table: "snap_transactions", column: "payment_link_id", definition: "VARCHAR(50)"},
+	{table: "snap_transactions", column: "merchant_id", definition: "VARCHAR(255)", backfill: "UPDATE snap_transactions SET merchant_id = $1"},
+	{table: "payment_links", column: "merchant_id", definition: "VARCHAR(255)", backfill: "UPDATE payment_links SET merchant_id = $1"},
+	{table: "subscriptions", column: "merchant_id", definition: "VARCHAR(255)", backfill: "UPDATE subscriptions SET merchant_id = $1"},
+	{table: "gopay_accounts", column: "merchant_id", definition: "VARCHAR(255)", backfill: "UPDATE gopay_accounts SET merchant_id = $1"},
+	{
+		table:      "transactions",
+		column:     "subscription_id",
+		definition: "VARCHAR(36)",
+		index:      "CREATE INDEX IF NOT EXISTS transactions_subscription_id_idx ON transactions (subscription_id)",
+	},
+	{table: "idempotent_responses", column: "request_hash", definition: "VARCHAR(64) NOT NULL DEFAULT ''"},
+}
+
+// addColumn adds the column to its table, unless the table has it already.
+func (s *sqlStorage) addColumn(ctx context.Context, tx *sql.Tx, column addedColumn, defaultMerchantId string) error {
+	exists, err := s.columnExists(ctx, tx, column.table, column.column)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		_, err = tx.ExecContext(ctx, `ALTER TABLE `+column.table+` ADD COLUMN `+column.column+` `+column.definition)
+		if err != nil {
+			return fmt.Errorf("failed to alter table: %w", err)
+		}
+
+		if column.backfill != "" {
+			var args []any
+			if strings.Contains(column.backfill, "$1") {
+				args = append(args, defaultMerchantId)
+			}
+
+			query, err := s.formatPlaceholder(column.backfill)
+			if err != nil {
+				return fmt.Errorf("failed to format placeholder: %w", err)
+			}
+
+			_, err = tx.ExecContext(ctx, query, args...)
+			if err != nil {
+				return fmt.Errorf("failed to backfill column: %w", err)
+			}
+		}
+	}
+
+	if column.index != "" {
+		_, err = tx.ExecContext(ctx, column.index)
+		if err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// backfillTransactionMerchants gives the transactions that predate merchants to the default merchant.
+// The transactions table always had a merchant_id column, which an older Mocktrans left empty, so
+// the column is not added and backfilled like the ones of addedColumns.
+func (s *sqlStorage) backfillTransactionMerchants(ctx context.Context, tx *sql.Tx, defaultMerchantId string) error {
+	query, err := s.formatPlaceholder(`UPDATE transactions SET merchant_id = $1 WHERE merchant_id IS NULL OR merchant_id = ''`)
+	if err != nil {
+		return fmt.Errorf("failed to format placeholder: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, defaultMerchantId)
+	if err != nil {
+		return fmt.Errorf("failed to update transactions: %w", err)
+	}
+
+	return nil
+}
+
+// migrateIdempotentResponses moves the idempotent responses of a table that was keyed by the
+// Idempotency-Key alone, before there were several merchants, into a table that is keyed by
+// the merchant as well. A primary key can not be changed in place by every dialect.
+func (s *sqlStorage) migrateIdempotentResponses(ctx context.Context, tx *sql.Tx, defaultMerchantId string) error {
+	exists, err := s.columnExists(ctx, tx, "idempotent_responses", "merchant_id")
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `ALTER TABLE idempotent_responses RENAME TO idempotent_responses_old`)
+	if err != nil {
+		return fmt.Errorf("failed to rename table: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, createIdempotentResponsesTable)
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	query, err := s.formatPlaceholder(`INSERT INTO
+		idempotent_responses
+		(
+			merchant_id,
+			idempotency_key,
+			status_code,
+			body,
+			created_at
+		)
+	SELECT
+		$1,
+		idempotency_key,
+		status_code,
+		body,
+		created_at
+	FROM
+		idempotent_responses_old`)
+	if err != nil {
+		return fmt.Errorf("failed to format placeholder: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, defaultMerchantId)
+	if err != nil {
+		return fmt.Errorf("failed to copy idempotent responses: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DROP TABLE idempotent_responses_old`)
+	if err != nil {
+		return fmt.Errorf("failed to drop table: %w", err)
+	}
+
+	return nil
+}
+
+// columnExists looks the column up in the catalog of the database, which every dialect keeps its own way.
+func (s *sqlStorage) columnExists(ctx context.Context, tx *sql.Tx, table string, column string) (bool, error) {
+	var query string
+	switch s.DatabaseProvider {
+	case "sqlite3", "sqlite":
+		query = `SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`
+	case "mysql":
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = $1 AND column_name = $2`
+	default:
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`
+	}
+
+	query, err := s.formatPlaceholder(query)
+	if err != nil {
+		return false, fmt.Errorf("failed to format placeholder: %w", err)
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, query, table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up column: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// dataTables are every table that MigrateSchema creates.
+var dataTables = []string{
+	"transactions",
+	"transaction_status_history",
+	"transaction_virtual_account",
+	"snap_transactions",
+	"payment_links",
+	"subscriptions",
+	"gopay_accounts",
+	"saved_cards",
+	"iris_beneficiaries",
+	"iris_payouts",
+	"idempotent_responses",
+	"webhook_history",
+}
+
+// reset deletes the rows of every table in a single transaction, which leaves the
+// database as if it was just migrated. DELETE is used instead of TRUNCATE because
+// MySQL commits a TRUNCATE on its own.
+func (s *sqlStorage) reset(ctx context.Context) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	for _, table := range dataTables {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+table)
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// isEmpty tells whether nothing was stored yet, which is when a SEED_FILE is loaded.
+func (s *sqlStorage) isEmpty(ctx context.Context) (bool, error) {
+	for _, table := range dataTables {
+		var count int
+		err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&count)
+		if err != nil {
+			return false, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+
+		if count > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
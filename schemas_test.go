@@ -0,0 +1,104 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrateBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "mocktrans.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// The schema and the data of the first Mocktrans, which had no merchants.
+	queries := []string{
+		`CREATE TABLE transactions (
+			id VARCHAR(36) PRIMARY KEY,
+			order_id VARCHAR(50) NOT NULL,
+			payment_type VARCHAR(50) NOT NULL,
+			gross_amount BIGINT NOT NULL,
+			merchant_id VARCHAR(255),
+			metadata TEXT,
+			custom_field_1 VARCHAR(255),
+			custom_field_2 VARCHAR(255),
+			custom_field_3 VARCHAR(255),
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX transactions_order_id_idx ON transactions (order_id)`,
+		`CREATE TABLE transaction_virtual_account (
+			id VARCHAR(36) PRIMARY KEY,
+			transaction_id VARCHAR(36) NOT NULL,
+			va_number VARCHAR(50) NOT NULL,
+			bank VARCHAR(50) NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX transaction_virtual_account_transaction_id_idx ON transaction_virtual_account (transaction_id)`,
+		`CREATE TABLE webhook_history (
+			transaction_id VARCHAR(36) NOT NULL,
+			event_type VARCHAR(50) NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			data TEXT NOT NULL,
+			success BOOLEAN NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX webhook_history_transaction_id_idx ON webhook_history (transaction_id)`,
+		`INSERT INTO transactions (id, order_id, payment_type, gross_amount, merchant_id, created_at)
+			VALUES ('6c3dc7a8-6f6f-4a2e-9b6e-0f3f1c3c2a10', 'order-1', 'gopay', 10000, NULL, '2024-03-01 10:00:00')`,
+	}
+	for _, query := range queries {
+		_, err := db.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to create the baseline schema: %v", err)
+		}
+	}
+
+	storage := NewSQLStorage(db, "sqlite3")
+	err = storage.migrate(ctx, "G000000000")
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	d := &Dependencies{
+		Storage: storage,
+		Clock:   SystemClock{},
+		Merchants: []Merchant{{
+			MerchantId: "G000000000",
+			ServerKey:  "SB-Mid-server-abc123cde456",
+			ClientKey:  "SB-Mid-client-abc123cde456",
+		}},
+		AdminKey:  "MOCKTRANS-admin-abc123",
+		Snapshots: NewSnapshotStore(),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v2/order-1/status", nil)
+	r.SetBasicAuth("SB-Mid-server-abc123cde456", "")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	d.Router().ServeHTTP(w, r)
+
+	var response struct {
+		OrderId    string `json:"order_id"`
+		MerchantId string `json:"merchant_id"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("failed to decode response %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusOK || response.OrderId != "order-1" {
+		t.Fatalf("expected the status of order-1, got %d %s", w.Code, w.Body.String())
+	}
+	if response.MerchantId != "G000000000" {
+		t.Errorf("expected order-1 to belong to the default merchant, got %q", response.MerchantId)
+	}
+}
@@ -0,0 +1,512 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Seed is the content of a SEED_FILE, the historical data that a demo or staging
+// environment starts with. Everything but the merchants goes into the database.
+type Seed struct {
+	// Merchants are added to the configured merchants, for as long as Mocktrans runs with the seed file.
+	Merchants     []Merchant         `json:"merchants"`
+	Transactions  []seedTransaction  `json:"transactions"`
+	Subscriptions []seedSubscription `json:"subscriptions"`
+	GopayAccounts []seedGopayAccount `json:"gopay_accounts"`
+	SavedCards    []seedSavedCard    `json:"saved_cards"`
+}
+
+type seedTransaction struct {
+	// TransactionId is generated when empty.
+	TransactionId     string                  `json:"transaction_id"`
+	OrderId           string                  `json:"order_id"`
+	MerchantId        string                  `json:"merchant_id"`
+	PaymentType       string                  `json:"payment_type"`
+	GrossAmount       int64                   `json:"gross_amount"`
+	TransactionStatus TransactionStatus       `json:"transaction_status"`
+	FraudStatus       FraudStatus             `json:"fraud_status"`
+	MaskedCard        string                  `json:"masked_card"`
+	Bank              string                  `json:"bank"`
+	VaNumbers         []VirtualAccountNumbers `json:"va_numbers"`
+	Metadata          map[string]interface{}  `json:"metadata"`
+	CustomField1      string                  `json:"custom_field1"`
+	CustomField2      string                  `json:"custom_field2"`
+	CustomField3      string                  `json:"custom_field3"`
+	// TransactionTime is in Western Indonesian Time, like Midtrans sends it. Defaults to the time of seeding.
+	TransactionTime string `json:"transaction_time"`
+}
+
+type seedSubscription struct {
+	subscriptionRequest
+	// SubscriptionId is generated when empty.
+	SubscriptionId  string             `json:"subscription_id"`
+	MerchantId      string             `json:"merchant_id"`
+	Status          SubscriptionStatus `json:"status"`
+	CurrentInterval int64              `json:"current_interval"`
+	// NextExecutionAt is formatted like the schedule's start_time, which it defaults to for active subscriptions.
+	NextExecutionAt string `json:"next_execution_at"`
+}
+
+type seedGopayAccount struct {
+	// AccountId is generated when empty, like the tokens.
+	AccountId     string             `json:"account_id"`
+	MerchantId    string             `json:"merchant_id"`
+	Status        GopayAccountStatus `json:"status"`
+	PhoneNumber   string             `json:"phone_number"`
+	CountryCode   string             `json:"country_code"`
+	WalletToken   string             `json:"wallet_token"`
+	PayLaterToken string             `json:"pay_later_token"`
+}
+
+type seedSavedCard struct {
+	// SavedTokenId is generated out of the masked card when empty, like the ones that Midtrans returns.
+	SavedTokenId string `json:"saved_token_id"`
+	MerchantId   string `json:"merchant_id"`
+	// MaskedCard is the first six and the last four digits of the card, like "481111-1114".
+	MaskedCard string `json:"masked_card"`
+	Bank       string `json:"bank"`
+}
+
+// seedRecords are the records of a seed that go into the storage.
+type seedRecords struct {
+	transactions    []Transaction
+	virtualAccounts []VirtualAccount
+	subscriptions   []Subscription
+	gopayAccounts   []GopayAccount
+	savedCards      []SavedCard
+}
+
+// LoadSeed reads a seed file, which is YAML when its extension is .yaml or .yml and JSON otherwise.
+func LoadSeed(path string) (Seed, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Seed{}, fmt.Errorf("failed to read seed file: %w", err)
+	}
+
+	extension := strings.ToLower(filepath.Ext(path))
+	if extension == ".yaml" || extension == ".yml" {
+		content, err = yamlToJson(content)
+		if err != nil {
+			return Seed{}, fmt.Errorf("failed to parse seed file: %w", err)
+		}
+	}
+
+	var seed Seed
+	err = json.Unmarshal(content, &seed)
+	if err != nil {
+		return Seed{}, fmt.Errorf("failed to parse seed file: %w", err)
+	}
+
+	return seed, nil
+}
+
+// yamlToJson converts YAML into JSON, so that a YAML seed file uses the same field names as a JSON one.
+func yamlToJson(content []byte) ([]byte, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if err != nil {
+		return nil, err
+	}
+
+	// Times are formatted by Midtrans' layouts, which YAML would turn into RFC 3339
+	keepTimestampsAsStrings(&node)
+
+	var value interface{}
+	err = node.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+func keepTimestampsAsStrings(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+
+	for _, child := range node.Content {
+		keepTimestampsAsStrings(child)
+	}
+}
+
+// SeedData inserts the seed into the database. Records that refer to a merchant_id
+// must refer to a configured merchant, and default to the first merchant. The seed is
+// inserted within one database transaction, so that a mistake does not leave half a seed.
+func (d *Dependencies) SeedData(ctx context.Context, seed Seed) error {
+	now := d.Clock.Now()
+
+	var records seedRecords
+	for i, entry := range seed.Transactions {
+		transaction, err := d.seedTransaction(entry, now)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		records.transactions = append(records.transactions, transaction)
+
+		for _, vaNumber := range entry.VaNumbers {
+			id, err := newId()
+			if err != nil {
+				return fmt.Errorf("transaction %d: %w", i, err)
+			}
+
+			records.virtualAccounts = append(records.virtualAccounts, VirtualAccount{
+				Id:            id,
+				TransactionId: transaction.Id,
+				VaNumber:      vaNumber.VaNumber,
+				Bank:          vaNumber.Bank,
+				CreatedAt:     transaction.CreatedAt,
+			})
+		}
+	}
+
+	for i, entry := range seed.Subscriptions {
+		subscription, err := d.seedSubscription(entry, now)
+		if err != nil {
+			return fmt.Errorf("subscription %d: %w", i, err)
+		}
+		records.subscriptions = append(records.subscriptions, subscription)
+	}
+
+	for i, entry := range seed.GopayAccounts {
+		account, err := d.seedGopayAccount(entry, now)
+		if err != nil {
+			return fmt.Errorf("gopay account %d: %w", i, err)
+		}
+		records.gopayAccounts = append(records.gopayAccounts, account)
+	}
+
+	for i, entry := range seed.SavedCards {
+		savedCard, err := d.seedSavedCard(entry, now)
+		if err != nil {
+			return fmt.Errorf("saved card %d: %w", i, err)
+		}
+		records.savedCards = append(records.savedCards, savedCard)
+	}
+
+	return d.Storage.insertSeed(ctx, records)
+}
+
+func (s *sqlStorage) insertSeed(ctx context.Context, records seedRecords) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	err = s.insertSeedTx(ctx, tx, records)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) insertSeedTx(ctx context.Context, tx *sql.Tx, records seedRecords) error {
+	for _, transaction := range records.transactions {
+		err := s.insertTransactionTx(ctx, tx, transaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, virtualAccount := range records.virtualAccounts {
+		err := s.insertVirtualAccountTx(ctx, tx, virtualAccount)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, subscription := range records.subscriptions {
+		err := s.insertSubscriptionTx(ctx, tx, subscription)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, account := range records.gopayAccounts {
+		err := s.insertGopayAccountTx(ctx, tx, account)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, savedCard := range records.savedCards {
+		err := s.insertSavedCardTx(ctx, tx, savedCard)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dependencies) seedTransaction(entry seedTransaction, now time.Time) (Transaction, error) {
+	merchantId, err := d.seedMerchantId(entry.MerchantId)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if entry.OrderId == "" {
+		return Transaction{}, fmt.Errorf("order_id is required")
+	}
+
+	knownPaymentType := false
+	for _, paymentType := range paymentTypes {
+		if entry.PaymentType == paymentType {
+			knownPaymentType = true
+		}
+	}
+
+	if !knownPaymentType {
+		return Transaction{}, fmt.Errorf("unknown payment_type of %s", entry.PaymentType)
+	}
+
+	if entry.GrossAmount <= 0 {
+		return Transaction{}, fmt.Errorf("gross_amount must be positive")
+	}
+
+	switch entry.TransactionStatus {
+	case TransactionStatusPending, TransactionStatusCapture, TransactionStatusSettlement, TransactionStatusDeny, TransactionStatusCancel, TransactionStatusExpire, TransactionStatusRefund:
+	default:
+		return Transaction{}, fmt.Errorf("unknown transaction_status of %s", entry.TransactionStatus)
+	}
+
+	switch entry.FraudStatus {
+	case "":
+		entry.FraudStatus = FraudStatusAccept
+	case FraudStatusAccept, FraudStatusChallenge, FraudStatusDeny:
+	default:
+		return Transaction{}, fmt.Errorf("unknown fraud_status of %s", entry.FraudStatus)
+	}
+
+	createdAt := now
+	if entry.TransactionTime != "" {
+		createdAt, err = time.ParseInLocation(transactionTimeLayout, entry.TransactionTime, transactionTimeLocation)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("transaction_time must be formatted as %s", transactionTimeLayout)
+		}
+	}
+
+	if entry.TransactionId == "" {
+		entry.TransactionId, err = newId()
+		if err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	return Transaction{
+		Id:                entry.TransactionId,
+		OrderId:           entry.OrderId,
+		PaymentType:       entry.PaymentType,
+		GrossAmount:       entry.GrossAmount,
+		MerchantId:        merchantId,
+		TransactionStatus: entry.TransactionStatus,
+		FraudStatus:       entry.FraudStatus,
+		MaskedCard:        entry.MaskedCard,
+		Bank:              entry.Bank,
+		Metadata:          entry.Metadata,
+		CustomField1:      entry.CustomField1,
+		CustomField2:      entry.CustomField2,
+		CustomField3:      entry.CustomField3,
+		CreatedAt:         createdAt,
+		UpdatedAt:         createdAt,
+	}, nil
+}
+
+func (d *Dependencies) seedSubscription(entry seedSubscription, now time.Time) (Subscription, error) {
+	merchantId, err := d.seedMerchantId(entry.MerchantId)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	req := entry.subscriptionRequest
+	if req.Currency == "" {
+		req.Currency = "IDR"
+	}
+	if req.Schedule.StartTime == "" {
+		req.Schedule.StartTime = now.In(transactionTimeLocation).Format(subscriptionTimeLayout)
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		return Subscription{}, fmt.Errorf("%s", strings.Join(validationErrors, ", "))
+	}
+
+	switch entry.Status {
+	case "":
+		entry.Status = SubscriptionStatusActive
+	case SubscriptionStatusActive, SubscriptionStatusInactive, SubscriptionStatusExpired, SubscriptionStatusCanceled:
+	default:
+		return Subscription{}, fmt.Errorf("unknown status of %s", entry.Status)
+	}
+
+	// Only active subscriptions are charged, like the ones that are created through the API
+	var nextExecutionAt *time.Time
+	if entry.NextExecutionAt != "" {
+		parsed, err := time.Parse(subscriptionTimeLayout, entry.NextExecutionAt)
+		if err != nil {
+			return Subscription{}, fmt.Errorf("next_execution_at must be formatted as %s", subscriptionTimeLayout)
+		}
+		nextExecutionAt = &parsed
+	} else if entry.Status == SubscriptionStatusActive {
+		// Validate has made sure that the start time is parseable
+		startTime, _ := time.Parse(subscriptionTimeLayout, req.Schedule.StartTime)
+		nextExecutionAt = &startTime
+	}
+
+	if entry.SubscriptionId == "" {
+		entry.SubscriptionId, err = newId()
+		if err != nil {
+			return Subscription{}, err
+		}
+	}
+
+	return Subscription{
+		Id:              entry.SubscriptionId,
+		MerchantId:      merchantId,
+		Status:          entry.Status,
+		Request:         req,
+		CurrentInterval: entry.CurrentInterval,
+		NextExecutionAt: nextExecutionAt,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, nil
+}
+
+func (d *Dependencies) seedGopayAccount(entry seedGopayAccount, now time.Time) (GopayAccount, error) {
+	merchantId, err := d.seedMerchantId(entry.MerchantId)
+	if err != nil {
+		return GopayAccount{}, err
+	}
+
+	if entry.PhoneNumber == "" {
+		return GopayAccount{}, fmt.Errorf("phone_number is required")
+	}
+
+	if entry.CountryCode == "" {
+		entry.CountryCode = "62"
+	}
+
+	// Seeded accounts are linked already, unless told otherwise
+	switch entry.Status {
+	case "":
+		entry.Status = GopayAccountStatusEnabled
+	case GopayAccountStatusPending, GopayAccountStatusEnabled, GopayAccountStatusDisabled, GopayAccountStatusExpired:
+	default:
+		return GopayAccount{}, fmt.Errorf("unknown status of %s", entry.Status)
+	}
+
+	ids := []*string{&entry.AccountId, &entry.WalletToken, &entry.PayLaterToken}
+	for _, id := range ids {
+		if *id == "" {
+			*id, err = newId()
+			if err != nil {
+				return GopayAccount{}, err
+			}
+		}
+	}
+
+	referenceId, err := newId()
+	if err != nil {
+		return GopayAccount{}, err
+	}
+
+	return GopayAccount{
+		Id:            entry.AccountId,
+		MerchantId:    merchantId,
+		Status:        entry.Status,
+		PhoneNumber:   entry.PhoneNumber,
+		CountryCode:   entry.CountryCode,
+		ReferenceId:   referenceId,
+		WalletToken:   entry.WalletToken,
+		PayLaterToken: entry.PayLaterToken,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// maskedCardPattern is the masked_card of Midtrans, the first six and the last four digits of the card.
+var maskedCardPattern = regexp.MustCompile(`^[0-9]{6}-[0-9]{4}$`)
+
+func (d *Dependencies) seedSavedCard(entry seedSavedCard, now time.Time) (SavedCard, error) {
+	merchantId, err := d.seedMerchantId(entry.MerchantId)
+	if err != nil {
+		return SavedCard{}, err
+	}
+
+	if !maskedCardPattern.MatchString(entry.MaskedCard) {
+		return SavedCard{}, fmt.Errorf("masked_card must look like 481111-1114")
+	}
+
+	// A saved token_id starts with the first six digits and ends with the last four,
+	// which is how a charge of it gets its masked_card
+	if entry.SavedTokenId == "" {
+		id, err := newId()
+		if err != nil {
+			return SavedCard{}, err
+		}
+
+		entry.SavedTokenId = entry.MaskedCard[:6] + strings.ReplaceAll(id, "-", "")[:22] + entry.MaskedCard[7:]
+	}
+
+	return SavedCard{
+		SavedTokenId: entry.SavedTokenId,
+		MerchantId:   merchantId,
+		MaskedCard:   entry.MaskedCard,
+		Bank:         entry.Bank,
+		CreatedAt:    now,
+	}, nil
+}
+
+func (d *Dependencies) seedMerchantId(merchantId string) (string, error) {
+	if merchantId == "" {
+		return d.Merchants[0].MerchantId, nil
+	}
+
+	for _, merchant := range d.Merchants {
+		if merchant.MerchantId == merchantId {
+			return merchantId, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown merchant_id of %s", merchantId)
+}
@@ -0,0 +1,541 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Snap tokens are valid for 24 hours, unless the transaction is paid before that.
+const snapTokenLifetime = time.Hour * 24
+
+var ErrSnapTransactionNotFound = errors.New("snap transaction not found")
+
+// snapPayment is one of the enabled_payments of Snap, which the Snap page pays with a
+// charge of its PaymentType, at its Bank or Store.
+type snapPayment struct {
+	Name        string
+	PaymentType string
+	Bank        string
+	Store       string
+}
+
+// snapPayments are the enabled_payments that Snap knows of, in the order that the Snap
+// page lists them. other_va is paid into a Permata virtual account from any other bank.
+var snapPayments = []snapPayment{
+	{Name: "credit_card", PaymentType: "credit_card"},
+	{Name: "bca_va", PaymentType: "bank_transfer", Bank: "bca"},
+	{Name: "bni_va", PaymentType: "bank_transfer", Bank: "bni"},
+	{Name: "bri_va", PaymentType: "bank_transfer", Bank: "bri"},
+	{Name: "cimb_va", PaymentType: "bank_transfer", Bank: "cimb"},
+	{Name: "permata_va", PaymentType: "bank_transfer", Bank: "permata"},
+	{Name: "other_va", PaymentType: "bank_transfer", Bank: "permata"},
+	{Name: "echannel", PaymentType: "echannel"},
+	{Name: "gopay", PaymentType: "gopay"},
+	{Name: "shopeepay", PaymentType: "shopeepay"},
+	{Name: "qris", PaymentType: "qris"},
+	{Name: "indomaret", PaymentType: "cstore", Store: "indomaret"},
+	{Name: "alfamart", PaymentType: "cstore", Store: "alfamart"},
+	{Name: "akulaku", PaymentType: "akulaku"},
+	{Name: "kredivo", PaymentType: "kredivo"},
+	{Name: "bca_klikpay", PaymentType: "bca_klikpay"},
+	{Name: "bca_klikbca", PaymentType: "bca_klikbca"},
+	{Name: "bri_epay", PaymentType: "bri_epay"},
+	{Name: "cimb_clicks", PaymentType: "cimb_clicks"},
+	{Name: "danamon_online", PaymentType: "danamon_online"},
+	{Name: "uob_ezpay", PaymentType: "uob_ezpay"},
+}
+
+// snapPaymentNames returns the names of every snapPayments, which are enabled when
+// the request does not pick any.
+func snapPaymentNames() []string {
+	names := make([]string, 0, len(snapPayments))
+	for _, payment := range snapPayments {
+		names = append(names, payment.Name)
+	}
+
+	return names
+}
+
+func findSnapPayment(name string) (snapPayment, bool) {
+	for _, payment := range snapPayments {
+		if payment.Name == name {
+			return payment, true
+		}
+	}
+
+	return snapPayment{}, false
+}
+
+type snapRequest struct {
+	TransactionDetails TransactionDetail      `json:"transaction_details"`
+	ItemDetails        []ItemDetail           `json:"item_details"`
+	CustomerDetails    CustomerDetail         `json:"customer_details"`
+	EnabledPayments    []string               `json:"enabled_payments"`
+	CreditCard         CreditCard             `json:"credit_card"`
+	BankTransfer       BankTransfer           `json:"bank_transfer"`
+	Echannel           Echannel               `json:"echannel"`
+	Cstore             Cstore                 `json:"cstore"`
+	Gopay              Gopay                  `json:"gopay"`
+	Shopeepay          Shopeepay              `json:"shopeepay"`
+	BcaKlikpay         BcaKlikpay             `json:"bca_klikpay"`
+	BcaKlikbca         BcaKlikbca             `json:"bca_klikbca"`
+	CimbClicks         CimbClicks             `json:"cimb_clicks"`
+	UobEzpay           UobEzpay               `json:"uob_ezpay"`
+	BriEpay            BriEpay                `json:"bri_epay"`
+	DanamonOnline      DanamonOnline          `json:"danamon_online"`
+	BcaVa              SnapVirtualAccount     `json:"bca_va"`
+	BniVa              SnapVirtualAccount     `json:"bni_va"`
+	BriVa              SnapVirtualAccount     `json:"bri_va"`
+	PermataVa          SnapVirtualAccount     `json:"permata_va"`
+	CimbVa             SnapVirtualAccount     `json:"cimb_va"`
+	Callbacks          SnapCallbacks          `json:"callbacks"`
+	Expiry             SnapExpiry             `json:"expiry"`
+	PageExpiry         SnapPageExpiry         `json:"page_expiry"`
+	UserId             string                 `json:"user_id"`
+	Metadata           map[string]interface{} `json:"metadata"`
+	CustomField1       string                 `json:"custom_field1"`
+	CustomField2       string                 `json:"custom_field2"`
+	CustomField3       string                 `json:"custom_field3"`
+}
+
+// SnapVirtualAccount picks the virtual account number of a bank on the Snap page.
+type SnapVirtualAccount struct {
+	VaNumber       string         `json:"va_number"`
+	SubCompanyCode string         `json:"sub_company_code"`
+	RecipientName  string         `json:"recipient_name"`
+	FreeText       map[string]any `json:"free_text"`
+}
+
+// SnapExpiry is when the payment of a Snap transaction expires. It is accepted, but
+// Mocktrans keeps to its own expiries.
+type SnapExpiry struct {
+	StartTime string `json:"start_time"`
+	Unit      string `json:"unit"`
+	Duration  int64  `json:"duration"`
+}
+
+// SnapPageExpiry is how long the Snap page stays open, which is accepted as well.
+type SnapPageExpiry struct {
+	Duration int64  `json:"duration"`
+	Unit     string `json:"unit"`
+}
+
+type SnapCallbacks struct {
+	// Overrides the Finish Redirect URL for this transaction.
+	Finish string `json:"finish"`
+}
+
+type snapResponse struct {
+	Token       string `json:"token"`
+	RedirectUrl string `json:"redirect_url"`
+}
+
+type snapErrorResponse struct {
+	ErrorMessages []string `json:"error_messages"`
+}
+
+type SnapTransaction struct {
+	Token string
+	// TransactionId is empty until the customer picks a payment method.
+	TransactionId string
+	MerchantId    string
+	OrderId       string
+	// PaymentLinkId is set for the Snap transactions of a payment link's purchases.
+	PaymentLinkId string
+	Request       snapRequest
+	CreatedAt     time.Time
+	ExpiredAt     time.Time
+}
+
+// SnapTransaction creates a Snap token, which the customer uses to pay
+// on the hosted payment page with any of the enabled payment methods.
+func (d *Dependencies) SnapTransaction(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var req snapRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{err.Error()}})
+		return
+	}
+
+	// Validate request body
+	errorMessages := req.Validate()
+	if len(errorMessages) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: errorMessages})
+		return
+	}
+
+	// Midtrans refuses order_ids that have already been paid, or are waiting to be
+	merchant := merchantFromContext(r.Context())
+	previousTransactions, err := d.listOrderTransactions(r.Context(), merchant.MerchantId, req.TransactionDetails.OrderId)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	for _, previous := range previousTransactions {
+		if previous.TransactionStatus != TransactionStatusDeny {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(snapErrorResponse{ErrorMessages: []string{"transaction_details.order_id has already been taken"}})
+			return
+		}
+	}
+
+	snapTransaction, err := d.createSnapTransaction(r.Context(), merchant.MerchantId, req)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapResponse{
+		Token:       snapTransaction.Token,
+		RedirectUrl: d.snapPaymentPageUrl(snapTransaction.Token),
+	})
+}
+
+// createSnapTransaction stores a validated Snap request under a new token.
+func (d *Dependencies) createSnapTransaction(ctx context.Context, merchantId string, req snapRequest) (SnapTransaction, error) {
+	if len(req.EnabledPayments) == 0 {
+		req.EnabledPayments = snapPaymentNames()
+	}
+
+	token, err := newId()
+	if err != nil {
+		return SnapTransaction{}, err
+	}
+
+	now := d.Clock.Now()
+	snapTransaction := SnapTransaction{
+		Token:         token,
+		MerchantId:    merchantId,
+		OrderId:       req.TransactionDetails.OrderId,
+		PaymentLinkId: req.TransactionDetails.PaymentLinkId,
+		Request:       req,
+		CreatedAt:     now,
+		ExpiredAt:     now.Add(snapTokenLifetime),
+	}
+
+	err = d.Storage.insertSnapTransaction(ctx, snapTransaction)
+	if err != nil {
+		return SnapTransaction{}, err
+	}
+
+	return snapTransaction, nil
+}
+
+// Validate checks the parts of the request that do not depend on the payment method.
+// The rest is validated as a charge request once the customer picks one.
+func (s snapRequest) Validate() []string {
+	var errorMessages []string
+
+	if s.TransactionDetails.OrderId == "" {
+		errorMessages = append(errorMessages, "transaction_details.order_id is required")
+	}
+
+	if strings.ContainsAny(s.TransactionDetails.OrderId, "!@#$%^&*()+=[]{}|;':,/<>?\\") {
+		errorMessages = append(errorMessages, "transaction_details.order_id must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)")
+	}
+
+	if s.TransactionDetails.GrossAmount <= 0 {
+		errorMessages = append(errorMessages, "transaction_details.gross_amount must be greater than or equal to 0.01")
+	}
+
+	if reason := validateItemDetails(s.TransactionDetails.GrossAmount, s.ItemDetails); reason != "" {
+		errorMessages = append(errorMessages, reason)
+	}
+
+	for _, enabledPayment := range s.EnabledPayments {
+		if _, ok := findSnapPayment(enabledPayment); !ok {
+			errorMessages = append(errorMessages, fmt.Sprintf("enabled_payments contains unknown payment type of %s", enabledPayment))
+		}
+	}
+
+	return errorMessages
+}
+
+// chargeRequest converts the Snap request into the Core API charge request
+// of the payment method that the customer picked.
+func (s snapRequest) chargeRequest(payment snapPayment) chargeRequest {
+	req := chargeRequest{
+		PaymentType:        payment.PaymentType,
+		TransactionDetails: s.TransactionDetails,
+		ItemDetails:        s.ItemDetails,
+		CustomerDetails:    s.CustomerDetails,
+		CreditCard:         s.CreditCard,
+		BankTransfer:       s.BankTransfer,
+		Echannel:           s.Echannel,
+		Cstore:             s.Cstore,
+		Gopay:              s.Gopay,
+		Shopeepay:          s.Shopeepay,
+		BcaKlikpay:         s.BcaKlikpay,
+		BcaKlikbca:         s.BcaKlikbca,
+		CimbClicks:         s.CimbClicks,
+		UobEzpay:           s.UobEzpay,
+		BriEpay:            s.BriEpay,
+		DanamonOnline:      s.DanamonOnline,
+		Metadata:           s.Metadata,
+		CustomField1:       s.CustomField1,
+		CustomField2:       s.CustomField2,
+		CustomField3:       s.CustomField3,
+	}
+
+	if payment.Bank != "" {
+		req.BankTransfer.Bank = payment.Bank
+		// The number that the merchant picked for the bank on Snap, unless bank_transfer has one
+		virtualAccount := s.virtualAccount(payment.Name)
+		if req.BankTransfer.VaNumber == "" {
+			req.BankTransfer.VaNumber = virtualAccount.VaNumber
+		}
+		if req.BankTransfer.FreeText == nil {
+			req.BankTransfer.FreeText = virtualAccount.FreeText
+		}
+		if req.BankTransfer.BCA.SubCompanyCode == "" {
+			req.BankTransfer.BCA.SubCompanyCode = virtualAccount.SubCompanyCode
+		}
+		if req.BankTransfer.Permata.RecipientName == "" {
+			req.BankTransfer.Permata.RecipientName = virtualAccount.RecipientName
+		}
+	}
+
+	if payment.Store != "" {
+		req.Cstore.Store = payment.Store
+	}
+
+	return req
+}
+
+// virtualAccount returns the options of the Snap virtual account of the name.
+func (s snapRequest) virtualAccount(name string) SnapVirtualAccount {
+	switch name {
+	case "bca_va":
+		return s.BcaVa
+	case "bni_va":
+		return s.BniVa
+	case "bri_va":
+		return s.BriVa
+	case "permata_va":
+		return s.PermataVa
+	case "cimb_va":
+		return s.CimbVa
+	}
+
+	return SnapVirtualAccount{}
+}
+
+func (d *Dependencies) snapPaymentPageUrl(token string) string {
+	return d.PublicUrl + "/snap/v2/vtweb/" + token
+}
+
+func (s *sqlStorage) insertSnapTransaction(ctx context.Context, snapTransaction SnapTransaction) error {
+	request, err := json.Marshal(snapTransaction.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snap request: %w", err)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		snap_transactions
+		(
+			token,
+			merchant_id,
+			order_id,
+			payment_link_id,
+			request,
+			created_at,
+			expired_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		snapTransaction.Token,
+		snapTransaction.MerchantId,
+		snapTransaction.OrderId,
+		sql.NullString{String: snapTransaction.PaymentLinkId, Valid: snapTransaction.PaymentLinkId != ""},
+		string(request),
+		snapTransaction.CreatedAt,
+		snapTransaction.ExpiredAt,
+	)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to insert snap transaction: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// getSnapTransaction finds a Snap transaction by its token, or by the ID of
+// the transaction that was created out of it.
+func (s *sqlStorage) getSnapTransaction(ctx context.Context, id string) (SnapTransaction, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		token,
+		COALESCE(transaction_id, ''),
+		COALESCE(merchant_id, ''),
+		order_id,
+		COALESCE(payment_link_id, ''),
+		request,
+		created_at,
+		expired_at
+	FROM
+		snap_transactions
+	WHERE
+		token = $1
+		OR transaction_id = $2
+	LIMIT 1`)
+	if err != nil {
+		return SnapTransaction{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return SnapTransaction{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	var snapTransaction SnapTransaction
+	var request string
+	err = conn.QueryRowContext(ctx, formattedQuery, id, id).Scan(
+		&snapTransaction.Token,
+		&snapTransaction.TransactionId,
+		&snapTransaction.MerchantId,
+		&snapTransaction.OrderId,
+		&snapTransaction.PaymentLinkId,
+		&request,
+		&snapTransaction.CreatedAt,
+		&snapTransaction.ExpiredAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SnapTransaction{}, ErrSnapTransactionNotFound
+		}
+
+		return SnapTransaction{}, fmt.Errorf("failed to query snap transaction: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(request), &snapTransaction.Request)
+	if err != nil {
+		return SnapTransaction{}, fmt.Errorf("failed to unmarshal snap request: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return SnapTransaction{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return snapTransaction, nil
+}
+
+func (s *sqlStorage) updateSnapTransactionId(ctx context.Context, token string, transactionId string) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		snap_transactions
+	SET
+		transaction_id = $1
+	WHERE
+		token = $2`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, transactionId, token)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update snap transaction: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
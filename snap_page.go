@@ -0,0 +1,421 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const snapPaymentTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans Snap - Dummy Midtrans for Development purposes</title>
+
+	<style>` + pollenStyle + `
+
+		.container {
+			width: 100%;
+			max-width: var(--width-md);
+			margin: 0 auto;
+			font-family: var(--font-sans);
+		}
+
+		h1 {
+			font-size: var(--scale-3);
+			font-weight: var(--weight-bold);
+			padding-top: 1rem;
+		}
+
+		button {
+			display: block;
+			width: 100%;
+			margin-bottom: 0.5rem;
+			padding: 0.75rem;
+			border: none;
+			background-color: var(--color-blue-700);
+			color: var(--color-grey-50);
+			text-align: left;
+		}
+
+		button:hover {
+			cursor: pointer;
+		}
+	</style>
+
+	<script>
+		// Inside an iframe, the page was opened by snap.js
+		const embedded = window.parent !== window;
+
+		function backLink(event) {
+			if (embedded) {
+				event.preventDefault();
+				window.parent.postMessage({ type: "mocktrans:snap:close" }, "*");
+			}
+		}
+
+		window.addEventListener("DOMContentLoaded", function () {
+			if (embedded) {
+				document.getElementById("back-link").style.display = "inline";
+			}
+		});
+	</script>
+</head>
+
+<body>
+	<div class="container">
+		<h1>Select a payment method</h1>
+		<p>Order ID: {{order_id}}</p>
+		<p>Amount: IDR {{gross_amount}}</p>
+
+		<form method="POST" action="{{pay_url}}">
+{{payment_buttons}}
+		</form>
+
+		<a id="back-link" href="{{unfinish_url}}" style="display: {{unfinish_display}};" onclick="backLink(event)">Back to merchant</a>
+	</div>
+</body>
+
+</html>`
+
+// snapEmbeddedErrorTemplate reports a failed charge to snap.js, which calls onError.
+const snapEmbeddedErrorTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<title>Mocktrans Snap - Dummy Midtrans for Development purposes</title>
+	<script data-result="{{result}}">
+		window.parent.postMessage({ type: "mocktrans:snap:result", result: JSON.parse(document.currentScript.dataset.result) }, "*");
+	</script>
+</head>
+
+<body>
+	<p>{{status_message}}</p>
+</body>
+
+</html>`
+
+// snapPaymentTitles is how the enabled_payments are presented to the customer on Snap.
+var snapPaymentTitles = map[string]string{
+	"credit_card": "Credit/Debit Card",
+	"bca_va":      "BCA Virtual Account",
+	"bni_va":      "BNI Virtual Account",
+	"bri_va":      "BRI Virtual Account",
+	"cimb_va":     "CIMB Niaga Virtual Account",
+	"permata_va":  "Permata Virtual Account",
+	"other_va":    "Other Banks (ATM Bersama, Prima, Alto)",
+	"echannel":    "Mandiri Bill",
+	"qris":        "QRIS",
+	"gopay":       "GoPay",
+	"shopeepay":   "ShopeePay",
+	"indomaret":   "Indomaret",
+	"alfamart":    "Alfamart",
+}
+
+func snapPaymentTitle(payment snapPayment) string {
+	if title, ok := snapPaymentTitles[payment.Name]; ok {
+		return title
+	}
+
+	if brand, ok := redirectSimulatorBrand(payment.PaymentType); ok {
+		return brand.Name
+	}
+
+	return payment.Name
+}
+
+// SnapPaymentPage is the hosted payment page where the customer picks a payment method.
+func (d *Dependencies) SnapPaymentPage(w http.ResponseWriter, r *http.Request) {
+	snapTransaction, err := d.Storage.getSnapTransaction(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, ErrSnapTransactionNotFound) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A payment method was already picked, continue from there
+	if snapTransaction.TransactionId != "" {
+		http.Redirect(w, r, d.simulatorUrl(snapTransaction.TransactionId), http.StatusSeeOther)
+		return
+	}
+
+	if d.Clock.Now().After(snapTransaction.ExpiredAt) {
+		http.Error(w, "Transaction has expired", http.StatusGone)
+		return
+	}
+
+	payUrl := d.snapPaymentPageUrl(snapTransaction.Token) + "/pay"
+	if r.URL.Query().Get("embedded") == "1" {
+		payUrl += "?embedded=1"
+	}
+
+	var paymentButtons strings.Builder
+	for _, enabledPayment := range snapTransaction.Request.EnabledPayments {
+		payment, ok := findSnapPayment(enabledPayment)
+		if !ok {
+			continue
+		}
+
+		paymentButtons.WriteString(`			<button name="payment_type" value="` + html.EscapeString(payment.Name) + `">` + html.EscapeString(snapPaymentTitle(payment)) + "</button>\n")
+	}
+
+	unfinishUrl := snapRedirectUrl(d.SnapUnfinishUrl, snapTransaction.OrderId, "", "")
+	unfinishDisplay := "none"
+	if unfinishUrl != "" {
+		unfinishDisplay = "inline"
+	}
+
+	// Render the template
+	replacer := strings.NewReplacer(
+		"{{order_id}}", html.EscapeString(snapTransaction.OrderId),
+		"{{gross_amount}}", Transaction{GrossAmount: snapTransaction.Request.TransactionDetails.GrossAmount}.FormattedGrossAmount(),
+		"{{pay_url}}", html.EscapeString(payUrl),
+		"{{payment_buttons}}", paymentButtons.String(),
+		"{{unfinish_url}}", html.EscapeString(unfinishUrl),
+		"{{unfinish_display}}", unfinishDisplay,
+	)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(snapPaymentTemplate)))
+}
+
+// SnapPay charges the Snap transaction with the payment method picked by the customer,
+// then sends the customer either to the simulator page or back to the merchant.
+func (d *Dependencies) SnapPay(w http.ResponseWriter, r *http.Request) {
+	snapTransaction, err := d.Storage.getSnapTransaction(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, ErrSnapTransactionNotFound) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if snapTransaction.TransactionId != "" {
+		http.Redirect(w, r, d.simulatorUrl(snapTransaction.TransactionId), http.StatusSeeOther)
+		return
+	}
+
+	if d.Clock.Now().After(snapTransaction.ExpiredAt) {
+		http.Error(w, "Transaction has expired", http.StatusGone)
+		return
+	}
+
+	// The form sends the name of one of the enabled_payments
+	payment, _ := findSnapPayment(r.FormValue("payment_type"))
+	var enabled = false
+	for _, enabledPayment := range snapTransaction.Request.EnabledPayments {
+		if payment.Name != "" && payment.Name == enabledPayment {
+			enabled = true
+			break
+		}
+	}
+
+	if !enabled {
+		http.Error(w, "Payment method is not enabled for this transaction", http.StatusBadRequest)
+		return
+	}
+
+	// Opened by snap.js, which gets the result from the simulator page instead of a redirect
+	embedded := r.URL.Query().Get("embedded") == "1"
+
+	req := snapTransaction.Request.chargeRequest(payment)
+	req.TransactionDetails.PaymentLinkId = snapTransaction.PaymentLinkId
+	req.merchantId = snapTransaction.MerchantId
+	fillSnapChargeDefaults(&req, d.snapCallbackUrl(snapTransaction))
+
+	errorStatus, validationMessages := req.Validate()
+	reason := strings.Join(validationMessages, ", ")
+	if errorStatus != 0 && embedded {
+		result, err := json.Marshal(snapResult{
+			StatusCode:    strconv.Itoa(int(errorStatus)),
+			StatusMessage: reason,
+			OrderId:       snapTransaction.OrderId,
+			PaymentType:   payment.PaymentType,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		replacer := strings.NewReplacer(
+			"{{result}}", html.EscapeString(string(result)),
+			"{{status_message}}", html.EscapeString(reason),
+		)
+
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(replacer.Replace(snapEmbeddedErrorTemplate)))
+		return
+	}
+
+	if errorStatus != 0 {
+		errorUrl := d.snapErrorUrl(snapTransaction)
+		if errorUrl == "" {
+			http.Error(w, reason, http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, snapRedirectUrl(errorUrl, snapTransaction.OrderId, "400", ""), http.StatusSeeOther)
+		return
+	}
+
+	response, err := d.charge(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateOrderId) {
+			http.Error(w, "Order ID has already been utilized", int(ErrorDuplicateOrderId))
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = d.Storage.updateSnapTransactionId(r.Context(), snapTransaction.Token, response.TransactionId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Customer still needs to pay, which is done on the simulator page
+	if response.TransactionStatus == string(TransactionStatusPending) || embedded {
+		http.Redirect(w, r, d.simulatorUrl(response.TransactionId), http.StatusSeeOther)
+		return
+	}
+
+	redirectUrl := d.snapFinishUrl(snapTransaction)
+	if response.TransactionStatus == string(TransactionStatusDeny) {
+		redirectUrl = d.snapErrorUrl(snapTransaction)
+	}
+
+	if redirectUrl == "" {
+		http.Redirect(w, r, d.simulatorUrl(response.TransactionId), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, snapRedirectUrl(redirectUrl, response.OrderId, response.StatusCode, TransactionStatus(response.TransactionStatus)), http.StatusSeeOther)
+}
+
+// fillSnapChargeDefaults fills in what the customer would have typed on the
+// Snap page, but was not provided by the merchant. Banks that need to know where
+// to send the customer back to are given the callbackUrl.
+func fillSnapChargeDefaults(req *chargeRequest, callbackUrl string) {
+	description := "Payment for order " + req.TransactionDetails.OrderId
+
+	switch req.PaymentType {
+	case "credit_card":
+		if req.CreditCard.TokenId == "" {
+			req.CreditCard.TokenId = "481111-1114-" + req.TransactionDetails.OrderId
+		}
+	case "bank_transfer":
+		if req.BankTransfer.Bank == "" {
+			req.BankTransfer.Bank = "bca"
+		}
+	case "echannel":
+		if req.Echannel.BillInfo1 == "" {
+			req.Echannel.BillInfo1 = "Payment:"
+		}
+
+		if req.Echannel.BillInfo2 == "" {
+			req.Echannel.BillInfo2 = "Online purchase"
+		}
+	case "cstore":
+		if req.Cstore.Store == "" {
+			req.Cstore.Store = "alfamart"
+		}
+	case "bca_klikbca":
+		if req.BcaKlikbca.UserId == "" {
+			req.BcaKlikbca.UserId = "midtrans1012"
+		}
+
+		if req.BcaKlikbca.Description == "" {
+			req.BcaKlikbca.Description = description
+		}
+	case "bca_klikpay":
+		if req.BcaKlikpay.Type == 0 {
+			req.BcaKlikpay.Type = 1
+		}
+
+		if req.BcaKlikpay.Description == "" {
+			req.BcaKlikpay.Description = description
+		}
+	case "cimb_clicks":
+		if req.CimbClicks.Description == "" {
+			req.CimbClicks.Description = description
+		}
+	case "uob_ezpay":
+		if req.UobEzpay.CallbackUrl == "" {
+			req.UobEzpay.CallbackUrl = callbackUrl
+		}
+	}
+}
+
+// snapCallbackUrl is where a bank sends the customer back to after paying through
+// Snap, which is the Finish Redirect URL, or Mocktrans when there is none.
+func (d *Dependencies) snapCallbackUrl(snapTransaction SnapTransaction) string {
+	if finishUrl := d.snapFinishUrl(snapTransaction); finishUrl != "" {
+		return finishUrl
+	}
+
+	return d.PublicUrl
+}
+
+// snapFinishUrl returns the Finish Redirect URL, which callbacks.finish overrides.
+func (d *Dependencies) snapFinishUrl(snapTransaction SnapTransaction) string {
+	if snapTransaction.Request.Callbacks.Finish != "" {
+		return snapTransaction.Request.Callbacks.Finish
+	}
+
+	return d.SnapFinishUrl
+}
+
+// snapErrorUrl returns the Error Redirect URL, falling back to the Finish Redirect URL.
+func (d *Dependencies) snapErrorUrl(snapTransaction SnapTransaction) string {
+	if d.SnapErrorUrl != "" {
+		return d.SnapErrorUrl
+	}
+
+	return d.snapFinishUrl(snapTransaction)
+}
+
+// snapRedirectUrl appends the query parameters that Midtrans sends back to the merchant's
+// redirect URL. It returns an empty string if there is nowhere to redirect to.
+func snapRedirectUrl(base string, orderId string, statusCode string, transactionStatus TransactionStatus) string {
+	if base == "" {
+		return ""
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+
+	query := u.Query()
+	query.Set("order_id", orderId)
+	if statusCode != "" {
+		query.Set("status_code", statusCode)
+	}
+	if transactionStatus != "" {
+		query.Set("transaction_status", string(transactionStatus))
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
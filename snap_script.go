@@ -0,0 +1,194 @@
+package mocktrans
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// snapJs is a drop-in replacement of Midtrans' snap.js. It opens the Snap payment
+// page in an iframe, and the pages inside it report back through postMessage.
+const snapJs = `(function () {
+	"use strict";
+
+	var script = document.currentScript;
+	var baseUrl = script ? script.src.replace(/\/snap\/snap\.js(\?.*)?$/, "") : "";
+	var baseOrigin = baseUrl ? new URL(baseUrl).origin : window.location.origin;
+
+	var frame = null;
+	var container = null;
+	var options = {};
+
+	function call(name, result) {
+		if (typeof options[name] === "function") {
+			options[name](result);
+		}
+	}
+
+	function paymentPageUrl(token) {
+		return baseUrl + "/snap/v2/vtweb/" + encodeURIComponent(token) + "?embedded=1";
+	}
+
+	function hide() {
+		if (container && container.parentNode && container.id === "mocktrans-snap-overlay") {
+			container.parentNode.removeChild(container);
+		} else if (frame && frame.parentNode) {
+			frame.parentNode.removeChild(frame);
+		}
+
+		frame = null;
+		container = null;
+	}
+
+	function createFrame(token) {
+		frame = document.createElement("iframe");
+		frame.src = paymentPageUrl(token);
+		frame.title = "Mocktrans Snap";
+		frame.style.border = "none";
+		frame.style.width = "100%";
+		frame.style.height = "100%";
+		frame.style.background = "#fff";
+		return frame;
+	}
+
+	function pay(token, payOptions) {
+		if (frame) {
+			throw new Error("snap.pay is not allowed to be called in this state");
+		}
+
+		options = payOptions || {};
+
+		container = document.createElement("div");
+		container.id = "mocktrans-snap-overlay";
+		container.style.position = "fixed";
+		container.style.top = "0";
+		container.style.left = "0";
+		container.style.width = "100%";
+		container.style.height = "100%";
+		container.style.zIndex = "2147483647";
+		container.style.background = "rgba(0, 0, 0, 0.5)";
+
+		var closeButton = document.createElement("button");
+		closeButton.type = "button";
+		closeButton.innerText = "×";
+		closeButton.setAttribute("aria-label", "Close");
+		closeButton.style.position = "absolute";
+		closeButton.style.top = "8px";
+		closeButton.style.right = "8px";
+		closeButton.style.zIndex = "1";
+		closeButton.onclick = function () {
+			hide();
+			call("onClose");
+		};
+
+		container.appendChild(closeButton);
+		container.appendChild(createFrame(token));
+		document.body.appendChild(container);
+	}
+
+	function embed(token, embedOptions) {
+		if (frame) {
+			throw new Error("snap.embed is not allowed to be called in this state");
+		}
+
+		options = embedOptions || {};
+
+		var target = document.getElementById(options.embedId);
+		if (!target) {
+			throw new Error("snap.embed requires an existing element for embedId");
+		}
+
+		container = target;
+		target.appendChild(createFrame(token));
+	}
+
+	window.addEventListener("message", function (event) {
+		if (event.origin !== baseOrigin || !event.data || typeof event.data.type !== "string") {
+			return;
+		}
+
+		switch (event.data.type) {
+			case "mocktrans:snap:close":
+				hide();
+				call("onClose");
+				break;
+			case "mocktrans:snap:result":
+				var result = event.data.result;
+				hide();
+
+				if (result.transaction_status === "settlement" || (result.transaction_status === "capture" && result.fraud_status === "accept")) {
+					call("onSuccess", result);
+				} else if (result.transaction_status === "pending" || result.fraud_status === "challenge") {
+					call("onPending", result);
+				} else {
+					call("onError", result);
+				}
+				break;
+		}
+	});
+
+	window.snap = {
+		pay: pay,
+		embed: embed,
+		hide: hide,
+		show: function () {}
+	};
+})();
+`
+
+// snapResult is the result object that snap.js passes to the onSuccess,
+// onPending and onError callbacks.
+type snapResult struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	TransactionId     string `json:"transaction_id"`
+	OrderId           string `json:"order_id"`
+	GrossAmount       string `json:"gross_amount"`
+	PaymentType       string `json:"payment_type"`
+	TransactionTime   string `json:"transaction_time"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	FinishRedirectUrl string `json:"finish_redirect_url,omitempty"`
+}
+
+func (d *Dependencies) snapResult(ctx context.Context, transaction Transaction) (snapResult, error) {
+	statusMessage := "Success, transaction is found"
+	switch transaction.TransactionStatus {
+	case TransactionStatusDeny:
+		statusMessage = "Transaction is denied"
+	case TransactionStatusExpire:
+		statusMessage = "Transaction is expired"
+	case TransactionStatusCancel:
+		statusMessage = "Transaction is canceled"
+	}
+
+	result := snapResult{
+		StatusCode:        transaction.StatusCode(),
+		StatusMessage:     statusMessage,
+		TransactionId:     transaction.Id,
+		OrderId:           transaction.OrderId,
+		GrossAmount:       transaction.FormattedGrossAmount(),
+		PaymentType:       transaction.PaymentType,
+		TransactionTime:   transaction.TransactionTime(),
+		TransactionStatus: string(transaction.TransactionStatus),
+		FraudStatus:       string(transaction.FraudStatus),
+	}
+
+	snapTransaction, err := d.Storage.getSnapTransaction(ctx, transaction.Id)
+	if err != nil && !errors.Is(err, ErrSnapTransactionNotFound) {
+		return snapResult{}, err
+	}
+	if err == nil {
+		result.FinishRedirectUrl = snapRedirectUrl(d.snapFinishUrl(snapTransaction), transaction.OrderId, result.StatusCode, transaction.TransactionStatus)
+	}
+
+	return result, nil
+}
+
+// SnapJs serves the snap.js client script, for frontends that are tested against Mocktrans.
+func (d *Dependencies) SnapJs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(snapJs))
+}
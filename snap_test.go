@@ -0,0 +1,93 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSnapEnabledPayments(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// messages are the validation errors of the request.
+		messages []string
+		// charges are the payment_type, bank and store that every enabled payment is charged with.
+		charges []string
+	}{
+		{
+			name:    "virtual account and e-wallet",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "enabled_payments": ["bca_va", "gopay"], "bca_va": {"va_number": "12345678"}}`,
+			charges: []string{"bank_transfer bca ", "gopay  "},
+		},
+		{
+			name:    "convenience store",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "enabled_payments": ["indomaret"]}`,
+			charges: []string{"cstore  indomaret"},
+		},
+		{
+			name:    "other banks pay into a permata virtual account",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "enabled_payments": ["other_va", "echannel"]}`,
+			charges: []string{"bank_transfer permata ", "echannel  "},
+		},
+		{
+			name:     "core api payment types are not snap payments",
+			body:     `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "enabled_payments": ["bank_transfer", "cstore"]}`,
+			messages: []string{"enabled_payments contains unknown payment type of bank_transfer", "enabled_payments contains unknown payment type of cstore"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req snapRequest
+			err := json.Unmarshal([]byte(test.body), &req)
+			if err != nil {
+				t.Fatalf("failed to decode request: %v", err)
+			}
+
+			messages := req.Validate()
+			if strings.Join(messages, "; ") != strings.Join(test.messages, "; ") {
+				t.Fatalf("expected validation errors %v, got %v", test.messages, messages)
+			}
+			if len(messages) > 0 {
+				return
+			}
+
+			var charges []string
+			for _, enabledPayment := range req.EnabledPayments {
+				payment, _ := findSnapPayment(enabledPayment)
+				charge := req.chargeRequest(payment)
+				fillSnapChargeDefaults(&charge, "https://merchant.example/callback")
+
+				if errorStatus, validationMessages := charge.Validate(); errorStatus != 0 {
+					t.Errorf("expected the %s charge to be valid, got %v", enabledPayment, validationMessages)
+				}
+
+				charges = append(charges, charge.PaymentType+" "+charge.BankTransfer.Bank+" "+charge.Cstore.Store)
+			}
+			if strings.Join(charges, ", ") != strings.Join(test.charges, ", ") {
+				t.Errorf("expected charges %q, got %q", test.charges, charges)
+			}
+		})
+	}
+}
+
+func TestSnapEnabledPaymentsDefault(t *testing.T) {
+	for _, name := range snapPaymentNames() {
+		payment, ok := findSnapPayment(name)
+		if !ok {
+			t.Fatalf("expected %s to be a snap payment", name)
+		}
+
+		var known = false
+		for _, paymentType := range paymentTypes {
+			if payment.PaymentType == paymentType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			t.Errorf("expected %s to be charged with a known payment_type, got %s", name, payment.PaymentType)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// databaseSnapshot is the snapshot of a sqlStorage. It holds the rows of every table,
+// as the driver returned them, so that they can be inserted back without knowing their types.
+type databaseSnapshot map[string]tableSnapshot
+
+type tableSnapshot struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// SnapshotStore keeps named snapshots of the storage in memory. They are
+// lost when Mocktrans restarts, which is fine for fixtures of a test suite.
+// A snapshot is only understood by the kind of storage that took it.
+type SnapshotStore struct {
+	mu        sync.Mutex
+	snapshots map[string]any
+}
+
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{snapshots: make(map[string]any)}
+}
+
+func (s *SnapshotStore) get(name string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[name]
+	return snapshot, ok
+}
+
+func (s *SnapshotStore) put(name string, snapshot any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots[name] = snapshot
+}
+
+func (s *SnapshotStore) delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.snapshots[name]
+	delete(s.snapshots, name)
+	return ok
+}
+
+func (s *SnapshotStore) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for name := range s.snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TakeSnapshot saves all data under the name, replacing the snapshot that had the same name.
+func (d *Dependencies) TakeSnapshot(ctx context.Context, name string) error {
+	snapshot, err := d.Storage.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.Snapshots.put(name, snapshot)
+	return nil
+}
+
+// RestoreSnapshot replaces all data with the data of the named snapshot.
+func (d *Dependencies) RestoreSnapshot(ctx context.Context, name string) error {
+	snapshot, ok := d.Snapshots.get(name)
+	if !ok {
+		return ErrSnapshotNotFound
+	}
+
+	err := d.Storage.restore(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+
+	// What was scheduled for the transactions before the restore no longer applies to them
+	d.clearScenarioTransitions()
+	d.dropHeldNotifications()
+	return nil
+}
+
+// snapshot reads the rows of every table within one transaction.
+func (s *sqlStorage) snapshot(ctx context.Context) (any, error) {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	snapshot := make(databaseSnapshot)
+	for _, table := range dataTables {
+		tableSnapshot, err := snapshotTable(ctx, tx, table)
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return nil, fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+			return nil, err
+		}
+
+		snapshot[table] = tableSnapshot
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return nil, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// restore replaces the rows of every table within one transaction, so that a failed
+// restore leaves the database as it was.
+func (s *sqlStorage) restore(ctx context.Context, snapshot any) error {
+	tables, ok := snapshot.(databaseSnapshot)
+	if !ok {
+		return fmt.Errorf("snapshot was not taken by a database storage")
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	for _, table := range dataTables {
+		err := s.restoreTable(ctx, tx, table, tables[table])
+		if err != nil {
+			if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+				return fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+func snapshotTable(ctx context.Context, tx *sql.Tx, table string) (tableSnapshot, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT * FROM `+table)
+	if err != nil {
+		return tableSnapshot{}, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return tableSnapshot{}, fmt.Errorf("failed to get columns of %s: %w", table, err)
+	}
+
+	snapshot := tableSnapshot{Columns: columns}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		err := rows.Scan(pointers...)
+		if err != nil {
+			return tableSnapshot{}, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+
+		snapshot.Rows = append(snapshot.Rows, values)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return tableSnapshot{}, fmt.Errorf("failed to iterate %s: %w", table, err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return tableSnapshot{}, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func (s *sqlStorage) restoreTable(ctx context.Context, tx *sql.Tx, table string, snapshot tableSnapshot) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM `+table)
+	if err != nil {
+		return fmt.Errorf("failed to delete from %s: %w", table, err)
+	}
+
+	if len(snapshot.Rows) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(snapshot.Columns))
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO ` + table + ` (` + strings.Join(snapshot.Columns, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	for _, row := range snapshot.Rows {
+		_, err := tx.ExecContext(ctx, formattedQuery, row...)
+		if err != nil {
+			return fmt.Errorf("failed to insert into %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Status returns the current state of the transaction. Midtrans answers with
+// the same fields as the notification, signature_key included.
+func (d *Dependencies) Status(w http.ResponseWriter, r *http.Request) {
+	transaction, err := d.Storage.getMerchantTransaction(r.Context(), merchantFromContext(r.Context()).MerchantId, chi.URLParam(r, "orderId"))
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			writeErrorResponse(w, ErrorNotFound)
+			return
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := d.transactionNotification(r.Context(), transaction)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	response.StatusMessage = "Success, transaction is found"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,106 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Storage keeps everything that Mocktrans creates through the API. Merchants are
+// configuration and are not part of it.
+//
+// There are two implementations: sqlStorage for the database of DATABASE_URL, and
+// memoryStorage for DATABASE_PROVIDER=memory, which needs no file and no cgo.
+// Both return the same errors, such as ErrTransactionNotFound, for missing records.
+type Storage interface {
+	// migrate creates the tables, and upgrades the ones that an older Mocktrans created.
+	// Their records that predate merchants are given to the default merchant.
+	migrate(ctx context.Context, defaultMerchantId string) error
+	ping(ctx context.Context) error
+	// reset deletes all data, as if the storage was just migrated.
+	reset(ctx context.Context) error
+	isEmpty(ctx context.Context) (bool, error)
+	// snapshot returns a copy of all data, only to be given back to restore
+	// of the same kind of storage.
+	snapshot(ctx context.Context) (any, error)
+	restore(ctx context.Context, snapshot any) error
+
+	// insertTransaction inserts the transaction along with its virtual accounts, all or nothing.
+	insertTransaction(ctx context.Context, transaction Transaction, virtualAccounts ...VirtualAccount) error
+	getTransaction(ctx context.Context, id string) (Transaction, error)
+	getMerchantTransaction(ctx context.Context, merchantId string, id string) (Transaction, error)
+	listTransactionsBy(ctx context.Context, column string, value string) ([]Transaction, error)
+	listTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
+	updateTransactionStatus(ctx context.Context, transactionId string, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error
+	updateTransactionStatusFrom(ctx context.Context, transactionId string, expectedStatus TransactionStatus, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error
+	listTransactionStatusHistory(ctx context.Context, transactionId string) ([]TransactionStatusChange, error)
+
+	insertVirtualAccount(ctx context.Context, virtualAccount VirtualAccount) error
+	listVirtualAccounts(ctx context.Context, transactionId string) ([]VirtualAccount, error)
+
+	insertWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error
+	listWebhookAttempts(ctx context.Context, transactionId string) ([]WebhookAttempt, error)
+
+	insertSnapTransaction(ctx context.Context, snapTransaction SnapTransaction) error
+	getSnapTransaction(ctx context.Context, id string) (SnapTransaction, error)
+	updateSnapTransactionId(ctx context.Context, token string, transactionId string) error
+
+	insertPaymentLink(ctx context.Context, paymentLink PaymentLink) error
+	getPaymentLink(ctx context.Context, id string) (PaymentLink, error)
+	deletePaymentLink(ctx context.Context, paymentLinkId string) error
+
+	insertSubscription(ctx context.Context, subscription Subscription) error
+	getSubscription(ctx context.Context, subscriptionId string) (Subscription, error)
+	listDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error)
+	updateSubscription(ctx context.Context, subscription Subscription) error
+
+	insertGopayAccount(ctx context.Context, account GopayAccount) error
+	getGopayAccount(ctx context.Context, accountId string) (GopayAccount, error)
+	updateGopayAccountStatus(ctx context.Context, accountId string, status GopayAccountStatus, now time.Time) error
+
+	getSavedCard(ctx context.Context, merchantId string, savedTokenId string) (SavedCard, error)
+
+	// insertSeed inserts every record of the seed, all or nothing.
+	insertSeed(ctx context.Context, records seedRecords) error
+
+	getIdempotentResponse(ctx context.Context, merchantId string, key string) (IdempotentResponse, error)
+	insertIdempotentResponse(ctx context.Context, response IdempotentResponse) error
+
+	insertIrisBeneficiary(ctx context.Context, beneficiary IrisBeneficiary) error
+	getIrisBeneficiary(ctx context.Context, aliasName string) (IrisBeneficiary, error)
+	listIrisBeneficiaries(ctx context.Context) ([]IrisBeneficiary, error)
+	updateIrisBeneficiary(ctx context.Context, aliasName string, beneficiary IrisBeneficiary) error
+	insertIrisPayouts(ctx context.Context, payouts []IrisPayout) error
+	getIrisPayout(ctx context.Context, referenceNo string) (IrisPayout, error)
+	updateIrisPayout(ctx context.Context, payout IrisPayout) error
+	// approveIrisPayouts updates the queued payouts if the balance covers them, all or nothing.
+	approveIrisPayouts(ctx context.Context, initialBalance int64, payouts []IrisPayout) error
+	sumIrisPayouts(ctx context.Context, statuses ...IrisPayoutStatus) (int64, error)
+}
+
+// sqlStorage keeps the data in sqlite, postgres or mysql.
+type sqlStorage struct {
+	DB               *sql.DB
+	DatabaseProvider string
+}
+
+// NewSQLStorage returns a storage that keeps the data in the database, which was opened
+// with the driver named databaseProvider. The database must be migrated with MigrateSchema.
+func NewSQLStorage(db *sql.DB, databaseProvider string) Storage {
+	return &sqlStorage{DB: db, DatabaseProvider: databaseProvider}
+}
+
+// MigrateSchema creates the tables that the storage needs, if they do not exist yet,
+// and adds what an older Mocktrans did not have to the ones that do.
+func (d *Dependencies) MigrateSchema(ctx context.Context) error {
+	return d.Storage.migrate(ctx, d.Merchants[0].MerchantId)
+}
+
+// StorageIsEmpty tells whether nothing was stored yet.
+func (d *Dependencies) StorageIsEmpty(ctx context.Context) (bool, error) {
+	return d.Storage.isEmpty(ctx)
+}
+
+func (s *sqlStorage) ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
@@ -0,0 +1,1019 @@
+package mocktrans
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStorage keeps the data in memory, for DATABASE_PROVIDER=memory. Records are copied
+// on the way in and on the way out, so that callers can not change what is stored by accident,
+// just like they can not with a database.
+type memoryStorage struct {
+	mu   sync.Mutex
+	data memoryData
+}
+
+// memoryData has one slice per table, in the order the records were inserted.
+// Stored records are never changed in place, an update replaces the whole record,
+// which makes a copy of the slices a snapshot.
+type memoryData struct {
+	transactions        []Transaction
+	statusHistory       []TransactionStatusChange
+	virtualAccounts     []VirtualAccount
+	webhookAttempts     []WebhookAttempt
+	snapTransactions    []SnapTransaction
+	paymentLinks        []PaymentLink
+	subscriptions       []Subscription
+	gopayAccounts       []GopayAccount
+	savedCards          []SavedCard
+	idempotentResponses []IdempotentResponse
+	irisBeneficiaries   []IrisBeneficiary
+	irisPayouts         []IrisPayout
+}
+
+// NewMemoryStorage returns an empty storage that keeps everything in memory.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{}
+}
+
+func (data memoryData) copy() memoryData {
+	return memoryData{
+		transactions:        append([]Transaction(nil), data.transactions...),
+		statusHistory:       append([]TransactionStatusChange(nil), data.statusHistory...),
+		virtualAccounts:     append([]VirtualAccount(nil), data.virtualAccounts...),
+		webhookAttempts:     append([]WebhookAttempt(nil), data.webhookAttempts...),
+		snapTransactions:    append([]SnapTransaction(nil), data.snapTransactions...),
+		paymentLinks:        append([]PaymentLink(nil), data.paymentLinks...),
+		subscriptions:       append([]Subscription(nil), data.subscriptions...),
+		gopayAccounts:       append([]GopayAccount(nil), data.gopayAccounts...),
+		savedCards:          append([]SavedCard(nil), data.savedCards...),
+		idempotentResponses: append([]IdempotentResponse(nil), data.idempotentResponses...),
+		irisBeneficiaries:   append([]IrisBeneficiary(nil), data.irisBeneficiaries...),
+		irisPayouts:         append([]IrisPayout(nil), data.irisPayouts...),
+	}
+}
+
+// cloneJSON copies the value into the clone by encoding it, the same way
+// a database storage keeps the requests and the metadata.
+func cloneJSON(value any, clone any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	err = json.Unmarshal(encoded, clone)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal: %w", err)
+	}
+
+	return nil
+}
+
+func cloneTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+
+	clone := *value
+	return &clone
+}
+
+func cloneTransaction(transaction Transaction) (Transaction, error) {
+	var metadata map[string]interface{}
+	err := cloneJSON(transaction.Metadata, &metadata)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to copy metadata: %w", err)
+	}
+
+	transaction.Metadata = metadata
+	return transaction, nil
+}
+
+func cloneSnapTransaction(snapTransaction SnapTransaction) (SnapTransaction, error) {
+	var request snapRequest
+	err := cloneJSON(snapTransaction.Request, &request)
+	if err != nil {
+		return SnapTransaction{}, fmt.Errorf("failed to copy snap request: %w", err)
+	}
+
+	snapTransaction.Request = request
+	return snapTransaction, nil
+}
+
+func clonePaymentLink(paymentLink PaymentLink) (PaymentLink, error) {
+	var request paymentLinkRequest
+	err := cloneJSON(paymentLink.Request, &request)
+	if err != nil {
+		return PaymentLink{}, fmt.Errorf("failed to copy payment link request: %w", err)
+	}
+
+	paymentLink.Request = request
+	paymentLink.ExpiredAt = cloneTime(paymentLink.ExpiredAt)
+	return paymentLink, nil
+}
+
+func cloneSubscription(subscription Subscription) (Subscription, error) {
+	var request subscriptionRequest
+	err := cloneJSON(subscription.Request, &request)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to copy subscription request: %w", err)
+	}
+
+	subscription.Request = request
+	subscription.NextExecutionAt = cloneTime(subscription.NextExecutionAt)
+	return subscription, nil
+}
+
+func (m *memoryStorage) migrate(ctx context.Context, defaultMerchantId string) error {
+	return nil
+}
+
+func (m *memoryStorage) ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryStorage) reset(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = memoryData{}
+	return nil
+}
+
+func (m *memoryStorage) isEmpty(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data := m.data
+	empty := len(data.transactions) == 0 &&
+		len(data.statusHistory) == 0 &&
+		len(data.virtualAccounts) == 0 &&
+		len(data.webhookAttempts) == 0 &&
+		len(data.snapTransactions) == 0 &&
+		len(data.paymentLinks) == 0 &&
+		len(data.subscriptions) == 0 &&
+		len(data.gopayAccounts) == 0 &&
+		len(data.savedCards) == 0 &&
+		len(data.idempotentResponses) == 0 &&
+		len(data.irisBeneficiaries) == 0 &&
+		len(data.irisPayouts) == 0
+	return empty, nil
+}
+
+func (m *memoryStorage) snapshot(ctx context.Context) (any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.data.copy(), nil
+}
+
+func (m *memoryStorage) restore(ctx context.Context, snapshot any) error {
+	data, ok := snapshot.(memoryData)
+	if !ok {
+		return fmt.Errorf("snapshot was not taken by a memory storage")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = data.copy()
+	return nil
+}
+
+func (m *memoryStorage) insertTransaction(ctx context.Context, transaction Transaction, virtualAccounts ...VirtualAccount) error {
+	transaction, err := cloneTransaction(transaction)
+	if err != nil {
+		return err
+	}
+
+	// Stored in UTC, like the database storage does
+	transaction.CreatedAt = transaction.CreatedAt.UTC()
+	transaction.UpdatedAt = transaction.UpdatedAt.UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.transactions {
+		if existing.Id == transaction.Id {
+			return fmt.Errorf("failed to insert transaction: transaction %s already exists", transaction.Id)
+		}
+	}
+
+	for _, virtualAccount := range virtualAccounts {
+		for _, existing := range m.data.virtualAccounts {
+			if existing.Id == virtualAccount.Id {
+				return fmt.Errorf("failed to insert virtual account: virtual account %s already exists", virtualAccount.Id)
+			}
+		}
+	}
+
+	m.data.transactions = append(m.data.transactions, transaction)
+	m.data.virtualAccounts = append(m.data.virtualAccounts, virtualAccounts...)
+	m.data.statusHistory = append(m.data.statusHistory, TransactionStatusChange{
+		TransactionId:     transaction.Id,
+		TransactionStatus: transaction.TransactionStatus,
+		FraudStatus:       transaction.FraudStatus,
+		CreatedAt:         transaction.CreatedAt,
+	})
+	return nil
+}
+
+// getTransaction finds the newest transaction whose transaction ID or order ID is the id.
+func (m *memoryStorage) getTransaction(ctx context.Context, id string) (Transaction, error) {
+	return m.findTransaction(func(transaction Transaction) bool {
+		return transaction.Id == id || transaction.OrderId == id
+	})
+}
+
+func (m *memoryStorage) getMerchantTransaction(ctx context.Context, merchantId string, id string) (Transaction, error) {
+	return m.findTransaction(func(transaction Transaction) bool {
+		return (transaction.Id == id || transaction.OrderId == id) && transaction.MerchantId == merchantId
+	})
+}
+
+func (m *memoryStorage) findTransaction(match func(Transaction) bool) (Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	var newest Transaction
+	for _, transaction := range m.data.transactions {
+		if match(transaction) && (!found || !transaction.CreatedAt.Before(newest.CreatedAt)) {
+			newest = transaction
+			found = true
+		}
+	}
+
+	if !found {
+		return Transaction{}, ErrTransactionNotFound
+	}
+
+	return cloneTransaction(newest)
+}
+
+func (m *memoryStorage) listTransactionsBy(ctx context.Context, column string, value string) ([]Transaction, error) {
+	var field func(Transaction) string
+	switch column {
+	case "order_id":
+		field = func(transaction Transaction) string { return transaction.OrderId }
+	case "payment_link_id":
+		field = func(transaction Transaction) string { return transaction.PaymentLinkId }
+	case "subscription_id":
+		field = func(transaction Transaction) string { return transaction.SubscriptionId }
+	default:
+		return nil, fmt.Errorf("unknown transaction column: %s", column)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var transactions []Transaction
+	for _, transaction := range m.data.transactions {
+		if field(transaction) != value {
+			continue
+		}
+
+		transaction, err := cloneTransaction(transaction)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+	})
+
+	return transactions, nil
+}
+
+func (m *memoryStorage) listTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var transactions []Transaction
+	for i := len(m.data.transactions) - 1; i >= 0; i-- {
+		transaction := m.data.transactions[i]
+		if filter.MerchantId != "" && transaction.MerchantId != filter.MerchantId {
+			continue
+		}
+		if filter.TransactionStatus != "" && transaction.TransactionStatus != filter.TransactionStatus {
+			continue
+		}
+		if filter.PaymentType != "" && transaction.PaymentType != filter.PaymentType {
+			continue
+		}
+		if filter.OrderId != "" && !strings.Contains(transaction.OrderId, filter.OrderId) {
+			continue
+		}
+		if !filter.CreatedFrom.IsZero() && transaction.CreatedAt.Before(filter.CreatedFrom) {
+			continue
+		}
+		if !filter.CreatedUntil.IsZero() && !transaction.CreatedAt.Before(filter.CreatedUntil) {
+			continue
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].CreatedAt.After(transactions[j].CreatedAt)
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+
+	for i, transaction := range transactions {
+		transaction, err := cloneTransaction(transaction)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions[i] = transaction
+	}
+
+	return transactions, nil
+}
+
+func (m *memoryStorage) updateTransactionStatus(ctx context.Context, transactionId string, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, transaction := range m.data.transactions {
+		if transaction.Id != transactionId {
+			continue
+		}
+
+		transaction.TransactionStatus = transactionStatus
+		transaction.FraudStatus = fraudStatus
+		transaction.UpdatedAt = now.UTC()
+		m.data.transactions[i] = transaction
+
+		m.data.statusHistory = append(m.data.statusHistory, TransactionStatusChange{
+			TransactionId:     transactionId,
+			TransactionStatus: transactionStatus,
+			FraudStatus:       fraudStatus,
+			CreatedAt:         now.UTC(),
+		})
+		return nil
+	}
+
+	return ErrTransactionNotFound
+}
+
+func (m *memoryStorage) updateTransactionStatusFrom(ctx context.Context, transactionId string, expectedStatus TransactionStatus, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, transaction := range m.data.transactions {
+		if transaction.Id != transactionId {
+			continue
+		}
+
+		if transaction.TransactionStatus != expectedStatus {
+			return ErrTransactionStatusChanged
+		}
+
+		transaction.TransactionStatus = transactionStatus
+		transaction.FraudStatus = fraudStatus
+		transaction.UpdatedAt = now.UTC()
+		m.data.transactions[i] = transaction
+
+		m.data.statusHistory = append(m.data.statusHistory, TransactionStatusChange{
+			TransactionId:     transactionId,
+			TransactionStatus: transactionStatus,
+			FraudStatus:       fraudStatus,
+			CreatedAt:         now.UTC(),
+		})
+		return nil
+	}
+
+	return ErrTransactionStatusChanged
+}
+
+func (m *memoryStorage) listTransactionStatusHistory(ctx context.Context, transactionId string) ([]TransactionStatusChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var history []TransactionStatusChange
+	for _, change := range m.data.statusHistory {
+		if change.TransactionId == transactionId {
+			history = append(history, change)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].CreatedAt.Before(history[j].CreatedAt)
+	})
+
+	return history, nil
+}
+
+func (m *memoryStorage) insertVirtualAccount(ctx context.Context, virtualAccount VirtualAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.virtualAccounts {
+		if existing.Id == virtualAccount.Id {
+			return fmt.Errorf("failed to insert virtual account: virtual account %s already exists", virtualAccount.Id)
+		}
+	}
+
+	m.data.virtualAccounts = append(m.data.virtualAccounts, virtualAccount)
+	return nil
+}
+
+func (m *memoryStorage) listVirtualAccounts(ctx context.Context, transactionId string) ([]VirtualAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var virtualAccounts []VirtualAccount
+	for _, virtualAccount := range m.data.virtualAccounts {
+		if virtualAccount.TransactionId == transactionId {
+			virtualAccounts = append(virtualAccounts, virtualAccount)
+		}
+	}
+
+	sort.SliceStable(virtualAccounts, func(i, j int) bool {
+		return virtualAccounts[i].CreatedAt.Before(virtualAccounts[j].CreatedAt)
+	})
+
+	return virtualAccounts, nil
+}
+
+func (m *memoryStorage) insertWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data.webhookAttempts = append(m.data.webhookAttempts, attempt)
+	return nil
+}
+
+func (m *memoryStorage) listWebhookAttempts(ctx context.Context, transactionId string) ([]WebhookAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var attempts []WebhookAttempt
+	for _, attempt := range m.data.webhookAttempts {
+		if transactionId == "" || attempt.TransactionId == transactionId {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return attempts[i].CreatedAt.Before(attempts[j].CreatedAt)
+	})
+
+	return attempts, nil
+}
+
+func (m *memoryStorage) insertSnapTransaction(ctx context.Context, snapTransaction SnapTransaction) error {
+	snapTransaction, err := cloneSnapTransaction(snapTransaction)
+	if err != nil {
+		return err
+	}
+
+	// The transaction ID is only set by updateSnapTransactionId
+	snapTransaction.TransactionId = ""
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.snapTransactions {
+		if existing.Token == snapTransaction.Token {
+			return fmt.Errorf("failed to insert snap transaction: token %s already exists", snapTransaction.Token)
+		}
+	}
+
+	m.data.snapTransactions = append(m.data.snapTransactions, snapTransaction)
+	return nil
+}
+
+// getSnapTransaction finds a snap transaction by either its token or the ID of its transaction.
+func (m *memoryStorage) getSnapTransaction(ctx context.Context, id string) (SnapTransaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, snapTransaction := range m.data.snapTransactions {
+		if snapTransaction.Token == id || (snapTransaction.TransactionId != "" && snapTransaction.TransactionId == id) {
+			return cloneSnapTransaction(snapTransaction)
+		}
+	}
+
+	return SnapTransaction{}, ErrSnapTransactionNotFound
+}
+
+func (m *memoryStorage) updateSnapTransactionId(ctx context.Context, token string, transactionId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, snapTransaction := range m.data.snapTransactions {
+		if snapTransaction.Token == token {
+			snapTransaction.TransactionId = transactionId
+			m.data.snapTransactions[i] = snapTransaction
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) insertPaymentLink(ctx context.Context, paymentLink PaymentLink) error {
+	paymentLink, err := clonePaymentLink(paymentLink)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.paymentLinks {
+		if existing.Id == paymentLink.Id {
+			return fmt.Errorf("failed to insert payment link: payment link %s already exists", paymentLink.Id)
+		}
+	}
+
+	m.data.paymentLinks = append(m.data.paymentLinks, paymentLink)
+	return nil
+}
+
+// getPaymentLink finds a payment link by either its ID or its order ID.
+func (m *memoryStorage) getPaymentLink(ctx context.Context, id string) (PaymentLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, paymentLink := range m.data.paymentLinks {
+		if paymentLink.Id == id || paymentLink.OrderId == id {
+			return clonePaymentLink(paymentLink)
+		}
+	}
+
+	return PaymentLink{}, ErrPaymentLinkNotFound
+}
+
+func (m *memoryStorage) deletePaymentLink(ctx context.Context, paymentLinkId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var paymentLinks []PaymentLink
+	for _, paymentLink := range m.data.paymentLinks {
+		if paymentLink.Id != paymentLinkId {
+			paymentLinks = append(paymentLinks, paymentLink)
+		}
+	}
+
+	m.data.paymentLinks = paymentLinks
+	return nil
+}
+
+func (m *memoryStorage) insertSubscription(ctx context.Context, subscription Subscription) error {
+	subscription, err := cloneSubscription(subscription)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.subscriptions {
+		if existing.Id == subscription.Id {
+			return fmt.Errorf("failed to insert subscription: subscription %s already exists", subscription.Id)
+		}
+	}
+
+	m.data.subscriptions = append(m.data.subscriptions, subscription)
+	return nil
+}
+
+func (m *memoryStorage) getSubscription(ctx context.Context, subscriptionId string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, subscription := range m.data.subscriptions {
+		if subscription.Id == subscriptionId {
+			return cloneSubscription(subscription)
+		}
+	}
+
+	return Subscription{}, ErrSubscriptionNotFound
+}
+
+// listDueSubscriptions lists the active subscriptions that should have been charged by now,
+// the one that is due the longest first.
+func (m *memoryStorage) listDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var subscriptions []Subscription
+	for _, subscription := range m.data.subscriptions {
+		if subscription.Status != SubscriptionStatusActive || subscription.NextExecutionAt == nil || subscription.NextExecutionAt.After(now) {
+			continue
+		}
+
+		subscription, err := cloneSubscription(subscription)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].NextExecutionAt.Before(*subscriptions[j].NextExecutionAt)
+	})
+
+	return subscriptions, nil
+}
+
+func (m *memoryStorage) updateSubscription(ctx context.Context, subscription Subscription) error {
+	updated, err := cloneSubscription(subscription)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.data.subscriptions {
+		if existing.Id != updated.Id {
+			continue
+		}
+
+		existing.Status = updated.Status
+		existing.Request = updated.Request
+		existing.CurrentInterval = updated.CurrentInterval
+		existing.CurrentRetry = updated.CurrentRetry
+		existing.NextExecutionAt = updated.NextExecutionAt
+		existing.UpdatedAt = updated.UpdatedAt
+		m.data.subscriptions[i] = existing
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) insertGopayAccount(ctx context.Context, account GopayAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.gopayAccounts {
+		if existing.Id == account.Id {
+			return fmt.Errorf("failed to insert gopay account: account %s already exists", account.Id)
+		}
+	}
+
+	m.data.gopayAccounts = append(m.data.gopayAccounts, account)
+	return nil
+}
+
+func (m *memoryStorage) getGopayAccount(ctx context.Context, accountId string) (GopayAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, account := range m.data.gopayAccounts {
+		if account.Id == accountId {
+			return account, nil
+		}
+	}
+
+	return GopayAccount{}, ErrGopayAccountNotFound
+}
+
+func (m *memoryStorage) updateGopayAccountStatus(ctx context.Context, accountId string, status GopayAccountStatus, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, account := range m.data.gopayAccounts {
+		if account.Id == accountId {
+			account.Status = status
+			account.UpdatedAt = now
+			m.data.gopayAccounts[i] = account
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) getSavedCard(ctx context.Context, merchantId string, savedTokenId string) (SavedCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, savedCard := range m.data.savedCards {
+		if savedCard.MerchantId == merchantId && savedCard.SavedTokenId == savedTokenId {
+			return savedCard, nil
+		}
+	}
+
+	return SavedCard{}, ErrSavedCardNotFound
+}
+
+// insertSeed adds the records to a copy of the data, which only replaces the data once
+// every record went in, just like a database transaction that commits.
+func (m *memoryStorage) insertSeed(ctx context.Context, records seedRecords) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data := m.data.copy()
+
+	for _, transaction := range records.transactions {
+		transaction, err := cloneTransaction(transaction)
+		if err != nil {
+			return err
+		}
+
+		// Stored in UTC, like the database storage does
+		transaction.CreatedAt = transaction.CreatedAt.UTC()
+		transaction.UpdatedAt = transaction.UpdatedAt.UTC()
+
+		for _, existing := range data.transactions {
+			if existing.Id == transaction.Id {
+				return fmt.Errorf("failed to insert transaction: transaction %s already exists", transaction.Id)
+			}
+		}
+
+		data.transactions = append(data.transactions, transaction)
+		data.statusHistory = append(data.statusHistory, TransactionStatusChange{
+			TransactionId:     transaction.Id,
+			TransactionStatus: transaction.TransactionStatus,
+			FraudStatus:       transaction.FraudStatus,
+			CreatedAt:         transaction.CreatedAt,
+		})
+	}
+
+	for _, virtualAccount := range records.virtualAccounts {
+		for _, existing := range data.virtualAccounts {
+			if existing.Id == virtualAccount.Id {
+				return fmt.Errorf("failed to insert virtual account: virtual account %s already exists", virtualAccount.Id)
+			}
+		}
+
+		data.virtualAccounts = append(data.virtualAccounts, virtualAccount)
+	}
+
+	for _, subscription := range records.subscriptions {
+		subscription, err := cloneSubscription(subscription)
+		if err != nil {
+			return err
+		}
+
+		for _, existing := range data.subscriptions {
+			if existing.Id == subscription.Id {
+				return fmt.Errorf("failed to insert subscription: subscription %s already exists", subscription.Id)
+			}
+		}
+
+		data.subscriptions = append(data.subscriptions, subscription)
+	}
+
+	for _, account := range records.gopayAccounts {
+		for _, existing := range data.gopayAccounts {
+			if existing.Id == account.Id {
+				return fmt.Errorf("failed to insert gopay account: account %s already exists", account.Id)
+			}
+		}
+
+		data.gopayAccounts = append(data.gopayAccounts, account)
+	}
+
+	for _, savedCard := range records.savedCards {
+		for _, existing := range data.savedCards {
+			if existing.SavedTokenId == savedCard.SavedTokenId {
+				return fmt.Errorf("failed to insert saved card: saved card %s already exists", savedCard.SavedTokenId)
+			}
+		}
+
+		data.savedCards = append(data.savedCards, savedCard)
+	}
+
+	m.data = data
+	return nil
+}
+
+func (m *memoryStorage) getIdempotentResponse(ctx context.Context, merchantId string, key string) (IdempotentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, response := range m.data.idempotentResponses {
+		if response.MerchantId == merchantId && response.Key == key {
+			response.Body = append([]byte(nil), response.Body...)
+			return response, nil
+		}
+	}
+
+	return IdempotentResponse{}, ErrIdempotentResponseNotFound
+}
+
+func (m *memoryStorage) insertIdempotentResponse(ctx context.Context, response IdempotentResponse) error {
+	response.Body = append([]byte(nil), response.Body...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.idempotentResponses {
+		if existing.MerchantId == response.MerchantId && existing.Key == response.Key {
+			return fmt.Errorf("failed to insert idempotent response: key %s already exists", response.Key)
+		}
+	}
+
+	m.data.idempotentResponses = append(m.data.idempotentResponses, response)
+	return nil
+}
+
+func (m *memoryStorage) insertIrisBeneficiary(ctx context.Context, beneficiary IrisBeneficiary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.data.irisBeneficiaries {
+		if existing.AliasName == beneficiary.AliasName {
+			return fmt.Errorf("failed to insert iris beneficiary: alias name %s already exists", beneficiary.AliasName)
+		}
+	}
+
+	m.data.irisBeneficiaries = append(m.data.irisBeneficiaries, beneficiary)
+	return nil
+}
+
+func (m *memoryStorage) getIrisBeneficiary(ctx context.Context, aliasName string) (IrisBeneficiary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, beneficiary := range m.data.irisBeneficiaries {
+		if beneficiary.AliasName == aliasName {
+			return beneficiary, nil
+		}
+	}
+
+	return IrisBeneficiary{}, ErrIrisBeneficiaryNotFound
+}
+
+func (m *memoryStorage) listIrisBeneficiaries(ctx context.Context) ([]IrisBeneficiary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	beneficiaries := append([]IrisBeneficiary(nil), m.data.irisBeneficiaries...)
+	sort.SliceStable(beneficiaries, func(i, j int) bool {
+		return beneficiaries[i].CreatedAt.Before(beneficiaries[j].CreatedAt)
+	})
+
+	return beneficiaries, nil
+}
+
+// updateIrisBeneficiary replaces the beneficiary that had the alias name, which may be changed as well.
+func (m *memoryStorage) updateIrisBeneficiary(ctx context.Context, aliasName string, beneficiary IrisBeneficiary) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if beneficiary.AliasName != aliasName {
+		for _, existing := range m.data.irisBeneficiaries {
+			if existing.AliasName == beneficiary.AliasName {
+				return fmt.Errorf("failed to update iris beneficiary: alias name %s already exists", beneficiary.AliasName)
+			}
+		}
+	}
+
+	for i, existing := range m.data.irisBeneficiaries {
+		if existing.AliasName != aliasName {
+			continue
+		}
+
+		existing.Name = beneficiary.Name
+		existing.Account = beneficiary.Account
+		existing.Bank = beneficiary.Bank
+		existing.AliasName = beneficiary.AliasName
+		existing.Email = beneficiary.Email
+		existing.UpdatedAt = beneficiary.UpdatedAt
+		m.data.irisBeneficiaries[i] = existing
+	}
+
+	return nil
+}
+
+// insertIrisPayouts inserts either all of the payouts or none of them.
+func (m *memoryStorage) insertIrisPayouts(ctx context.Context, payouts []IrisPayout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	referenceNos := make(map[string]bool)
+	for _, existing := range m.data.irisPayouts {
+		referenceNos[existing.ReferenceNo] = true
+	}
+
+	for _, payout := range payouts {
+		if referenceNos[payout.ReferenceNo] {
+			return fmt.Errorf("failed to insert iris payout: reference no %s already exists", payout.ReferenceNo)
+		}
+		referenceNos[payout.ReferenceNo] = true
+	}
+
+	m.data.irisPayouts = append(m.data.irisPayouts, payouts...)
+	return nil
+}
+
+func (m *memoryStorage) getIrisPayout(ctx context.Context, referenceNo string) (IrisPayout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, payout := range m.data.irisPayouts {
+		if payout.ReferenceNo == referenceNo {
+			return payout, nil
+		}
+	}
+
+	return IrisPayout{}, ErrIrisPayoutNotFound
+}
+
+func (m *memoryStorage) updateIrisPayout(ctx context.Context, payout IrisPayout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.data.irisPayouts {
+		if existing.ReferenceNo != payout.ReferenceNo {
+			continue
+		}
+
+		existing.Status = payout.Status
+		existing.ErrorCode = payout.ErrorCode
+		existing.ErrorMessage = payout.ErrorMessage
+		existing.UpdatedAt = payout.UpdatedAt
+		m.data.irisPayouts[i] = existing
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) approveIrisPayouts(ctx context.Context, initialBalance int64, payouts []IrisPayout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var spent int64
+	for _, payout := range m.data.irisPayouts {
+		for _, status := range irisSpentStatuses {
+			if payout.Status == status {
+				spent += payout.Amount
+				break
+			}
+		}
+	}
+
+	var total int64
+	for _, payout := range payouts {
+		total += payout.Amount
+	}
+
+	if total > initialBalance-spent {
+		return ErrIrisBalanceInsufficient
+	}
+
+	// Every payout is checked before any is updated, like a database transaction that rolls back
+	indexes := make([]int, len(payouts))
+	for i, payout := range payouts {
+		indexes[i] = -1
+		for j, existing := range m.data.irisPayouts {
+			if existing.ReferenceNo == payout.ReferenceNo && existing.Status == IrisPayoutStatusQueued {
+				indexes[i] = j
+				break
+			}
+		}
+
+		if indexes[i] == -1 {
+			return ErrIrisPayoutNotQueued
+		}
+	}
+
+	for i, payout := range payouts {
+		existing := m.data.irisPayouts[indexes[i]]
+		existing.Status = payout.Status
+		existing.ErrorCode = payout.ErrorCode
+		existing.ErrorMessage = payout.ErrorMessage
+		existing.UpdatedAt = payout.UpdatedAt
+		m.data.irisPayouts[indexes[i]] = existing
+	}
+
+	return nil
+}
+
+func (m *memoryStorage) sumIrisPayouts(ctx context.Context, statuses ...IrisPayoutStatus) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sum int64
+	for _, payout := range m.data.irisPayouts {
+		for _, status := range statuses {
+			if payout.Status == status {
+				sum += payout.Amount
+				break
+			}
+		}
+	}
+
+	return sum, nil
+}
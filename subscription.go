@@ -0,0 +1,772 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const subscriptionTimeLayout = "2006-01-02 15:04:05 -0700"
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive   SubscriptionStatus = "active"
+	SubscriptionStatusInactive SubscriptionStatus = "inactive"
+	SubscriptionStatusExpired  SubscriptionStatus = "expired"
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled"
+)
+
+type subscriptionRequest struct {
+	Name            string                     `json:"name"`
+	Amount          string                     `json:"amount"`
+	Currency        string                     `json:"currency"`
+	PaymentType     string                     `json:"payment_type"`
+	Token           string                     `json:"token"`
+	Schedule        SubscriptionSchedule       `json:"schedule"`
+	RetrySchedule   *SubscriptionRetrySchedule `json:"retry_schedule,omitempty"`
+	Metadata        map[string]interface{}     `json:"metadata"`
+	CustomerDetails CustomerDetail             `json:"customer_details"`
+	Gopay           SubscriptionGopay          `json:"gopay"`
+}
+
+type SubscriptionSchedule struct {
+	Interval int64 `json:"interval"`
+	// Possible values are day, week or month.
+	IntervalUnit string `json:"interval_unit"`
+	// Zero means the subscription never expires.
+	MaxInterval int64 `json:"max_interval"`
+	// Formatted as "2006-01-02 15:04:05 -0700", defaults to the time the subscription is created.
+	StartTime string `json:"start_time"`
+}
+
+// SubscriptionRetrySchedule decides how failed charges are retried before
+// the subscription moves on to the next interval.
+type SubscriptionRetrySchedule struct {
+	Interval int64 `json:"interval"`
+	// Possible values are day, hour or minute.
+	IntervalUnit string `json:"interval_unit"`
+	MaxInterval  int64  `json:"max_interval"`
+}
+
+type SubscriptionGopay struct {
+	AccountId string `json:"account_id"`
+}
+
+type subscriptionScheduleResponse struct {
+	Interval        int64  `json:"interval"`
+	CurrentInterval int64  `json:"current_interval"`
+	MaxInterval     int64  `json:"max_interval"`
+	IntervalUnit    string `json:"interval_unit"`
+	StartTime       string `json:"start_time"`
+	NextExecutionAt string `json:"next_execution_at,omitempty"`
+}
+
+type subscriptionRetryScheduleResponse struct {
+	Interval        int64  `json:"interval"`
+	CurrentInterval int64  `json:"current_interval"`
+	MaxInterval     int64  `json:"max_interval"`
+	IntervalUnit    string `json:"interval_unit"`
+}
+
+type subscriptionResponse struct {
+	Id              string                             `json:"id"`
+	Name            string                             `json:"name"`
+	Amount          string                             `json:"amount"`
+	Currency        string                             `json:"currency"`
+	CreatedAt       string                             `json:"created_at"`
+	UpdatedAt       string                             `json:"updated_at"`
+	Schedule        subscriptionScheduleResponse       `json:"schedule"`
+	RetrySchedule   *subscriptionRetryScheduleResponse `json:"retry_schedule,omitempty"`
+	Status          string                             `json:"status"`
+	Token           string                             `json:"token"`
+	PaymentType     string                             `json:"payment_type"`
+	TransactionIds  []string                           `json:"transaction_ids"`
+	Metadata        map[string]interface{}             `json:"metadata,omitempty"`
+	CustomerDetails CustomerDetail                     `json:"customer_details"`
+	Gopay           *SubscriptionGopay                 `json:"gopay,omitempty"`
+}
+
+type subscriptionErrorResponse struct {
+	StatusMessage    string   `json:"status_message"`
+	ValidationErrors []string `json:"validation_errors,omitempty"`
+}
+
+type Subscription struct {
+	Id              string
+	MerchantId      string
+	Status          SubscriptionStatus
+	Request         subscriptionRequest
+	CurrentInterval int64
+	CurrentRetry    int64
+	// NextExecutionAt is nil once the subscription will never be charged again.
+	NextExecutionAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (d *Dependencies) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Parse request body
+	var req subscriptionRequest
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Bad request", ValidationErrors: []string{err.Error()}})
+		return
+	}
+
+	now := d.Clock.Now()
+	if req.Currency == "" {
+		req.Currency = "IDR"
+	}
+	if req.Schedule.StartTime == "" {
+		req.Schedule.StartTime = now.In(transactionTimeLocation).Format(subscriptionTimeLayout)
+	}
+
+	// Validate request body
+	validationErrors := req.Validate()
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Bad request", ValidationErrors: validationErrors})
+		return
+	}
+
+	subscriptionId, err := newId()
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	// Validate has made sure that the start time is parseable
+	startTime, _ := time.Parse(subscriptionTimeLayout, req.Schedule.StartTime)
+	subscription := Subscription{
+		Id:              subscriptionId,
+		MerchantId:      merchantFromContext(r.Context()).MerchantId,
+		Status:          SubscriptionStatusActive,
+		Request:         req,
+		NextExecutionAt: &startTime,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	err = d.Storage.insertSubscription(r.Context(), subscription)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subscription.response(nil))
+}
+
+func (d *Dependencies) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := d.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	transactions, err := d.listSubscriptionTransactions(r.Context(), subscription.Id)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(subscription.response(transactions))
+}
+
+// UpdateSubscription changes the fields that are present on the request body,
+// except for the payment type which can not be changed.
+func (d *Dependencies) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	// Validate content type headers
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	subscription, ok := d.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	// Fields that are not on the request body are left as they are
+	req := subscription.Request
+	err := d.decodeRequestBody(r, &req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Bad request", ValidationErrors: []string{err.Error()}})
+		return
+	}
+
+	validationErrors := req.Validate()
+	if req.PaymentType != subscription.Request.PaymentType {
+		validationErrors = append(validationErrors, "subscription.payment_type can not be changed")
+	}
+
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Bad request", ValidationErrors: validationErrors})
+		return
+	}
+
+	// The next charge follows the new schedule, counted from the start time like the scheduler does.
+	// A retry that is under way keeps its time, and the scheduler follows the new schedule after it.
+	schedule := req.Schedule
+	previousSchedule := subscription.Request.Schedule
+	scheduleChanged := schedule.Interval != previousSchedule.Interval ||
+		schedule.IntervalUnit != previousSchedule.IntervalUnit ||
+		schedule.StartTime != previousSchedule.StartTime
+	if scheduleChanged && subscription.NextExecutionAt != nil && subscription.CurrentRetry == 0 {
+		// Validate has made sure that the start time is parseable
+		startTime, _ := time.Parse(subscriptionTimeLayout, schedule.StartTime)
+		nextExecutionAt := addScheduleInterval(startTime, subscription.CurrentInterval*schedule.Interval, schedule.IntervalUnit)
+		subscription.NextExecutionAt = &nextExecutionAt
+	}
+
+	subscription.Request = req
+	subscription.UpdatedAt = d.Clock.Now()
+	err = d.Storage.updateSubscription(r.Context(), subscription)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status_message": "Subscription is updated."}`))
+}
+
+// EnableSubscription resumes an inactive subscription. Intervals that were
+// missed while it was inactive are charged straight away.
+func (d *Dependencies) EnableSubscription(w http.ResponseWriter, r *http.Request) {
+	d.changeSubscriptionStatus(w, r, SubscriptionStatusActive, SubscriptionStatusInactive)
+}
+
+// DisableSubscription pauses an active subscription.
+func (d *Dependencies) DisableSubscription(w http.ResponseWriter, r *http.Request) {
+	d.changeSubscriptionStatus(w, r, SubscriptionStatusInactive, SubscriptionStatusActive)
+}
+
+// CancelSubscription stops the subscription for good.
+func (d *Dependencies) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	d.changeSubscriptionStatus(w, r, SubscriptionStatusCanceled, SubscriptionStatusActive, SubscriptionStatusInactive)
+}
+
+func (d *Dependencies) changeSubscriptionStatus(w http.ResponseWriter, r *http.Request, status SubscriptionStatus, from ...SubscriptionStatus) {
+	subscription, ok := d.findSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	var allowed = false
+	for _, s := range from {
+		if subscription.Status == s {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(int(ErrorCannotModify))
+		json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Subscription is " + string(subscription.Status) + " and can not be updated."})
+		return
+	}
+
+	subscription.Status = status
+	subscription.UpdatedAt = d.Clock.Now()
+	if status == SubscriptionStatusCanceled {
+		subscription.NextExecutionAt = nil
+	}
+
+	err := d.Storage.updateSubscription(r.Context(), subscription)
+	if err != nil {
+		writeInternalErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status_message": "Subscription is updated."}`))
+}
+
+// findSubscription looks up the subscription of the request's URL,
+// and writes the error response if it can not.
+func (d *Dependencies) findSubscription(w http.ResponseWriter, r *http.Request) (Subscription, bool) {
+	subscription, err := d.Storage.getSubscription(r.Context(), chi.URLParam(r, "subscriptionId"))
+	if err == nil && subscription.MerchantId != merchantFromContext(r.Context()).MerchantId {
+		err = ErrSubscriptionNotFound
+	}
+	if err != nil {
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(subscriptionErrorResponse{StatusMessage: "Subscription doesn't exist."})
+			return Subscription{}, false
+		}
+
+		writeInternalErrorResponse(w, r, err)
+		return Subscription{}, false
+	}
+
+	return subscription, true
+}
+
+func (s subscriptionRequest) Validate() []string {
+	var validationErrors []string
+
+	if s.Name == "" {
+		validationErrors = append(validationErrors, "subscription.name is required")
+	}
+
+	if len(s.Name) > 40 {
+		validationErrors = append(validationErrors, "subscription.name must not exceed 40 characters")
+	}
+
+	amount, err := strconv.ParseInt(s.Amount, 10, 64)
+	if err != nil || amount <= 0 {
+		validationErrors = append(validationErrors, "subscription.amount must be a positive whole number")
+	}
+
+	if s.Currency != "IDR" {
+		validationErrors = append(validationErrors, "subscription.currency must be IDR")
+	}
+
+	switch s.PaymentType {
+	case "credit_card":
+		break
+	case "gopay":
+		if s.Gopay.AccountId == "" {
+			validationErrors = append(validationErrors, "subscription.gopay.account_id is required")
+		}
+	default:
+		validationErrors = append(validationErrors, "subscription.payment_type must be one of credit_card or gopay")
+	}
+
+	if s.Token == "" {
+		validationErrors = append(validationErrors, "subscription.token is required")
+	}
+
+	if s.Schedule.Interval <= 0 {
+		validationErrors = append(validationErrors, "subscription.schedule.interval must be greater than 0")
+	}
+
+	switch s.Schedule.IntervalUnit {
+	case "day", "week", "month":
+		break
+	default:
+		validationErrors = append(validationErrors, "subscription.schedule.interval_unit must be one of day, week or month")
+	}
+
+	if s.Schedule.MaxInterval < 0 {
+		validationErrors = append(validationErrors, "subscription.schedule.max_interval must not be negative")
+	}
+
+	_, err = time.Parse(subscriptionTimeLayout, s.Schedule.StartTime)
+	if err != nil {
+		validationErrors = append(validationErrors, "subscription.schedule.start_time must be formatted as yyyy-MM-dd HH:mm:ss Z")
+	}
+
+	if s.RetrySchedule != nil {
+		if s.RetrySchedule.Interval <= 0 {
+			validationErrors = append(validationErrors, "subscription.retry_schedule.interval must be greater than 0")
+		}
+
+		switch s.RetrySchedule.IntervalUnit {
+		case "day", "hour", "minute":
+			break
+		default:
+			validationErrors = append(validationErrors, "subscription.retry_schedule.interval_unit must be one of day, hour or minute")
+		}
+
+		if s.RetrySchedule.MaxInterval <= 0 {
+			validationErrors = append(validationErrors, "subscription.retry_schedule.max_interval must be greater than 0")
+		}
+	}
+
+	return validationErrors
+}
+
+func (s Subscription) response(transactions []Transaction) subscriptionResponse {
+	response := subscriptionResponse{
+		Id:        s.Id,
+		Name:      s.Request.Name,
+		Amount:    s.Request.Amount,
+		Currency:  s.Request.Currency,
+		CreatedAt: s.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+		UpdatedAt: s.UpdatedAt.In(transactionTimeLocation).Format(transactionTimeLayout),
+		Schedule: subscriptionScheduleResponse{
+			Interval:        s.Request.Schedule.Interval,
+			CurrentInterval: s.CurrentInterval,
+			MaxInterval:     s.Request.Schedule.MaxInterval,
+			IntervalUnit:    s.Request.Schedule.IntervalUnit,
+			StartTime:       s.Request.Schedule.StartTime,
+		},
+		Status:          string(s.Status),
+		Token:           s.Request.Token,
+		PaymentType:     s.Request.PaymentType,
+		TransactionIds:  []string{},
+		Metadata:        s.Request.Metadata,
+		CustomerDetails: s.Request.CustomerDetails,
+	}
+
+	if s.NextExecutionAt != nil {
+		response.Schedule.NextExecutionAt = s.NextExecutionAt.In(transactionTimeLocation).Format(subscriptionTimeLayout)
+	}
+
+	if s.Request.RetrySchedule != nil {
+		response.RetrySchedule = &subscriptionRetryScheduleResponse{
+			Interval:        s.Request.RetrySchedule.Interval,
+			CurrentInterval: s.CurrentRetry,
+			MaxInterval:     s.Request.RetrySchedule.MaxInterval,
+			IntervalUnit:    s.Request.RetrySchedule.IntervalUnit,
+		}
+	}
+
+	if s.Request.PaymentType == "gopay" {
+		response.Gopay = &s.Request.Gopay
+	}
+
+	for _, transaction := range transactions {
+		response.TransactionIds = append(response.TransactionIds, transaction.Id)
+	}
+
+	return response
+}
+
+// subscriptionColumns are the columns that scanSubscription reads, in order.
+const subscriptionColumns = `id,
+		COALESCE(merchant_id, ''),
+		status,
+		request,
+		current_interval,
+		current_retry,
+		next_execution_at,
+		created_at,
+		updated_at`
+
+func scanSubscription(row rowScanner) (Subscription, error) {
+	var subscription Subscription
+	var request string
+	var nextExecutionAt sql.NullTime
+	err := row.Scan(
+		&subscription.Id,
+		&subscription.MerchantId,
+		&subscription.Status,
+		&request,
+		&subscription.CurrentInterval,
+		&subscription.CurrentRetry,
+		&nextExecutionAt,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	if nextExecutionAt.Valid {
+		subscription.NextExecutionAt = &nextExecutionAt.Time
+	}
+
+	err = json.Unmarshal([]byte(request), &subscription.Request)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to unmarshal subscription request: %w", err)
+	}
+
+	return subscription, nil
+}
+
+func (s *sqlStorage) insertSubscription(ctx context.Context, subscription Subscription) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	err = s.insertSubscriptionTx(ctx, tx, subscription)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// insertSubscriptionTx inserts the subscription within a database transaction, such as the one that inserts a seed.
+func (s *sqlStorage) insertSubscriptionTx(ctx context.Context, tx *sql.Tx, subscription Subscription) error {
+	request, err := json.Marshal(subscription.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription request: %w", err)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		subscriptions
+		(
+			id,
+			merchant_id,
+			status,
+			request,
+			current_interval,
+			current_retry,
+			next_execution_at,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	var nextExecutionAt sql.NullTime
+	if subscription.NextExecutionAt != nil {
+		// Stored in UTC, so that the scheduler can compare it with the current time on every database
+		nextExecutionAt = sql.NullTime{Time: subscription.NextExecutionAt.UTC(), Valid: true}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		subscription.Id,
+		subscription.MerchantId,
+		subscription.Status,
+		string(request),
+		subscription.CurrentInterval,
+		subscription.CurrentRetry,
+		nextExecutionAt,
+		subscription.CreatedAt,
+		subscription.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert subscription: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) getSubscription(ctx context.Context, subscriptionId string) (Subscription, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + subscriptionColumns + `
+	FROM
+		subscriptions
+	WHERE
+		id = $1`)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return Subscription{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	subscription, err := scanSubscription(conn.QueryRowContext(ctx, formattedQuery, subscriptionId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Subscription{}, ErrSubscriptionNotFound
+		}
+
+		return Subscription{}, fmt.Errorf("failed to query subscription: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return Subscription{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return subscription, nil
+}
+
+// listDueSubscriptions lists the active subscriptions that should have been charged by now.
+func (s *sqlStorage) listDueSubscriptions(ctx context.Context, now time.Time) ([]Subscription, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + subscriptionColumns + `
+	FROM
+		subscriptions
+	WHERE
+		status = $1
+		AND next_execution_at <= $2
+	ORDER BY
+		next_execution_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, SubscriptionStatusActive, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []Subscription
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate subscriptions: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (s *sqlStorage) updateSubscription(ctx context.Context, subscription Subscription) error {
+	request, err := json.Marshal(subscription.Request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription request: %w", err)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		subscriptions
+	SET
+		status = $1,
+		request = $2,
+		current_interval = $3,
+		current_retry = $4,
+		next_execution_at = $5,
+		updated_at = $6
+	WHERE
+		id = $7`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	var nextExecutionAt sql.NullTime
+	if subscription.NextExecutionAt != nil {
+		// Stored in UTC, so that the scheduler can compare it with the current time on every database
+		nextExecutionAt = sql.NullTime{Time: subscription.NextExecutionAt.UTC(), Valid: true}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		subscription.Status,
+		string(request),
+		subscription.CurrentInterval,
+		subscription.CurrentRetry,
+		nextExecutionAt,
+		subscription.UpdatedAt,
+		subscription.Id,
+	)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
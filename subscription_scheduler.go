@@ -0,0 +1,142 @@
+package mocktrans
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// RunSubscriptionScheduler charges the subscriptions that are due on every tick,
+// until the context is canceled.
+func (d *Dependencies) RunSubscriptionScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := d.ExecuteDueSubscriptions(ctx)
+			if err != nil {
+				log.Printf("failed to execute subscriptions: %v", err)
+			}
+		}
+	}
+}
+
+// ExecuteDueSubscriptions charges every active subscription whose next execution
+// time has passed. A failing subscription does not stop the others from being charged.
+func (d *Dependencies) ExecuteDueSubscriptions(ctx context.Context) error {
+	now := d.Clock.Now()
+	subscriptions, err := d.Storage.listDueSubscriptions(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		err := d.executeSubscription(ctx, subscription, now)
+		if err != nil {
+			log.Printf("failed to execute subscription %s: %v", subscription.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dependencies) executeSubscription(ctx context.Context, subscription Subscription, now time.Time) error {
+	amount, err := strconv.ParseInt(subscription.Request.Amount, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount: %w", err)
+	}
+
+	// Every interval gets its own order_id, and so does every retry of it
+	cycle := subscription.CurrentInterval + 1
+	orderId := subscription.Id + "-" + strconv.FormatInt(cycle, 10)
+	if subscription.CurrentRetry > 0 {
+		orderId += "-retry-" + strconv.FormatInt(subscription.CurrentRetry, 10)
+	}
+
+	req := chargeRequest{
+		PaymentType: subscription.Request.PaymentType,
+		TransactionDetails: TransactionDetail{
+			OrderId:     orderId,
+			GrossAmount: amount,
+		},
+		CustomerDetails: subscription.Request.CustomerDetails,
+		Metadata:        subscription.Request.Metadata,
+		merchantId:      subscription.MerchantId,
+		subscriptionId:  subscription.Id,
+	}
+
+	switch subscription.Request.PaymentType {
+	case "credit_card":
+		req.CreditCard.TokenId = subscription.Request.Token
+	case "gopay":
+		req.Gopay = Gopay{
+			AccountId:          subscription.Request.Gopay.AccountId,
+			PaymentOptionToken: subscription.Request.Token,
+			Recurring:          true,
+		}
+	}
+
+	response, err := d.charge(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	paid := response.TransactionStatus == string(TransactionStatusSettlement) ||
+		(response.TransactionStatus == string(TransactionStatusCapture) && response.FraudStatus == string(FraudStatusAccept))
+
+	retrySchedule := subscription.Request.RetrySchedule
+	if !paid && retrySchedule != nil && subscription.CurrentRetry < retrySchedule.MaxInterval {
+		subscription.CurrentRetry++
+		nextExecutionAt := addRetryInterval(now, retrySchedule.Interval, retrySchedule.IntervalUnit)
+		subscription.NextExecutionAt = &nextExecutionAt
+	} else {
+		// Either paid, or out of retries: the interval is over regardless
+		subscription.CurrentInterval = cycle
+		subscription.CurrentRetry = 0
+
+		startTime, err := time.Parse(subscriptionTimeLayout, subscription.Request.Schedule.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start time: %w", err)
+		}
+
+		// Counted from the start time rather than now, so that a late run does not shift the schedule
+		nextExecutionAt := addScheduleInterval(startTime, cycle*subscription.Request.Schedule.Interval, subscription.Request.Schedule.IntervalUnit)
+		subscription.NextExecutionAt = &nextExecutionAt
+
+		if subscription.Request.Schedule.MaxInterval > 0 && subscription.CurrentInterval >= subscription.Request.Schedule.MaxInterval {
+			subscription.Status = SubscriptionStatusExpired
+			subscription.NextExecutionAt = nil
+		}
+	}
+
+	subscription.UpdatedAt = d.Clock.Now()
+	return d.Storage.updateSubscription(ctx, subscription)
+}
+
+func addScheduleInterval(t time.Time, interval int64, unit string) time.Time {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, int(interval))
+	case "week":
+		return t.AddDate(0, 0, int(interval)*7)
+	default:
+		return t.AddDate(0, int(interval), 0)
+	}
+}
+
+func addRetryInterval(t time.Time, interval int64, unit string) time.Time {
+	switch unit {
+	case "minute":
+		return t.Add(time.Duration(interval) * time.Minute)
+	case "hour":
+		return t.Add(time.Duration(interval) * time.Hour)
+	default:
+		return t.AddDate(0, 0, int(interval))
+	}
+}
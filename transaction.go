@@ -0,0 +1,737 @@
+package mocktrans
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TransactionStatus string
+
+const (
+	TransactionStatusCapture    TransactionStatus = "capture"
+	TransactionStatusSettlement TransactionStatus = "settlement"
+	TransactionStatusPending    TransactionStatus = "pending"
+	TransactionStatusDeny       TransactionStatus = "deny"
+	TransactionStatusCancel     TransactionStatus = "cancel"
+	TransactionStatusExpire     TransactionStatus = "expire"
+	TransactionStatusRefund     TransactionStatus = "refund"
+)
+
+// Midtrans formats every transaction_time in Western Indonesian Time,
+// regardless of where the merchant is located.
+var transactionTimeLocation = time.FixedZone("WIB", int((time.Hour * 7).Seconds()))
+
+const transactionTimeLayout = "2006-01-02 15:04:05"
+
+var ErrDuplicateOrderId = errors.New("order_id has already been utilized")
+var ErrTransactionNotFound = errors.New("transaction not found")
+var ErrTransactionCannotModify = errors.New("transaction status cannot be updated")
+var ErrTransactionStatusChanged = errors.New("transaction status has changed")
+
+type Transaction struct {
+	Id                string
+	OrderId           string
+	PaymentType       string
+	GrossAmount       int64
+	MerchantId        string
+	TransactionStatus TransactionStatus
+	FraudStatus       FraudStatus
+	MaskedCard        string
+	Bank              string
+	// PaymentLinkId is set for transactions that were paid through a payment link.
+	PaymentLinkId string
+	// SubscriptionId is set for transactions that were charged by a subscription.
+	SubscriptionId string
+	// Metadata and the custom fields are the merchant's own, and are echoed back as they were sent.
+	Metadata     map[string]interface{}
+	CustomField1 string
+	CustomField2 string
+	CustomField3 string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// TransactionTime returns the created_at in the format that Midtrans uses.
+func (t Transaction) TransactionTime() string {
+	return t.CreatedAt.In(transactionTimeLocation).Format(transactionTimeLayout)
+}
+
+// FormattedGrossAmount returns the gross amount the way Midtrans sends it,
+// which is a string with two decimal places.
+func (t Transaction) FormattedGrossAmount() string {
+	return fmt.Sprintf("%d.00", t.GrossAmount)
+}
+
+// StatusCode returns the Midtrans status_code for the current
+// transaction status and fraud status.
+func (t Transaction) StatusCode() string {
+	switch t.TransactionStatus {
+	case TransactionStatusCapture:
+		if t.FraudStatus == FraudStatusChallenge {
+			return "201"
+		}
+		return "200"
+	case TransactionStatusSettlement, TransactionStatusCancel, TransactionStatusRefund:
+		return "200"
+	case TransactionStatusPending:
+		return "201"
+	case TransactionStatusDeny:
+		return "202"
+	case TransactionStatusExpire:
+		return "407"
+	}
+
+	return "200"
+}
+
+// newId generates a random UUID (version 4) string.
+func newId() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// transactionColumns are the columns that scanTransaction reads, in order.
+const transactionColumns = `id,
+		order_id,
+		payment_type,
+		gross_amount,
+		COALESCE(merchant_id, ''),
+		transaction_status,
+		fraud_status,
+		COALESCE(masked_card, ''),
+		COALESCE(bank, ''),
+		COALESCE(payment_link_id, ''),
+		COALESCE(subscription_id, ''),
+		COALESCE(metadata, ''),
+		COALESCE(custom_field_1, ''),
+		COALESCE(custom_field_2, ''),
+		COALESCE(custom_field_3, ''),
+		created_at,
+		updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransaction(row rowScanner) (Transaction, error) {
+	var transaction Transaction
+	var metadata string
+	err := row.Scan(
+		&transaction.Id,
+		&transaction.OrderId,
+		&transaction.PaymentType,
+		&transaction.GrossAmount,
+		&transaction.MerchantId,
+		&transaction.TransactionStatus,
+		&transaction.FraudStatus,
+		&transaction.MaskedCard,
+		&transaction.Bank,
+		&transaction.PaymentLinkId,
+		&transaction.SubscriptionId,
+		&metadata,
+		&transaction.CustomField1,
+		&transaction.CustomField2,
+		&transaction.CustomField3,
+		&transaction.CreatedAt,
+		&transaction.UpdatedAt,
+	)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if metadata != "" {
+		err = json.Unmarshal([]byte(metadata), &transaction.Metadata)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+	}
+
+	return transaction, nil
+}
+
+func (s *sqlStorage) insertTransaction(ctx context.Context, transaction Transaction, virtualAccounts ...VirtualAccount) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	err = s.insertTransactionTx(ctx, tx, transaction, virtualAccounts...)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// insertTransactionTx inserts the transaction, its first status and its virtual accounts
+// within a database transaction, such as the one that inserts a seed.
+func (s *sqlStorage) insertTransactionTx(ctx context.Context, tx *sql.Tx, transaction Transaction, virtualAccounts ...VirtualAccount) error {
+	var metadata sql.NullString
+	if transaction.Metadata != nil {
+		value, err := json.Marshal(transaction.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+
+		metadata = sql.NullString{String: string(value), Valid: true}
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		transactions
+		(
+			id,
+			order_id,
+			payment_type,
+			gross_amount,
+			merchant_id,
+			transaction_status,
+			fraud_status,
+			masked_card,
+			bank,
+			payment_link_id,
+			subscription_id,
+			metadata,
+			custom_field_1,
+			custom_field_2,
+			custom_field_3,
+			created_at,
+			updated_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		transaction.Id,
+		transaction.OrderId,
+		transaction.PaymentType,
+		transaction.GrossAmount,
+		transaction.MerchantId,
+		transaction.TransactionStatus,
+		transaction.FraudStatus,
+		transaction.MaskedCard,
+		transaction.Bank,
+		transaction.PaymentLinkId,
+		transaction.SubscriptionId,
+		metadata,
+		transaction.CustomField1,
+		transaction.CustomField2,
+		transaction.CustomField3,
+		// Stored in UTC, so that the dashboard can filter by date on every database
+		transaction.CreatedAt.UTC(),
+		transaction.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	err = s.insertTransactionStatusChange(ctx, tx, TransactionStatusChange{
+		TransactionId:     transaction.Id,
+		TransactionStatus: transaction.TransactionStatus,
+		FraudStatus:       transaction.FraudStatus,
+		CreatedAt:         transaction.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, virtualAccount := range virtualAccounts {
+		err = s.insertVirtualAccountTx(ctx, tx, virtualAccount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTransaction finds a transaction by either its transaction ID or its order ID,
+// just like Midtrans accepts both on every /v2/{order_id}/* endpoint.
+func (s *sqlStorage) getTransaction(ctx context.Context, id string) (Transaction, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + transactionColumns + `
+	FROM
+		transactions
+	WHERE
+		id = $1
+		OR order_id = $2
+	ORDER BY
+		created_at DESC
+	LIMIT 1`)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	transaction, err := scanTransaction(conn.QueryRowContext(ctx, formattedQuery, id, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Transaction{}, ErrTransactionNotFound
+		}
+
+		return Transaction{}, fmt.Errorf("failed to query transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return Transaction{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return transaction, nil
+}
+
+// getMerchantTransaction is getTransaction, limited to the transactions of the merchant.
+func (s *sqlStorage) getMerchantTransaction(ctx context.Context, merchantId string, id string) (Transaction, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + transactionColumns + `
+	FROM
+		transactions
+	WHERE
+		(id = $1 OR order_id = $2)
+		AND merchant_id = $3
+	ORDER BY
+		created_at DESC
+	LIMIT 1`)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	transaction, err := scanTransaction(conn.QueryRowContext(ctx, formattedQuery, id, id, merchantId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Transaction{}, ErrTransactionNotFound
+		}
+
+		return Transaction{}, fmt.Errorf("failed to query transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return Transaction{}, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return transaction, nil
+}
+
+// listOrderTransactions lists the transactions of the order, every merchant has its own order_ids.
+func (d *Dependencies) listOrderTransactions(ctx context.Context, merchantId string, orderId string) ([]Transaction, error) {
+	transactions, err := d.Storage.listTransactionsBy(ctx, "order_id", orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	var merchantTransactions []Transaction
+	for _, transaction := range transactions {
+		if transaction.MerchantId == merchantId {
+			merchantTransactions = append(merchantTransactions, transaction)
+		}
+	}
+
+	return merchantTransactions, nil
+}
+
+func (d *Dependencies) listPaymentLinkTransactions(ctx context.Context, paymentLinkId string) ([]Transaction, error) {
+	return d.Storage.listTransactionsBy(ctx, "payment_link_id", paymentLinkId)
+}
+
+func (d *Dependencies) listSubscriptionTransactions(ctx context.Context, subscriptionId string) ([]Transaction, error) {
+	return d.Storage.listTransactionsBy(ctx, "subscription_id", subscriptionId)
+}
+
+// listTransactionsBy lists the transactions whose column equals to the value, oldest first.
+// The column is put into the query as is, so it must never come from the user.
+func (s *sqlStorage) listTransactionsBy(ctx context.Context, column string, value string) ([]Transaction, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + transactionColumns + `
+	FROM
+		transactions
+	WHERE
+		` + column + ` = $1
+	ORDER BY
+		created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// TransactionFilter narrows down listTransactions, the zero value of a field matches every transaction.
+type TransactionFilter struct {
+	MerchantId        string
+	TransactionStatus TransactionStatus
+	PaymentType       string
+	// OrderId matches the order_ids that contain it.
+	OrderId string
+	// CreatedFrom is inclusive, CreatedUntil is exclusive.
+	CreatedFrom  time.Time
+	CreatedUntil time.Time
+	Limit        int
+}
+
+// listTransactions lists the transactions that match the filter, newest first.
+func (s *sqlStorage) listTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	var conditions []string
+	var args []any
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, condition+" $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.MerchantId != "" {
+		addCondition("merchant_id =", filter.MerchantId)
+	}
+	if filter.TransactionStatus != "" {
+		addCondition("transaction_status =", filter.TransactionStatus)
+	}
+	if filter.PaymentType != "" {
+		addCondition("payment_type =", filter.PaymentType)
+	}
+	if filter.OrderId != "" {
+		addCondition("order_id LIKE", "%"+filter.OrderId+"%")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCondition("created_at >=", filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedUntil.IsZero() {
+		addCondition("created_at <", filter.CreatedUntil.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE\n\t\t" + strings.Join(conditions, "\n\t\tAND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		` + transactionColumns + `
+	FROM
+		transactions
+	` + where + `
+	ORDER BY
+		created_at DESC
+	LIMIT ` + strconv.Itoa(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate transactions: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (s *sqlStorage) updateTransactionStatus(ctx context.Context, transactionId string, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		transactions
+	SET
+		transaction_status = $1,
+		fraud_status = $2,
+		updated_at = $3
+	WHERE
+		id = $4`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, formattedQuery, transactionStatus, fraudStatus, now.UTC(), transactionId)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return ErrTransactionNotFound
+	}
+
+	err = s.insertTransactionStatusChange(ctx, tx, TransactionStatusChange{
+		TransactionId:     transactionId,
+		TransactionStatus: transactionStatus,
+		FraudStatus:       fraudStatus,
+		CreatedAt:         now,
+	})
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// updateTransactionStatusFrom is updateTransactionStatus for a transaction that must still be
+// in the expected status, which is checked by the update itself so that nothing changes the
+// transaction in between. It returns ErrTransactionStatusChanged when the transaction is not.
+func (s *sqlStorage) updateTransactionStatusFrom(ctx context.Context, transactionId string, expectedStatus TransactionStatus, transactionStatus TransactionStatus, fraudStatus FraudStatus, now time.Time) error {
+	formattedQuery, err := s.formatPlaceholder(`UPDATE
+		transactions
+	SET
+		transaction_status = $1,
+		fraud_status = $2,
+		updated_at = $3
+	WHERE
+		id = $4
+		AND transaction_status = $5`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, formattedQuery, transactionStatus, fraudStatus, now.UTC(), transactionId, expectedStatus)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to update transaction status: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return ErrTransactionStatusChanged
+	}
+
+	err = s.insertTransactionStatusChange(ctx, tx, TransactionStatusChange{
+		TransactionId:     transactionId,
+		TransactionStatus: transactionStatus,
+		FraudStatus:       fraudStatus,
+		CreatedAt:         now,
+	})
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package mocktrans
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnknownTransactionAction = errors.New("unknown transaction action")
+
+// transactionAction moves a transaction into Status, from any of the From statuses.
+// These are what happens at the bank or on the Midtrans dashboard, outside of the API.
+type transactionAction struct {
+	Status TransactionStatus
+	From   []TransactionStatus
+}
+
+var transactionActions = map[string]transactionAction{
+	"settle": {Status: TransactionStatusSettlement, From: []TransactionStatus{TransactionStatusPending, TransactionStatusCapture}},
+	"expire": {Status: TransactionStatusExpire, From: []TransactionStatus{TransactionStatusPending}},
+	"cancel": {Status: TransactionStatusCancel, From: []TransactionStatus{TransactionStatusPending, TransactionStatusCapture}},
+	"refund": {Status: TransactionStatusRefund, From: []TransactionStatus{TransactionStatusSettlement}},
+}
+
+// transactionActionNames are the transactionActions in the order that they are offered,
+// followed by resend, which notifies the merchant again without changing anything.
+var transactionActionNames = []string{"settle", "expire", "cancel", "refund", "resend"}
+
+// ApplyTransactionAction applies the named action to the transaction and notifies the merchant about it.
+func (d *Dependencies) ApplyTransactionAction(ctx context.Context, transactionId string, name string) (Transaction, error) {
+	transaction, err := d.Storage.getTransaction(ctx, transactionId)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	if name == "resend" {
+		d.Notify(transaction)
+		return transaction, nil
+	}
+
+	action, ok := transactionActions[name]
+	if !ok {
+		return Transaction{}, ErrUnknownTransactionAction
+	}
+
+	if !action.allows(transaction.TransactionStatus) {
+		return Transaction{}, ErrTransactionCannotModify
+	}
+
+	// Another action may have moved the transaction since it was read, only one of them wins
+	err = d.Storage.updateTransactionStatusFrom(ctx, transaction.Id, transaction.TransactionStatus, action.Status, transaction.FraudStatus, d.Clock.Now())
+	if err != nil {
+		if errors.Is(err, ErrTransactionStatusChanged) {
+			return Transaction{}, ErrTransactionCannotModify
+		}
+
+		return Transaction{}, err
+	}
+
+	transaction.TransactionStatus = action.Status
+
+	transaction.UpdatedAt = d.Clock.Now()
+	d.Notify(transaction)
+	return transaction, nil
+}
+
+func (a transactionAction) allows(status TransactionStatus) bool {
+	for _, from := range a.From {
+		if status == from {
+			return true
+		}
+	}
+
+	return false
+}
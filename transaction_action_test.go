@@ -0,0 +1,105 @@
+package mocktrans
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readBarrierStorage holds back the first reads of a transaction until all of them
+// have been made, so that every reader sees the transaction before any of them changes it.
+type readBarrierStorage struct {
+	Storage
+	readers int32
+	reads   sync.WaitGroup
+}
+
+func newReadBarrierStorage(readers int) *readBarrierStorage {
+	s := &readBarrierStorage{Storage: NewMemoryStorage(), readers: int32(readers)}
+	s.reads.Add(readers)
+	return s
+}
+
+func (s *readBarrierStorage) getTransaction(ctx context.Context, transactionId string) (Transaction, error) {
+	transaction, err := s.Storage.getTransaction(ctx, transactionId)
+	if atomic.AddInt32(&s.readers, -1) >= 0 {
+		s.reads.Done()
+		s.reads.Wait()
+	}
+
+	return transaction, err
+}
+
+// newRaceDependencies returns Dependencies with a pending transaction, whose first reads
+// are held back until the number of readers have read it.
+func newRaceDependencies(t *testing.T, readers int) (*Dependencies, Transaction) {
+	t.Helper()
+
+	storage := newReadBarrierStorage(readers)
+	d := &Dependencies{
+		Storage:   storage,
+		Clock:     SystemClock{},
+		Merchants: []Merchant{{MerchantId: "G000000000", ServerKey: "SB-Mid-server-abc123cde456"}},
+		Snapshots: NewSnapshotStore(),
+	}
+
+	now := time.Now()
+	transaction := Transaction{
+		Id:                "6c3dc7a8-6f6f-4a2e-9b6e-0f3f1c3c2a10",
+		OrderId:           "order-1",
+		PaymentType:       "gopay",
+		GrossAmount:       10000,
+		MerchantId:        "G000000000",
+		TransactionStatus: TransactionStatusPending,
+		FraudStatus:       FraudStatusAccept,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	err := storage.Storage.insertTransaction(context.Background(), transaction)
+	if err != nil {
+		t.Fatalf("failed to insert transaction: %v", err)
+	}
+
+	return d, transaction
+}
+
+func TestConcurrentTransactionActions(t *testing.T) {
+	d, transaction := newRaceDependencies(t, 2)
+	defer d.WaitForNotifications()
+
+	// Settling and cancelling a pending transaction at the same time, only one of them can happen
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, action := range []string{"settle", "cancel"} {
+		wg.Add(1)
+		go func(i int, action string) {
+			defer wg.Done()
+			_, errs[i] = d.ApplyTransactionAction(context.Background(), transaction.Id, action)
+		}(i, action)
+	}
+	wg.Wait()
+
+	var succeeded int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrTransactionCannotModify):
+			t.Fatalf("expected the losing action to be refused, got %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one action to succeed, got %d", succeeded)
+	}
+
+	history, err := d.Storage.listTransactionStatusHistory(context.Background(), transaction.Id)
+	if err != nil {
+		t.Fatalf("failed to list status history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("expected the pending and one final status, got %+v", history)
+	}
+}
@@ -0,0 +1,107 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TransactionStatusChange is one entry of the transaction's status history,
+// which starts with the status that the transaction was created with.
+type TransactionStatusChange struct {
+	TransactionId     string
+	TransactionStatus TransactionStatus
+	FraudStatus       FraudStatus
+	CreatedAt         time.Time
+}
+
+// insertTransactionStatusChange records the status change within the database
+// transaction that changes the status, so that the history never misses one.
+func (s *sqlStorage) insertTransactionStatusChange(ctx context.Context, tx *sql.Tx, change TransactionStatusChange) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		transaction_status_history
+		(
+			transaction_id,
+			transaction_status,
+			fraud_status,
+			created_at
+		)
+	VALUES
+		($1, $2, $3, $4)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, formattedQuery, change.TransactionId, change.TransactionStatus, change.FraudStatus, change.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert transaction status change: %w", err)
+	}
+
+	return nil
+}
+
+// listTransactionStatusHistory lists the status changes of the transaction, oldest first.
+func (s *sqlStorage) listTransactionStatusHistory(ctx context.Context, transactionId string) ([]TransactionStatusChange, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		transaction_id,
+		transaction_status,
+		fraud_status,
+		created_at
+	FROM
+		transaction_status_history
+	WHERE
+		transaction_id = $1
+	ORDER BY
+		created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, transactionId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction status history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []TransactionStatusChange
+	for rows.Next() {
+		var change TransactionStatusChange
+		err := rows.Scan(&change.TransactionId, &change.TransactionStatus, &change.FraudStatus, &change.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction status change: %w", err)
+		}
+
+		history = append(history, change)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate transaction status history: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return history, nil
+}
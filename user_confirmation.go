@@ -1,20 +1,16 @@
-package main
+package mocktrans
 
 import (
+	"encoding/json"
+	"errors"
+	"html"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
-const confirmationTemplate = `<!DOCTYPE html>
-<html lang="en">
-
-<head>
-	<meta charset="UTF-8">
-	<meta http-equiv="X-UA-Compatible" content="IE=edge">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>Mocktrans - Dummy Midtrans for Development purposes</title>
-
-	<style>
+// pollenStyle holds the CSS variables shared by every page that Mocktrans renders.
+const pollenStyle = `
 		/* Copyright 2021 Madeleine Ostoja <madi@heybokeh.com>
 
 		Permission is hereby granted, free of charge, to any person obtaining a copy
@@ -210,7 +206,18 @@ const confirmationTemplate = `<!DOCTYPE html>
 			--grid-page-gutter: 5vw;
 			--grid-page-main: 2 / 3;
 			--grid-page: minmax(var(--grid-page-gutter), 1fr) minmax(0, var(--grid-page-width)) minmax(var(--grid-page-gutter), 1fr)
-		}
+		}`
+
+const confirmationTemplate = `<!DOCTYPE html>
+<html lang="en">
+
+<head>
+	<meta charset="UTF-8">
+	<meta http-equiv="X-UA-Compatible" content="IE=edge">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>Mocktrans - Dummy Midtrans for Development purposes</title>
+
+	<style>` + pollenStyle + `
 
 		.container {
 			width: 100%;
@@ -225,45 +232,133 @@ const confirmationTemplate = `<!DOCTYPE html>
 			padding-top: 1rem;
 		}
 
+		header {
+			padding: 1rem;
+			background-color: {{brand_color}};
+			color: var(--color-grey-50);
+			font-weight: var(--weight-semibold);
+		}
+
 		button {
 			padding: 0.5rem;
 			border: none;
-			background-color: var(--color-blue-700);
+			background-color: {{brand_color}};
 			color: var(--color-grey-50);
 		}
 
+		button.secondary {
+			background-color: var(--color-grey-500);
+		}
+
 		button:hover {
 			cursor: pointer;
 		}
 	</style>
 
 	<script>
-		async function confirmButton(transactionId) {
-			await fetch("/confirm?transaction_id=" + transactionId, {
+		// Inside an iframe, the page was opened by snap.js
+		const embedded = window.parent !== window;
+
+		function postResult(result) {
+			window.parent.postMessage({ type: "mocktrans:snap:result", result: result }, "*");
+		}
+
+		async function confirmButton(transactionId, action) {
+			const response = await fetch("/confirm?transaction_id=" + transactionId + "&action=" + action, {
 				method: "PUT"
 			});
 
-			// Hide the confirmation button
-			document.getElementById("confirmation-button").style.display = "none";
+			// Hide the confirmation buttons
+			document.getElementById("confirmation-buttons").style.display = "none";
 
 			// Display the "begone" text
-			document.getElementById("begone-text").style.display = "block";
+			const begoneText = document.getElementById("begone-text");
+			if (!response.ok) {
+				begoneText.innerText = "Something went wrong, the transaction was not updated.";
+			}
+			begoneText.style.display = "block";
+
+			if (response.ok && embedded) {
+				postResult(await response.json());
+				return;
+			}
+
+			// Go back to the merchant, if the transaction came from Snap
+			const redirectUrl = document.getElementById("confirmation-buttons").dataset[action + "Redirect"];
+			if (response.ok && redirectUrl) {
+				window.location.href = redirectUrl;
+			}
+		}
+
+		function payLaterButton() {
+			postResult(JSON.parse(document.getElementById("confirmation-buttons").dataset.result));
 		}
+
+		window.addEventListener("DOMContentLoaded", function () {
+			const buttons = document.getElementById("confirmation-buttons");
+			if (!embedded) {
+				return;
+			}
+
+			// Transactions that are already done are reported straight away
+			if (buttons.style.display === "none") {
+				postResult(JSON.parse(buttons.dataset.result));
+				return;
+			}
+
+			document.getElementById("pay-later-button").style.display = "inline-block";
+		});
 	</script>
 </head>
 
 <body>
 	<div class="container">
+		<header>{{payment_name}}</header>
 		<h1>Press the button below to continue.</h1>
 		<p>Your transaction ID is: {{transaction_id}}</p>
+		<p>Order ID: {{order_id}}</p>
+		<p>Amount: IDR {{gross_amount}}</p>
+		<p>Status: {{transaction_status}}</p>
 
-		<button id="confirmation-button" onclick="confirmButton('{{transaction_id}}')">Confirm</button>
+		<div id="confirmation-buttons" style="display: {{buttons_display}};" data-settle-redirect="{{settle_redirect}}" data-deny-redirect="{{deny_redirect}}" data-result="{{result}}">
+			<button onclick="confirmButton('{{transaction_id}}', 'settle')">Confirm</button>
+			<button class="secondary" onclick="confirmButton('{{transaction_id}}', 'deny')">Deny</button>
+			<button id="pay-later-button" class="secondary" style="display: none;" onclick="payLaterButton()">Pay later</button>
+		</div>
 		<p id="begone-text" style="display: none;">You're done. Now, begone!</p>
 	</div>
 </body>
 
 </html>`
 
+// simulatorBrand is how the simulator page looks like for a payment type,
+// so that testers can tell which bank they are paying with.
+type simulatorBrand struct {
+	Name  string
+	Color string
+}
+
+var defaultSimulatorBrand = simulatorBrand{Name: "Mocktrans", Color: "var(--color-blue-700)"}
+
+// redirectSimulatorBrand returns the brand of payment types that redirect the
+// customer to a third party page, and false for every other payment type.
+func redirectSimulatorBrand(paymentType string) (simulatorBrand, bool) {
+	if brand, ok := directDebitBanks[paymentType]; ok {
+		return brand, true
+	}
+
+	if brand, ok := cardlessCreditProviders[paymentType]; ok {
+		return brand, true
+	}
+
+	return defaultSimulatorBrand, false
+}
+
+// simulatorUrl returns the URL of the page where the tester completes the payment.
+func (d *Dependencies) simulatorUrl(transactionId string) string {
+	return d.PublicUrl + "/?i=" + url.QueryEscape(transactionId)
+}
+
 func (d *Dependencies) UserConfirmation(w http.ResponseWriter, r *http.Request) {
 	transactionId := r.URL.Query().Get("i")
 	if transactionId == "" {
@@ -271,11 +366,64 @@ func (d *Dependencies) UserConfirmation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	transaction, err := d.Storage.getTransaction(r.Context(), transactionId)
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	brand, _ := redirectSimulatorBrand(transaction.PaymentType)
+
+	buttonsDisplay := "none"
+	if transaction.TransactionStatus == TransactionStatusPending {
+		buttonsDisplay = "block"
+	}
+
+	// Transactions created through Snap go back to the merchant once they are done
+	var settleRedirect, denyRedirect string
+	snapTransaction, err := d.Storage.getSnapTransaction(r.Context(), transaction.Id)
+	if err != nil && !errors.Is(err, ErrSnapTransactionNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		settleRedirect = snapRedirectUrl(d.snapFinishUrl(snapTransaction), transaction.OrderId, "200", TransactionStatusSettlement)
+		denyRedirect = snapRedirectUrl(d.snapErrorUrl(snapTransaction), transaction.OrderId, "202", TransactionStatusDeny)
+	}
+
+	result, err := d.snapResult(r.Context(), transaction)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Render the template
-	html := strings.ReplaceAll(confirmationTemplate, "{{transaction_id}}", transactionId)
+	replacer := strings.NewReplacer(
+		"{{transaction_id}}", html.EscapeString(transaction.Id),
+		"{{order_id}}", html.EscapeString(transaction.OrderId),
+		"{{gross_amount}}", transaction.FormattedGrossAmount(),
+		"{{transaction_status}}", string(transaction.TransactionStatus),
+		"{{payment_name}}", html.EscapeString(brand.Name),
+		"{{brand_color}}", brand.Color,
+		"{{buttons_display}}", buttonsDisplay,
+		"{{settle_redirect}}", html.EscapeString(settleRedirect),
+		"{{deny_redirect}}", html.EscapeString(denyRedirect),
+		"{{result}}", html.EscapeString(string(resultJson)),
+	)
 
 	// Write the template to the response
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(replacer.Replace(confirmationTemplate)))
 }
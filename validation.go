@@ -0,0 +1,462 @@
+package mocktrans
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// chargeRule validates one part of a charge request, and returns a validation
+// message for every problem that it finds.
+type chargeRule struct {
+	// PaymentTypes limits the rule to some payment types, it applies to every payment type if empty.
+	PaymentTypes []string
+	Check        func(c chargeRequest) []string
+}
+
+func (r chargeRule) appliesTo(paymentType string) bool {
+	if len(r.PaymentTypes) == 0 {
+		return true
+	}
+
+	for _, p := range r.PaymentTypes {
+		if p == paymentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	orderIdRegexp  = regexp.MustCompile(`^[A-Za-z0-9\-_~.]*$`)
+	phoneRegexp    = regexp.MustCompile(`^\+?[0-9]{5,19}$`)
+	vaNumberRegexp = regexp.MustCompile(`^[0-9]*$`)
+)
+
+const customExpiryOrderTimeLayout = "2006-01-02 15:04:05 -0700"
+
+// maximumGrossAmounts are the highest amounts that a single transaction can have, per payment type.
+var maximumGrossAmounts = map[string]int64{
+	"cstore": 5000000,
+	"qris":   10000000,
+}
+
+// chargeRules are the rules of the Core API charge request, as documented by Midtrans.
+var chargeRules = []chargeRule{
+	{Check: oneOf("payment_type", paymentTypes, func(c chargeRequest) string { return c.PaymentType })},
+
+	// Transaction details
+	{Check: required("transaction_details.order_id", chargeOrderId)},
+	{Check: maxLength("transaction_details.order_id", 50, chargeOrderId)},
+	{Check: matches("transaction_details.order_id", orderIdRegexp, "must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)", chargeOrderId)},
+	{Check: grossAmountBounds},
+	{Check: func(c chargeRequest) []string {
+		return optional(validateItemDetails(c.TransactionDetails.GrossAmount, c.ItemDetails))
+	}},
+
+	// Item details
+	{Check: eachItem(func(field string, item ItemDetail) []string {
+		var messages []string
+		if item.Name == "" {
+			messages = append(messages, field+"name is required")
+		}
+
+		if len(item.Name) > 50 {
+			messages = append(messages, field+"name must not exceed 50 characters")
+		}
+
+		if len(item.ID) > 50 {
+			messages = append(messages, field+"id must not exceed 50 characters")
+		}
+
+		if item.Quantity < 1 {
+			messages = append(messages, field+"quantity must be at least 1")
+		}
+
+		return messages
+	})},
+
+	// Customer details
+	{Check: maxLength("customer_details.first_name", 255, func(c chargeRequest) string { return c.CustomerDetails.FirstName })},
+	{Check: maxLength("customer_details.last_name", 255, func(c chargeRequest) string { return c.CustomerDetails.LastName })},
+	{Check: maxLength("customer_details.email", 255, func(c chargeRequest) string { return c.CustomerDetails.Email })},
+	{Check: emailAddress("customer_details.email", func(c chargeRequest) string { return c.CustomerDetails.Email })},
+	{Check: matches("customer_details.phone", phoneRegexp, "must be a phone number of 5 to 19 digits", func(c chargeRequest) string { return c.CustomerDetails.Phone })},
+	{Check: addressRules("customer_details.billing_address", func(c chargeRequest) CustomerAddress { return c.CustomerDetails.BillingAddress })},
+	{Check: addressRules("customer_details.shipping_address", func(c chargeRequest) CustomerAddress { return c.CustomerDetails.ShippingAddress })},
+
+	// Custom expiry
+	{Check: customExpiry},
+
+	// Payment type specific
+	{PaymentTypes: []string{"credit_card"}, Check: required("credit_card.token_id", func(c chargeRequest) string { return c.CreditCard.TokenId })},
+	{PaymentTypes: []string{"bank_transfer"}, Check: oneOf("bank_transfer.bank", []string{"bca", "bni", "bri", "permata", "cimb"}, func(c chargeRequest) string { return c.BankTransfer.Bank })},
+	{PaymentTypes: []string{"bank_transfer"}, Check: matches("bank_transfer.va_number", vaNumberRegexp, "must only contain digits", func(c chargeRequest) string { return c.BankTransfer.VaNumber })},
+	{PaymentTypes: []string{"bank_transfer"}, Check: bcaCustomerName},
+	{PaymentTypes: []string{"echannel"}, Check: required("echannel.bill_info1", func(c chargeRequest) string { return c.Echannel.BillInfo1 })},
+	{PaymentTypes: []string{"echannel"}, Check: maxLength("echannel.bill_info1", 10, func(c chargeRequest) string { return c.Echannel.BillInfo1 })},
+	{PaymentTypes: []string{"echannel"}, Check: required("echannel.bill_info2", func(c chargeRequest) string { return c.Echannel.BillInfo2 })},
+	{PaymentTypes: []string{"echannel"}, Check: maxLength("echannel.bill_info2", 30, func(c chargeRequest) string { return c.Echannel.BillInfo2 })},
+	{PaymentTypes: []string{"cstore"}, Check: oneOf("cstore.store", []string{"alfamart", "indomaret"}, func(c chargeRequest) string { return c.Cstore.Store })},
+	{PaymentTypes: []string{"cstore"}, Check: alfamartText},
+	{PaymentTypes: []string{"akulaku", "kredivo"}, Check: func(c chargeRequest) []string {
+		if len(c.ItemDetails) == 0 {
+			return []string{"item_details is required for " + c.PaymentType + " payment type"}
+		}
+		return nil
+	}},
+	{PaymentTypes: []string{"bca_klikbca"}, Check: required("bca_klikbca.user_id", func(c chargeRequest) string { return c.BcaKlikbca.UserId })},
+	{PaymentTypes: []string{"bca_klikbca"}, Check: maxLength("bca_klikbca.user_id", 12, func(c chargeRequest) string { return c.BcaKlikbca.UserId })},
+	{PaymentTypes: []string{"bca_klikbca"}, Check: required("bca_klikbca.description", func(c chargeRequest) string { return c.BcaKlikbca.Description })},
+	{PaymentTypes: []string{"cimb_clicks"}, Check: required("cimb_clicks.description", func(c chargeRequest) string { return c.CimbClicks.Description })},
+	{PaymentTypes: []string{"uob_ezpay"}, Check: required("uob_ezpay.callback_url", func(c chargeRequest) string { return c.UobEzpay.CallbackUrl })},
+	{PaymentTypes: []string{"uob_ezpay"}, Check: webUrl("uob_ezpay.callback_url", func(c chargeRequest) string { return c.UobEzpay.CallbackUrl })},
+	{PaymentTypes: []string{"bri_epay"}, Check: webUrl("bri_epay.callback_url", func(c chargeRequest) string { return c.BriEpay.CallbackUrl })},
+	{PaymentTypes: []string{"danamon_online"}, Check: webUrl("danamon_online.callback_url", func(c chargeRequest) string { return c.DanamonOnline.CallbackUrl })},
+	{PaymentTypes: []string{"bca_klikpay"}, Check: required("bca_klikpay.description", func(c chargeRequest) string { return c.BcaKlikpay.Description })},
+	{PaymentTypes: []string{"bca_klikpay"}, Check: func(c chargeRequest) []string {
+		if c.BcaKlikpay.Type != 1 {
+			return []string{"bca_klikpay.type must be 1"}
+		}
+		return nil
+	}},
+	{PaymentTypes: []string{"bca_klikpay"}, Check: eachItem(func(field string, item ItemDetail) []string {
+		var messages []string
+		if item.Tenor == "" {
+			messages = append(messages, field+"tenor is required")
+		} else if len(item.Tenor) != 2 || !vaNumberRegexp.MatchString(item.Tenor) {
+			messages = append(messages, field+"tenor must be 2 digits")
+		}
+
+		if item.CodePlan == "" {
+			messages = append(messages, field+"code_plan is required")
+		}
+
+		if item.MID == "" {
+			messages = append(messages, field+"mid is required")
+		}
+
+		return messages
+	})},
+	{PaymentTypes: []string{"gopay"}, Check: func(c chargeRequest) []string {
+		var messages []string
+		if c.Gopay.PaymentOptionToken != "" && c.Gopay.AccountId == "" {
+			messages = append(messages, "gopay.account_id is required when gopay.payment_option_token is provided")
+		}
+
+		if c.Gopay.Recurring && c.Gopay.PaymentOptionToken == "" {
+			messages = append(messages, "gopay.payment_option_token is required for recurring charges")
+		}
+
+		return messages
+	}},
+}
+
+func chargeOrderId(c chargeRequest) string {
+	return c.TransactionDetails.OrderId
+}
+
+func optional(message string) []string {
+	if message == "" {
+		return nil
+	}
+
+	return []string{message}
+}
+
+func required(field string, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		if value(c) == "" {
+			return []string{field + " is required"}
+		}
+
+		return nil
+	}
+}
+
+func maxLength(field string, max int, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		if len(value(c)) > max {
+			return []string{fmt.Sprintf("%s must not exceed %d characters", field, max)}
+		}
+
+		return nil
+	}
+}
+
+func oneOf(field string, options []string, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		v := value(c)
+		for _, option := range options {
+			if v == option {
+				return nil
+			}
+		}
+
+		if v == "" {
+			return []string{field + " is required"}
+		}
+
+		return []string{fmt.Sprintf("%s must be one of %s", field, strings.Join(options, ", "))}
+	}
+}
+
+// matches checks the value against the pattern, unless it is empty.
+func matches(field string, pattern *regexp.Regexp, description string, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		v := value(c)
+		if v != "" && !pattern.MatchString(v) {
+			return []string{field + " " + description}
+		}
+
+		return nil
+	}
+}
+
+// emailAddress checks that the value is an email address, unless it is empty.
+func emailAddress(field string, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		v := value(c)
+		if v == "" {
+			return nil
+		}
+
+		parsed, err := mail.ParseAddress(v)
+		if err != nil || parsed.Address != v {
+			return []string{field + " must be a valid email address"}
+		}
+
+		return nil
+	}
+}
+
+// webUrl checks that the value is an absolute http or https URL, unless it is empty.
+func webUrl(field string, value func(c chargeRequest) string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		v := value(c)
+		if v == "" {
+			return nil
+		}
+
+		parsed, err := url.Parse(v)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return []string{field + " must be a valid http or https URL"}
+		}
+
+		return nil
+	}
+}
+
+func addressRules(field string, value func(c chargeRequest) CustomerAddress) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		a := value(c)
+
+		var messages []string
+		if len(a.Address) > 255 {
+			messages = append(messages, field+".address must not exceed 255 characters")
+		}
+
+		if len(a.City) > 255 {
+			messages = append(messages, field+".city must not exceed 255 characters")
+		}
+
+		if len(a.PostalCode) > 10 {
+			messages = append(messages, field+".postal_code must not exceed 10 characters")
+		}
+
+		if len(a.CountryCode) > 3 {
+			messages = append(messages, field+".country_code must not exceed 3 characters")
+		}
+
+		if a.Phone != "" && !phoneRegexp.MatchString(a.Phone) {
+			messages = append(messages, field+".phone must be a phone number of 5 to 19 digits")
+		}
+
+		return messages
+	}
+}
+
+// eachItem runs the check on every item detail, with the field prefix of the item.
+func eachItem(check func(field string, item ItemDetail) []string) func(c chargeRequest) []string {
+	return func(c chargeRequest) []string {
+		var messages []string
+		for i, item := range c.ItemDetails {
+			messages = append(messages, check(fmt.Sprintf("item_details[%d].", i), item)...)
+		}
+
+		return messages
+	}
+}
+
+func grossAmountBounds(c chargeRequest) []string {
+	if c.TransactionDetails.GrossAmount < 1 {
+		return []string{"transaction_details.gross_amount must be greater than or equal to 1"}
+	}
+
+	if maximum, ok := maximumGrossAmounts[c.PaymentType]; ok && c.TransactionDetails.GrossAmount > maximum {
+		return []string{fmt.Sprintf("transaction_details.gross_amount must not exceed %d for %s payment type", maximum, c.PaymentType)}
+	}
+
+	return nil
+}
+
+func customExpiry(c chargeRequest) []string {
+	e := c.CustomExpiry
+	if e.ExpiryDuration == 0 && e.Unit == "" && e.OrderTime == "" {
+		return nil
+	}
+
+	var messages []string
+	if e.ExpiryDuration <= 0 {
+		messages = append(messages, "custom_expiry.expiry_duration must be greater than 0")
+	}
+
+	switch e.Unit {
+	case "", "second", "minute", "hour", "day":
+		break
+	default:
+		messages = append(messages, "custom_expiry.unit must be one of second, minute, hour or day")
+	}
+
+	if e.OrderTime != "" {
+		if _, err := time.Parse(customExpiryOrderTimeLayout, e.OrderTime); err != nil {
+			messages = append(messages, "custom_expiry.order_time must be formatted as yyyy-MM-dd HH:mm:ss Z")
+		}
+	}
+
+	return messages
+}
+
+// bcaCustomerName checks the customer name that is shown on BCA virtual accounts.
+func bcaCustomerName(c chargeRequest) []string {
+	if c.BankTransfer.Bank != "bca" {
+		return nil
+	}
+
+	if len(strings.TrimSpace(c.CustomerDetails.FirstName+" "+c.CustomerDetails.LastName)) > 30 {
+		return []string{"customer_details.first_name and customer_details.last_name must not exceed 30 characters combined for BCA virtual account"}
+	}
+
+	return nil
+}
+
+// alfamartText checks the texts that are printed on Alfamart receipts,
+// which can not contain a vertical line.
+func alfamartText(c chargeRequest) []string {
+	if c.Cstore.Store != "alfamart" {
+		return nil
+	}
+
+	texts := []struct {
+		field string
+		value string
+		max   int
+	}{
+		{"cstore.message", c.Cstore.Message, 20},
+		{"cstore.alfamart_free_text_1", c.Cstore.AlfamartFreeText1, 40},
+		{"cstore.alfamart_free_text_2", c.Cstore.AlfamartFreeText2, 40},
+		{"cstore.alfamart_free_text_3", c.Cstore.AlfamartFreeText3, 40},
+		{"customer_details.first_name", c.CustomerDetails.FirstName, 0},
+		{"customer_details.last_name", c.CustomerDetails.LastName, 0},
+	}
+	for i, item := range c.ItemDetails {
+		texts = append(texts, struct {
+			field string
+			value string
+			max   int
+		}{fmt.Sprintf("item_details[%d].name", i), item.Name, 0})
+	}
+
+	var messages []string
+	for _, text := range texts {
+		if strings.Contains(text.value, "|") {
+			messages = append(messages, text.field+" must not contain a vertical line (|) for Alfamart")
+		}
+
+		if text.max > 0 && len(text.value) > text.max {
+			messages = append(messages, fmt.Sprintf("%s must not exceed %d characters", text.field, text.max))
+		}
+	}
+
+	return messages
+}
+
+// unknownFieldError is the error of a request body with a field that Midtrans does not
+// know about, which is only an error in strict mode.
+type unknownFieldError struct {
+	err error
+}
+
+func (e *unknownFieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unknownFieldError) Unwrap() error {
+	return e.err
+}
+
+// decodeRequestBody decodes the JSON request body into v. In strict mode,
+// fields that v does not have are rejected instead of being ignored.
+func (d *Dependencies) decodeRequestBody(r *http.Request, v any) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(v)
+	if err != nil || !d.StrictMode {
+		return err
+	}
+
+	// The body decodes once unknown fields are ignored, so they are all that is left to fail on
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(reflect.New(reflect.TypeOf(v).Elem()).Interface())
+	if err != nil {
+		return &unknownFieldError{err: err}
+	}
+
+	return nil
+}
+
+// decodeErrorStatus picks the Midtrans error status of a request body that
+// could not be decoded: a value of the wrong type or, in strict mode, an unknown
+// field is a wrong data type, anything else is a syntax error.
+func decodeErrorStatus(err error) (ErrorStatusCode, string) {
+	if message, ok := decodeValidationMessage(err); ok {
+		return ErrorValidation, message
+	}
+
+	var typeError *json.UnmarshalTypeError
+	var unknownField *unknownFieldError
+	if errors.As(err, &typeError) || errors.As(err, &unknownField) {
+		return ErrorWrongDataType, err.Error()
+	}
+
+	return ErrorSyntaxInBody, err.Error()
+}
+
+// decodeValidationMessage turns a decoding error that is caused by a fractional
+// amount into a validation message, as amounts in IDR must be integers.
+func decodeValidationMessage(err error) (string, bool) {
+	var typeError *json.UnmarshalTypeError
+	if !errors.As(err, &typeError) {
+		return "", false
+	}
+
+	if typeError.Type.Kind() != reflect.Int64 || !strings.HasPrefix(typeError.Value, "number") {
+		return "", false
+	}
+
+	return typeError.Field + " must be an integer", true
+}
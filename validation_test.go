@@ -0,0 +1,447 @@
+package mocktrans
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChargeRules(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// message is one of the validation messages of the request, empty when it is valid.
+		message string
+	}{
+		// Payment type
+		{
+			name:    "known payment type",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "",
+		},
+		{
+			name:    "unknown payment type",
+			body:    `{"payment_type": "bitcoin", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "payment_type must be one of " + strings.Join(paymentTypes, ", "),
+		},
+		{
+			name:    "missing payment type",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "payment_type is required",
+		},
+
+		// Gross amount
+		{
+			name:    "gross amount of 1",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 1}}`,
+			message: "",
+		},
+		{
+			name:    "gross amount of 0",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 0}}`,
+			message: "transaction_details.gross_amount must be greater than or equal to 1",
+		},
+		{
+			name:    "negative gross amount",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": -500}}`,
+			message: "transaction_details.gross_amount must be greater than or equal to 1",
+		},
+		{
+			name:    "cstore gross amount at its maximum",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 5000000}, "cstore": {"store": "indomaret"}}`,
+			message: "",
+		},
+		{
+			name:    "cstore gross amount over its maximum",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 5000001}, "cstore": {"store": "indomaret"}}`,
+			message: "transaction_details.gross_amount must not exceed 5000000 for cstore payment type",
+		},
+		{
+			name:    "qris gross amount over its maximum",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000001}}`,
+			message: "transaction_details.gross_amount must not exceed 10000000 for qris payment type",
+		},
+		{
+			name:    "gross amount that is not the total of the items",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "item_details": [{"name": "Shoes", "price": 4000, "quantity": 2}]}`,
+			message: "gross_amount must be equal to Item Details total amount",
+		},
+
+		// Order ID
+		{
+			name:    "order id with allowed symbols",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1_a~b.c", "gross_amount": 10000}}`,
+			message: "",
+		},
+		{
+			name:    "order id with other symbols",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order#1", "gross_amount": 10000}}`,
+			message: "transaction_details.order_id must not contain any other symbols other than dash(-), underscore(_), tilde (~), and dot (.)",
+		},
+		{
+			name:    "order id over 50 characters",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "` + strings.Repeat("a", 51) + `", "gross_amount": 10000}}`,
+			message: "transaction_details.order_id must not exceed 50 characters",
+		},
+
+		// Item details
+		{
+			name:    "item name of 50 characters",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "item_details": [{"name": "` + strings.Repeat("a", 50) + `", "price": 10000, "quantity": 1}]}`,
+			message: "",
+		},
+		{
+			name:    "item name over 50 characters",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "item_details": [{"name": "` + strings.Repeat("a", 51) + `", "price": 10000, "quantity": 1}]}`,
+			message: "item_details[0].name must not exceed 50 characters",
+		},
+		{
+			name:    "item without a name",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "item_details": [{"price": 10000, "quantity": 1}]}`,
+			message: "item_details[0].name is required",
+		},
+		{
+			name:    "item without a quantity",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 0}, "item_details": [{"name": "Shoes", "price": 10000}]}`,
+			message: "item_details[0].quantity must be at least 1",
+		},
+
+		// BCA virtual account customer name
+		{
+			name:    "BCA customer name of 30 characters",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bank_transfer": {"bank": "bca"}, "customer_details": {"first_name": "` + strings.Repeat("a", 15) + `", "last_name": "` + strings.Repeat("b", 14) + `"}}`,
+			message: "",
+		},
+		{
+			name:    "BCA customer name over 30 characters",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bank_transfer": {"bank": "bca"}, "customer_details": {"first_name": "` + strings.Repeat("a", 16) + `", "last_name": "` + strings.Repeat("b", 14) + `"}}`,
+			message: "customer_details.first_name and customer_details.last_name must not exceed 30 characters combined for BCA virtual account",
+		},
+		{
+			name:    "long customer name on another bank",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bank_transfer": {"bank": "bni"}, "customer_details": {"first_name": "` + strings.Repeat("a", 40) + `"}}`,
+			message: "",
+		},
+
+		// Email and phone
+		{
+			name:    "valid email and phone",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"email": "budi@example.com", "phone": "+628123456789"}}`,
+			message: "",
+		},
+		{
+			name:    "invalid email",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"email": "budi.example.com"}}`,
+			message: "customer_details.email must be a valid email address",
+		},
+		{
+			name:    "email with a display name",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"email": "Budi <budi@example.com>"}}`,
+			message: "customer_details.email must be a valid email address",
+		},
+		{
+			name:    "phone with letters",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"phone": "0812-CALL-ME"}}`,
+			message: "customer_details.phone must be a phone number of 5 to 19 digits",
+		},
+		{
+			name:    "phone that is too short",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"phone": "0812"}}`,
+			message: "customer_details.phone must be a phone number of 5 to 19 digits",
+		},
+		{
+			name:    "billing address phone with letters",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "customer_details": {"billing_address": {"phone": "call me"}}}`,
+			message: "customer_details.billing_address.phone must be a phone number of 5 to 19 digits",
+		},
+
+		// Custom expiry
+		{
+			name:    "custom expiry in hours",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "custom_expiry": {"expiry_duration": 2, "unit": "hour", "order_time": "2024-03-01 10:15:00 +0700"}}`,
+			message: "",
+		},
+		{
+			name:    "custom expiry in weeks",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "custom_expiry": {"expiry_duration": 2, "unit": "week"}}`,
+			message: "custom_expiry.unit must be one of second, minute, hour or day",
+		},
+		{
+			name:    "custom expiry without a duration",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "custom_expiry": {"unit": "day"}}`,
+			message: "custom_expiry.expiry_duration must be greater than 0",
+		},
+		{
+			name:    "custom expiry with an order time without a zone",
+			body:    `{"payment_type": "qris", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "custom_expiry": {"expiry_duration": 2, "unit": "day", "order_time": "2024-03-01 10:15:00"}}`,
+			message: "custom_expiry.order_time must be formatted as yyyy-MM-dd HH:mm:ss Z",
+		},
+
+		// Payment type specific objects
+		{
+			name:    "credit card with a token",
+			body:    `{"payment_type": "credit_card", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "credit_card": {"token_id": "481111-1114-abc"}}`,
+			message: "",
+		},
+		{
+			name:    "credit card without a token",
+			body:    `{"payment_type": "credit_card", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "credit_card.token_id is required",
+		},
+		{
+			name:    "bank transfer without a bank",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "bank_transfer.bank is required",
+		},
+		{
+			name:    "bank transfer to an unknown bank",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bank_transfer": {"bank": "hsbc"}}`,
+			message: "bank_transfer.bank must be one of bca, bni, bri, permata, cimb",
+		},
+		{
+			name:    "bank transfer with a virtual account number that is not digits",
+			body:    `{"payment_type": "bank_transfer", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bank_transfer": {"bank": "bni", "va_number": "12ab"}}`,
+			message: "bank_transfer.va_number must only contain digits",
+		},
+		{
+			name:    "echannel with bill info",
+			body:    `{"payment_type": "echannel", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "echannel": {"bill_info1": "Payment:", "bill_info2": "Online purchase"}}`,
+			message: "",
+		},
+		{
+			name:    "echannel without bill info",
+			body:    `{"payment_type": "echannel", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "echannel.bill_info1 is required",
+		},
+		{
+			name:    "cstore without a store",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "cstore.store is required",
+		},
+		{
+			name:    "akulaku without items",
+			body:    `{"payment_type": "akulaku", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "item_details is required for akulaku payment type",
+		},
+		{
+			name:    "kredivo with items",
+			body:    `{"payment_type": "kredivo", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "item_details": [{"name": "Shoes", "price": 10000, "quantity": 1}]}`,
+			message: "",
+		},
+		{
+			name:    "BCA KlikBCA without a user id",
+			body:    `{"payment_type": "bca_klikbca", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bca_klikbca": {"description": "Shoes"}}`,
+			message: "bca_klikbca.user_id is required",
+		},
+		{
+			name:    "CIMB Clicks without a description",
+			body:    `{"payment_type": "cimb_clicks", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}}`,
+			message: "cimb_clicks.description is required",
+		},
+		{
+			name:    "BCA KlikPay of another type",
+			body:    `{"payment_type": "bca_klikpay", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "bca_klikpay": {"type": 2, "description": "Shoes"}}`,
+			message: "bca_klikpay.type must be 1",
+		},
+		{
+			name:    "recurring GoPay without a token",
+			body:    `{"payment_type": "gopay", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "gopay": {"recurring": true}}`,
+			message: "gopay.payment_option_token is required for recurring charges",
+		},
+
+		// Alfamart
+		{
+			name:    "Alfamart texts without a vertical line",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "cstore": {"store": "alfamart", "message": "Thank you", "alfamart_free_text_1": "Come again"}}`,
+			message: "",
+		},
+		{
+			name:    "Alfamart message with a vertical line",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "cstore": {"store": "alfamart", "message": "Thank|you"}}`,
+			message: "cstore.message must not contain a vertical line (|) for Alfamart",
+		},
+		{
+			name:    "Alfamart item name with a vertical line",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "cstore": {"store": "alfamart"}, "item_details": [{"name": "Shoes|Red", "price": 10000, "quantity": 1}]}`,
+			message: "item_details[0].name must not contain a vertical line (|) for Alfamart",
+		},
+		{
+			name:    "Alfamart free text over 40 characters",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "cstore": {"store": "alfamart", "alfamart_free_text_2": "` + strings.Repeat("a", 41) + `"}}`,
+			message: "cstore.alfamart_free_text_2 must not exceed 40 characters",
+		},
+		{
+			name:    "Indomaret message with a vertical line",
+			body:    `{"payment_type": "cstore", "transaction_details": {"order_id": "order-1", "gross_amount": 10000}, "cstore": {"store": "indomaret", "message": "Thank|you"}}`,
+			message: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c chargeRequest
+			err := json.Unmarshal([]byte(test.body), &c)
+			if err != nil {
+				t.Fatalf("failed to decode request: %v", err)
+			}
+
+			status, messages := c.Validate()
+			if test.message == "" {
+				if status != 0 || len(messages) > 0 {
+					t.Errorf("expected a valid request, got %v: %q", status, messages)
+				}
+				return
+			}
+
+			if status != ErrorValidation {
+				t.Errorf("expected status %v, got %v", ErrorValidation, status)
+			}
+
+			for _, message := range messages {
+				if message == test.message {
+					return
+				}
+			}
+			t.Errorf("expected validation message %q, got %q", test.message, messages)
+		})
+	}
+}
+
+func TestDecodeErrorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  ErrorStatusCode
+		message string
+	}{
+		{
+			name:    "fractional gross amount",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000.5}}`,
+			status:  ErrorValidation,
+			message: "transaction_details.gross_amount must be an integer",
+		},
+		{
+			name:    "gross amount as a string",
+			body:    `{"transaction_details": {"order_id": "order-1", "gross_amount": "10000"}}`,
+			status:  ErrorWrongDataType,
+			message: "",
+		},
+		{
+			name:    "broken JSON",
+			body:    `{"transaction_details": `,
+			status:  ErrorSyntaxInBody,
+			message: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c chargeRequest
+			err := json.Unmarshal([]byte(test.body), &c)
+			if err == nil {
+				t.Fatal("expected a decoding error")
+			}
+
+			status, message := decodeErrorStatus(err)
+			if status != test.status {
+				t.Errorf("expected status %v, got %v", test.status, status)
+			}
+
+			if test.message != "" && message != test.message {
+				t.Errorf("expected message %q, got %q", test.message, message)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestBodyStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		body   string
+		// status is the error status of the body, zero when it decodes.
+		status ErrorStatusCode
+	}{
+		{
+			name:   "documented credit card fields",
+			strict: true,
+			body:   `{"payment_type": "credit_card", "credit_card": {"token_id": "481111-1114-abc", "authentication": true, "callback_type": "js_event"}}`,
+		},
+		{
+			name:   "documented gopay fields",
+			strict: true,
+			body:   `{"payment_type": "gopay", "gopay": {"enable_callback": true, "pre_auth": false, "promotion_ids": ["promo-1"]}}`,
+		},
+		{
+			name:   "unknown field",
+			strict: true,
+			body:   `{"payment_type": "gopay", "transaction_detail": {"order_id": "order-1"}}`,
+			status: ErrorWrongDataType,
+		},
+		{
+			name:   "payment_link_id is set by Mocktrans only",
+			strict: true,
+			body:   `{"transaction_details": {"order_id": "order-1", "gross_amount": 10000, "payment_link_id": "link-1"}}`,
+			status: ErrorWrongDataType,
+		},
+		{
+			name:   "unknown field outside strict mode",
+			strict: false,
+			body:   `{"payment_type": "gopay", "transaction_detail": {"order_id": "order-1"}}`,
+		},
+		{
+			name:   "wrong data type in strict mode",
+			strict: true,
+			body:   `{"transaction_details": {"order_id": "order-1", "gross_amount": "10000"}}`,
+			status: ErrorWrongDataType,
+		},
+		{
+			name:   "broken JSON in strict mode",
+			strict: true,
+			body:   `{"payment_type": `,
+			status: ErrorSyntaxInBody,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &Dependencies{StrictMode: test.strict}
+			r := httptest.NewRequest(http.MethodPost, "/v2/charge", strings.NewReader(test.body))
+
+			var c chargeRequest
+			err := d.decodeRequestBody(r, &c)
+			if test.status == 0 {
+				if err != nil {
+					t.Fatalf("expected the body to decode, got %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected a decoding error")
+			}
+
+			status, _ := decodeErrorStatus(err)
+			if status != test.status {
+				t.Errorf("expected status %v, got %v", test.status, status)
+			}
+		})
+	}
+
+	d := &Dependencies{StrictMode: true}
+	r := httptest.NewRequest(http.MethodPost, "/snap/v1/transactions", strings.NewReader(`{
+		"transaction_details": {"order_id": "order-1", "gross_amount": 10000},
+		"credit_card": {"secure": true, "installment": {"required": false, "terms": {"bni": [3, 6]}}},
+		"bca_va": {"va_number": "12345678"},
+		"expiry": {"start_time": "2024-03-01 10:00:00 +0700", "unit": "minutes", "duration": 60},
+		"custom_field1": "tenant-1"
+	}`))
+
+	var s snapRequest
+	err := d.decodeRequestBody(r, &s)
+	if err != nil {
+		t.Errorf("expected the documented Snap fields to decode in strict mode, got %v", err)
+	}
+}
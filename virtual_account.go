@@ -0,0 +1,178 @@
+package mocktrans
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"time"
+)
+
+// VirtualAccount is the account number that the customer transfers to, to pay a bank_transfer transaction.
+type VirtualAccount struct {
+	Id            string
+	TransactionId string
+	VaNumber      string
+	Bank          string
+	CreatedAt     time.Time
+}
+
+// virtualAccountNumber returns the va_number that the merchant asked for, or
+// derives one out of the transaction id, so that every transaction gets its own.
+func virtualAccountNumber(req chargeRequest, transactionId string) string {
+	if req.BankTransfer.VaNumber != "" {
+		return req.BankTransfer.VaNumber
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(transactionId))
+	return fmt.Sprintf("%011d", hash.Sum64()%100000000000)
+}
+
+func (s *sqlStorage) insertVirtualAccount(ctx context.Context, virtualAccount VirtualAccount) error {
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	err = s.insertVirtualAccountTx(ctx, tx, virtualAccount)
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if e := tx.Rollback(); e != nil && !errors.Is(e, sql.ErrTxDone) {
+			return fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return nil
+}
+
+// insertVirtualAccountTx inserts the virtual account within a database transaction,
+// such as the one that inserts the transaction that it belongs to.
+func (s *sqlStorage) insertVirtualAccountTx(ctx context.Context, tx *sql.Tx, virtualAccount VirtualAccount) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
+		transaction_virtual_account
+		(
+			id,
+			transaction_id,
+			va_number,
+			bank,
+			created_at
+		)
+	VALUES
+		($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return fmt.Errorf("failed to format query: %w", err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		formattedQuery,
+		virtualAccount.Id,
+		virtualAccount.TransactionId,
+		virtualAccount.VaNumber,
+		virtualAccount.Bank,
+		virtualAccount.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert virtual account: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStorage) listVirtualAccounts(ctx context.Context, transactionId string) ([]VirtualAccount, error) {
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		id,
+		transaction_id,
+		va_number,
+		bank,
+		created_at
+	FROM
+		transaction_virtual_account
+	WHERE
+		transaction_id = $1
+	ORDER BY
+		created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, transactionId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query virtual accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var virtualAccounts []VirtualAccount
+	for rows.Next() {
+		var virtualAccount VirtualAccount
+		err := rows.Scan(
+			&virtualAccount.Id,
+			&virtualAccount.TransactionId,
+			&virtualAccount.VaNumber,
+			&virtualAccount.Bank,
+			&virtualAccount.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan virtual account: %w", err)
+		}
+
+		virtualAccounts = append(virtualAccounts, virtualAccount)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate virtual accounts: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return virtualAccounts, nil
+}
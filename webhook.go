@@ -1,18 +1,144 @@
-package main
+package mocktrans
 
 import (
 	"bytes"
 	"context"
+	"crypto/sha512"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// Notify sends the HTTP notification of the transaction's current state to the callback URL.
+// It returns immediately, as the delivery retries might take hours. The notifications of a
+// transaction are sent one after the other, in the order that Notify was called.
+func (d *Dependencies) Notify(transaction Transaction) {
+	d.enqueueDelivery(transaction.Id, func() {
+		notification, err := d.transactionNotification(context.Background(), transaction)
+		if err != nil {
+			log.Printf("failed to build notification for transaction %s: %v", transaction.Id, err)
+			return
+		}
+
+		d.deliverNotification(transaction.Id, notification)
+	})
+}
+
+// deliveries are the notifications that wait for the ones before them of their transaction.
+// Every transaction with a queue has a goroutine that sends them, while the notifications
+// of different transactions are sent side by side.
+type deliveries struct {
+	mu     sync.Mutex
+	queues map[string][]func()
+}
+
+// enqueueDelivery runs deliver after everything that was enqueued for the transaction before it.
+func (d *Dependencies) enqueueDelivery(transactionId string, deliver func()) {
+	d.notifying.add(1)
+
+	d.deliveries.mu.Lock()
+	defer d.deliveries.mu.Unlock()
+
+	if d.deliveries.queues == nil {
+		d.deliveries.queues = make(map[string][]func())
+	}
+
+	queue, running := d.deliveries.queues[transactionId]
+	d.deliveries.queues[transactionId] = append(queue, deliver)
+	if !running {
+		go d.runDeliveries(transactionId)
+	}
+}
+
+func (d *Dependencies) runDeliveries(transactionId string) {
+	for {
+		d.deliveries.mu.Lock()
+		queue := d.deliveries.queues[transactionId]
+		if len(queue) == 0 {
+			delete(d.deliveries.queues, transactionId)
+			d.deliveries.mu.Unlock()
+			return
+		}
+		deliver := queue[0]
+		d.deliveries.queues[transactionId] = queue[1:]
+		d.deliveries.mu.Unlock()
+
+		deliver()
+		d.notifying.done()
+	}
+}
+
+// transactionNotification is notificationFromTransaction, along with the parts
+// of the transaction that are stored on their own.
+func (d *Dependencies) transactionNotification(ctx context.Context, t Transaction) (NotificationRequest, error) {
+	notification := d.notificationFromTransaction(t)
+	if t.PaymentType != "bank_transfer" {
+		return notification, nil
+	}
+
+	virtualAccounts, err := d.Storage.listVirtualAccounts(ctx, t.Id)
+	if err != nil {
+		return NotificationRequest{}, err
+	}
+
+	// Permata has its own field for the account number, the other banks use va_numbers
+	for _, virtualAccount := range virtualAccounts {
+		if virtualAccount.Bank == "permata" {
+			notification.PermataVaNumber = virtualAccount.VaNumber
+		} else {
+			notification.VaNumbers = append(notification.VaNumbers, VirtualAccountNumbers{VaNumber: virtualAccount.VaNumber, Bank: virtualAccount.Bank})
+		}
+	}
+
+	return notification, nil
+}
+
+func (d *Dependencies) notificationFromTransaction(t Transaction) NotificationRequest {
+	notification := NotificationRequest{
+		TransactionTime:   t.TransactionTime(),
+		TransactionStatus: string(t.TransactionStatus),
+		TransactionId:     t.Id,
+		StatusMessage:     "midtrans payment notification",
+		StatusCode:        t.StatusCode(),
+		PaymentType:       t.PaymentType,
+		OrderId:           t.OrderId,
+		MerchantId:        t.MerchantId,
+		GrossAmount:       t.FormattedGrossAmount(),
+		FraudStatus:       string(t.FraudStatus),
+		Currency:          "IDR",
+		PaymentLinkId:     t.PaymentLinkId,
+		Metadata:          t.Metadata,
+		CustomField1:      t.CustomField1,
+		CustomField2:      t.CustomField2,
+		CustomField3:      t.CustomField3,
+	}
+
+	if t.PaymentType == "credit_card" {
+		notification.MaskedCard = t.MaskedCard
+		notification.Bank = t.Bank
+		notification.CardType = "credit"
+		notification.Eci = "05"
+	}
+
+	notification.SignatureKey = d.merchant(t.MerchantId).signatureKey(notification.OrderId, notification.StatusCode, notification.GrossAmount)
+
+	return notification
+}
+
+// signatureKey computes the signature_key of a notification, which is
+// SHA512(order_id + status_code + gross_amount + server_key).
+func (m Merchant) signatureKey(orderId, statusCode, grossAmount string) string {
+	sum := sha512.Sum512([]byte(orderId + statusCode + grossAmount + m.ServerKey))
+	return hex.EncodeToString(sum[:])
+}
+
 var backoffSchedule = []time.Duration{time.Minute * 2, time.Minute * 10, time.Minute * 30, time.Minute * 90, time.Hour*3 + time.Minute*30}
 
 func (d *Dependencies) SendWebhook(transactionId string, content NotificationRequest) error {
@@ -23,15 +149,28 @@ func (d *Dependencies) SendWebhook(transactionId string, content NotificationReq
 		return fmt.Errorf("failed to marshal notification request: %w", err)
 	}
 
+	// Every merchant has its own notification URL
+	callbackUrl := d.merchant(content.MerchantId).CallbackUrl
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Hour*4)
 	defer cancel()
 
+	// Without a callback URL there is nowhere to send to, the notification is only kept in the history
+	if callbackUrl == "" {
+		return d.writeWebhookHistoryLog(ctx, false, content)
+	}
+
 	for _, backoff := range backoffSchedule {
 		httpCtx, httpCancel := context.WithTimeout(ctx, time.Minute*3)
 		defer httpCancel()
 
-		statusCode, err := d.sendHttpRequest(httpCtx, d.CallbackUrl, bytes.NewReader(jsonPayload))
+		statusCode, err := d.sendHttpRequest(httpCtx, callbackUrl, bytes.NewReader(jsonPayload))
 		if err != nil {
+			// Unreachable callback URLs are attempts too, the dashboard shows them
+			if e := d.writeWebhookHistoryLog(ctx, false, content); e != nil {
+				log.Printf("failed to write webhook history log: %v", e)
+			}
+
 			return fmt.Errorf("failed to send webhook: %w", err)
 		}
 
@@ -96,6 +235,7 @@ func (d *Dependencies) sendHttpRequest(ctx context.Context, url string, content
 	if err != nil {
 		return 0, fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 
 	return resp.StatusCode, nil
 }
@@ -106,7 +246,18 @@ func (d *Dependencies) writeWebhookHistoryLog(ctx context.Context, success bool,
 		return fmt.Errorf("failed to marshal notification request: %w", err)
 	}
 
-	formattedQuery, err := d.formatPlaceholder(`INSERT INTO
+	return d.Storage.insertWebhookAttempt(ctx, WebhookAttempt{
+		TransactionId: content.TransactionId,
+		EventType:     "notification",
+		Status:        string(content.TransactionStatus),
+		Data:          string(jsonPayload),
+		Success:       success,
+		CreatedAt:     d.Clock.Now(),
+	})
+}
+
+func (s *sqlStorage) insertWebhookAttempt(ctx context.Context, attempt WebhookAttempt) error {
+	formattedQuery, err := s.formatPlaceholder(`INSERT INTO
 		webhook_history
 		(
 			transaction_id,
@@ -122,7 +273,7 @@ func (d *Dependencies) writeWebhookHistoryLog(ctx context.Context, success bool,
 		return fmt.Errorf("failed to format query: %w", err)
 	}
 
-	conn, err := d.DB.Conn(ctx)
+	conn, err := s.DB.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
@@ -141,11 +292,12 @@ func (d *Dependencies) writeWebhookHistoryLog(ctx context.Context, success bool,
 	_, err = tx.ExecContext(
 		ctx,
 		formattedQuery,
-		content.TransactionId,
-		content.TransactionStatus,
-		jsonPayload,
-		success,
-		time.Now(),
+		attempt.TransactionId,
+		attempt.EventType,
+		attempt.Status,
+		attempt.Data,
+		attempt.Success,
+		attempt.CreatedAt,
 	)
 	if err != nil {
 		if e := tx.Rollback(); e != nil && !errors.Is(err, sql.ErrTxDone) {
@@ -170,3 +322,92 @@ func (d *Dependencies) writeWebhookHistoryLog(ctx context.Context, success bool,
 	}
 	return nil
 }
+
+// WebhookAttempt is one delivery attempt of a notification, as kept in the webhook history.
+type WebhookAttempt struct {
+	TransactionId string
+	EventType     string
+	Status        string
+	Data          string
+	Success       bool
+	CreatedAt     time.Time
+}
+
+// listWebhookAttempts lists the delivery attempts of the transaction's notifications, oldest first.
+// An empty transactionId lists the attempts of every transaction.
+func (s *sqlStorage) listWebhookAttempts(ctx context.Context, transactionId string) ([]WebhookAttempt, error) {
+	var where string
+	var args []any
+	if transactionId != "" {
+		where = "WHERE\n\t\ttransaction_id = $1"
+		args = append(args, transactionId)
+	}
+
+	formattedQuery, err := s.formatPlaceholder(`SELECT
+		transaction_id,
+		event_type,
+		status,
+		data,
+		success,
+		created_at
+	FROM
+		webhook_history
+	` + where + `
+	ORDER BY
+		created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format query: %w", err)
+	}
+
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil && !errors.Is(err, sql.ErrConnDone) {
+			log.Printf("failed to close database connection: %v", err)
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, formattedQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook history: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []WebhookAttempt
+	for rows.Next() {
+		var attempt WebhookAttempt
+		err := rows.Scan(
+			&attempt.TransactionId,
+			&attempt.EventType,
+			&attempt.Status,
+			&attempt.Data,
+			&attempt.Success,
+			&attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook attempt: %w", err)
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate webhook history: %w", err)
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close rows: %w", err)
+	}
+
+	err = conn.Close()
+	if err != nil && !errors.Is(err, sql.ErrConnDone) {
+		return nil, fmt.Errorf("failed to close database connection: %w", err)
+	}
+
+	return attempts, nil
+}
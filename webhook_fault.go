@@ -0,0 +1,270 @@
+package mocktrans
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// WebhookFaultRule changes how the notifications that it matches are delivered, to prove that
+// a webhook handler copes with what Midtrans may do: deliver twice, out of order, late, with a
+// signature that does not verify, or not at all. Every condition that is set must match, and the
+// first matching rule applies.
+type WebhookFaultRule struct {
+	// Pattern that is matched against the order_id, where * matches anything, as in "DUP-*".
+	OrderId string `json:"order_id"`
+	// TransactionStatus matches the transaction_status of the notification, such as "pending".
+	TransactionStatus string `json:"transaction_status"`
+
+	// Omit drops the notification, it is never sent.
+	Omit bool `json:"omit"`
+	// Delay holds the notification back for a while before sending it.
+	Delay Duration `json:"delay"`
+	// Duplicates is how many more times the notification is sent after the first time.
+	Duplicates int `json:"duplicates"`
+	// CorruptSignature sends a signature_key that does not match the notification.
+	CorruptSignature bool `json:"corrupt_signature"`
+	// DeliverAfterNext holds the notification back until the next notification of the
+	// transaction has been sent, so that a pending arrives after its settlement.
+	DeliverAfterNext bool `json:"deliver_after_next"`
+	// HoldTimeout sends a notification that DeliverAfterNext holds back on its own, when no
+	// other notification of the transaction came along in this long. Defaults to a minute.
+	HoldTimeout Duration `json:"hold_timeout"`
+}
+
+// defaultHoldTimeout is the HoldTimeout of the rules that do not set one.
+const defaultHoldTimeout = time.Minute
+
+// webhookFaults holds the webhook fault rules, which the admin API changes while Mocktrans
+// runs, and the notifications that wait for the next one of their transaction.
+type webhookFaults struct {
+	mu    sync.Mutex
+	rules []WebhookFaultRule
+	held  map[string]*heldNotifications
+}
+
+// heldNotifications are the notifications of a transaction that wait for the next one,
+// until the timer of the first of them sends them anyway.
+type heldNotifications struct {
+	notifications []NotificationRequest
+	timer         *time.Timer
+}
+
+// LoadWebhookFaultRules reads the webhook fault rules from a JSON file containing an array of WebhookFaultRule.
+func LoadWebhookFaultRules(filePath string) ([]WebhookFaultRule, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook fault rules file: %w", err)
+	}
+
+	var rules []WebhookFaultRule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook fault rules file: %w", err)
+	}
+
+	err = ValidateWebhookFaultRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ValidateWebhookFaultRules checks the patterns, and that nothing is negative.
+func ValidateWebhookFaultRules(rules []WebhookFaultRule) error {
+	for i, rule := range rules {
+		_, err := path.Match(rule.OrderId, "")
+		if err != nil {
+			return fmt.Errorf("rule %d: invalid pattern %s: %w", i, rule.OrderId, err)
+		}
+
+		if rule.Delay < 0 {
+			return fmt.Errorf("rule %d: delay can not be negative", i)
+		}
+
+		if rule.HoldTimeout < 0 {
+			return fmt.Errorf("rule %d: hold_timeout can not be negative", i)
+		}
+
+		if rule.Duplicates < 0 {
+			return fmt.Errorf("rule %d: duplicates can not be negative", i)
+		}
+	}
+
+	return nil
+}
+
+func (w WebhookFaultRule) matches(notification NotificationRequest) bool {
+	if w.OrderId != "" {
+		if ok, _ := path.Match(w.OrderId, notification.OrderId); !ok {
+			return false
+		}
+	}
+
+	if w.TransactionStatus != "" && w.TransactionStatus != notification.TransactionStatus {
+		return false
+	}
+
+	return true
+}
+
+// WebhookFaultRules returns the webhook fault rules that are in effect.
+func (d *Dependencies) WebhookFaultRules() []WebhookFaultRule {
+	d.webhookFaults.mu.Lock()
+	defer d.webhookFaults.mu.Unlock()
+
+	return append([]WebhookFaultRule{}, d.webhookFaults.rules...)
+}
+
+// SetWebhookFaultRules replaces the webhook fault rules, an empty list turns them off.
+// The notifications that were held back for the next one are sent right away.
+func (d *Dependencies) SetWebhookFaultRules(rules []WebhookFaultRule) error {
+	err := ValidateWebhookFaultRules(rules)
+	if err != nil {
+		return err
+	}
+
+	d.webhookFaults.mu.Lock()
+	d.webhookFaults.rules = append([]WebhookFaultRule{}, rules...)
+	var transactionIds []string
+	for transactionId := range d.webhookFaults.held {
+		transactionIds = append(transactionIds, transactionId)
+	}
+	d.webhookFaults.mu.Unlock()
+
+	for _, transactionId := range transactionIds {
+		d.flushHeldNotifications(transactionId)
+	}
+
+	return nil
+}
+
+func (d *Dependencies) webhookFaultFor(notification NotificationRequest) (WebhookFaultRule, bool) {
+	d.webhookFaults.mu.Lock()
+	defer d.webhookFaults.mu.Unlock()
+
+	for _, rule := range d.webhookFaults.rules {
+		if rule.matches(notification) {
+			return rule, true
+		}
+	}
+
+	return WebhookFaultRule{}, false
+}
+
+// deliverNotification sends the notification the way the webhook fault rules say, and then
+// the notifications of the transaction that were held back for it.
+func (d *Dependencies) deliverNotification(transactionId string, notification NotificationRequest) {
+	rule, ok := d.webhookFaultFor(notification)
+	if !ok {
+		d.sendNotification(transactionId, notification)
+		d.sendHeldNotifications(transactionId)
+		return
+	}
+
+	if rule.Omit {
+		log.Printf("omitted the %s notification of transaction %s", notification.TransactionStatus, transactionId)
+		return
+	}
+
+	if rule.CorruptSignature {
+		sum := sha512.Sum512([]byte(notification.SignatureKey))
+		notification.SignatureKey = hex.EncodeToString(sum[:])
+	}
+
+	if rule.DeliverAfterNext {
+		d.holdNotification(transactionId, notification, rule)
+		return
+	}
+
+	// The later notifications of the transaction wait for the delayed one
+	time.Sleep(time.Duration(rule.Delay))
+
+	for i := 0; i <= rule.Duplicates; i++ {
+		d.sendNotification(transactionId, notification)
+	}
+	d.sendHeldNotifications(transactionId)
+}
+
+// holdNotification keeps the notification until the next one of its transaction has been sent,
+// or until the hold timeout of the first held notification of the transaction is over.
+func (d *Dependencies) holdNotification(transactionId string, notification NotificationRequest, rule WebhookFaultRule) {
+	d.webhookFaults.mu.Lock()
+	defer d.webhookFaults.mu.Unlock()
+
+	if d.webhookFaults.held == nil {
+		d.webhookFaults.held = make(map[string]*heldNotifications)
+	}
+
+	held, ok := d.webhookFaults.held[transactionId]
+	if !ok {
+		timeout := time.Duration(rule.HoldTimeout)
+		if timeout == 0 {
+			timeout = defaultHoldTimeout
+		}
+
+		held = &heldNotifications{}
+		held.timer = time.AfterFunc(timeout, func() {
+			d.flushHeldNotifications(transactionId)
+		})
+		d.webhookFaults.held[transactionId] = held
+	}
+	held.notifications = append(held.notifications, notification)
+}
+
+// takeHeldNotifications returns the held notifications of the transaction, which are
+// no longer held from then on.
+func (d *Dependencies) takeHeldNotifications(transactionId string) []NotificationRequest {
+	d.webhookFaults.mu.Lock()
+	defer d.webhookFaults.mu.Unlock()
+
+	held, ok := d.webhookFaults.held[transactionId]
+	if !ok {
+		return nil
+	}
+
+	held.timer.Stop()
+	delete(d.webhookFaults.held, transactionId)
+	return held.notifications
+}
+
+// dropHeldNotifications forgets the held notifications of every transaction without sending them.
+func (d *Dependencies) dropHeldNotifications() {
+	d.webhookFaults.mu.Lock()
+	defer d.webhookFaults.mu.Unlock()
+
+	for transactionId, held := range d.webhookFaults.held {
+		held.timer.Stop()
+		delete(d.webhookFaults.held, transactionId)
+	}
+}
+
+// sendHeldNotifications sends the held notifications of the transaction, after the one
+// that they waited for.
+func (d *Dependencies) sendHeldNotifications(transactionId string) {
+	for _, notification := range d.takeHeldNotifications(transactionId) {
+		d.sendNotification(transactionId, notification)
+	}
+}
+
+// flushHeldNotifications sends the held notifications of the transaction without waiting for
+// the next one any longer, after the notifications of the transaction that are on their way.
+func (d *Dependencies) flushHeldNotifications(transactionId string) {
+	d.enqueueDelivery(transactionId, func() {
+		d.sendHeldNotifications(transactionId)
+	})
+}
+
+func (d *Dependencies) sendNotification(transactionId string, notification NotificationRequest) {
+	err := d.SendWebhook(transactionId, notification)
+	if err != nil {
+		log.Printf("failed to send notification for transaction %s: %v", transactionId, err)
+	}
+}